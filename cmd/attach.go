@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bk201/support-bundle-utils/pkg/attach"
+	"github.com/bk201/support-bundle-utils/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+const issueTokenEnv = "SUPPORT_BUNDLE_ISSUE_TOKEN"
+
+// attachCmd represents the attach command
+var attachCmd = &cobra.Command{
+	Use:   "attach [bundle]",
+	Short: "Post a support bundle summary to an issue",
+	Long: `Post a support bundle summary (name, size, checksum and analysis highlights) as a
+comment on a GitHub or GitLab issue. The highlights are the findings of the
+report commands, and the ones given with --highlight. The bundle is uploaded to GitLab issues
+with --upload; GitHub does not support attachments, so use --bundle-url to link
+it. Other trackers can be reached with --webhook, which receives the summary
+as JSON instead of the issue. The issue token is not sent to the webhook, use
+--webhook-token if it requires one.
+
+The token can also be passed with the ` + issueTokenEnv + ` environment variable.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runAttach(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to attach support bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var (
+	attachConfig      = attach.Options{}
+	attachName        string
+	attachDescription string
+	attachBundleURL   string
+	attachHighlights  []string
+	attachNoAnalysis  bool
+)
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+	attachCmd.PersistentFlags().StringVar(&attachConfig.IssueURL, "issue", "", "issue URL")
+	attachCmd.PersistentFlags().StringVar(&attachConfig.Token, "token", "", "issue tracker API token")
+	attachCmd.PersistentFlags().StringVar(&attachConfig.Tracker, "tracker", "", "issue tracker type: github, gitlab or webhook (default detected from the issue URL)")
+	attachCmd.PersistentFlags().StringVar(&attachConfig.APIURL, "api-url", "", "issue tracker API URL (default derived from the issue URL)")
+	attachCmd.PersistentFlags().StringVar(&attachConfig.WebhookURL, "webhook", "", "post the summary as JSON to this URL instead of the issue")
+	attachCmd.PersistentFlags().StringVar(&attachConfig.WebhookToken, "webhook-token", "", "bearer token sent to the webhook")
+	attachCmd.PersistentFlags().BoolVar(&attachConfig.Upload, "upload", false, "upload the bundle if the tracker supports attachments")
+	attachCmd.PersistentFlags().BoolVar(&attachConfig.Insecure, "insecure", false, "do not verify server certificate")
+	attachCmd.PersistentFlags().StringVar(&attachName, "name", "", "bundle name (default bundle file name)")
+	attachCmd.PersistentFlags().StringVar(&attachDescription, "description", "", "issue description")
+	attachCmd.PersistentFlags().StringVar(&attachBundleURL, "bundle-url", "", "URL where the bundle can be downloaded")
+	attachCmd.PersistentFlags().StringSliceVar(&attachHighlights, "highlight", nil, "analysis highlight to include in the summary (can be repeated)")
+	attachCmd.PersistentFlags().BoolVar(&attachNoAnalysis, "no-analysis", false, "do not add the findings of the bundle reports to the highlights")
+}
+
+func runAttach(path string) error {
+	if attachConfig.IssueURL == "" && attachConfig.WebhookURL == "" {
+		return errors.New("--issue or --webhook is required")
+	}
+	if attachConfig.Token == "" {
+		attachConfig.Token = os.Getenv(issueTokenEnv)
+	}
+	tracker, err := attach.NewTracker(attachConfig)
+	if err != nil {
+		return err
+	}
+
+	summary, err := attach.NewSummary(attachName, path)
+	if err != nil {
+		return err
+	}
+	summary.IssueURL = attachConfig.IssueURL
+	summary.Description = attachDescription
+	summary.BundleURL = attachBundleURL
+	summary.Highlights = attachHighlights
+	if !attachNoAnalysis {
+		highlights, err := report.Highlights(path, attach.MaxHighlights)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: fail to analyze bundle: %s\n", err)
+		}
+		summary.Highlights = append(summary.Highlights, highlights...)
+	}
+
+	link, err := tracker.Attach(context.Background(), summary, path)
+	if err != nil {
+		return err
+	}
+	if link != "" {
+		fmt.Printf("bundle summary is posted to %s\n", link)
+	} else {
+		fmt.Println("bundle summary is posted")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/bk201/support-bundle-utils/pkg/rancher"
+	"github.com/spf13/cobra"
+)
+
+const rancherTokenEnv = "RANCHER_TOKEN"
+
+// clustersCmd represents the clusters command
+var clustersCmd = &cobra.Command{
+	Use:   "clusters [rancher_url]",
+	Short: "List the Harvester clusters known to a Rancher server",
+	Long: `List the Harvester clusters known to a Rancher server.
+
+Clusters imported into Rancher can be reached through it by passing the Rancher
+URL, an API token and the cluster ID or name to download, e.g.,
+
+  support-bundle-utils download https://rancher.example.com --rancher-token token-abcde:secret --cluster harvester1
+
+The token can also be passed with the ` + rancherTokenEnv + ` environment variable.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runClusters(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to list clusters: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var (
+	clustersToken    string
+	clustersInsecure bool
+	clustersAll      bool
+	clustersOutput   string
+)
+
+func init() {
+	rootCmd.AddCommand(clustersCmd)
+	clustersCmd.Flags().StringVar(&clustersToken, "rancher-token", "", "Rancher API token (default $"+rancherTokenEnv+")")
+	clustersCmd.Flags().BoolVar(&clustersInsecure, "insecure", false, "do not verify server certificate")
+	clustersCmd.Flags().BoolVar(&clustersAll, "all", false, "list all clusters, not only Harvester clusters")
+	clustersCmd.Flags().StringVarP(&clustersOutput, "output", "o", "table", "output format: table or json")
+}
+
+func runClusters(rancherURL string) error {
+	token := clustersToken
+	if token == "" {
+		token = os.Getenv(rancherTokenEnv)
+	}
+	if token == "" {
+		return fmt.Errorf("a Rancher API token is required, set --rancher-token or $%s", rancherTokenEnv)
+	}
+
+	rc := rancher.NewClient(rancherURL, token, clustersInsecure)
+	clusters, err := rc.Clusters(context.Background())
+	if err != nil {
+		return err
+	}
+	var matched []rancher.Cluster
+	for _, c := range clusters {
+		if clustersAll || c.IsHarvester() {
+			matched = append(matched, c)
+		}
+	}
+
+	switch clustersOutput {
+	case "json":
+		return printJSON(matched)
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %q", clustersOutput)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tSTATE\tPROVIDER\tURL")
+	for _, c := range matched {
+		provider := c.Provider
+		if provider == "" {
+			provider = c.Driver
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Name, c.ID, orNone(c.State), orNone(provider), rc.ProxyURL(c.ID))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/doctor"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [api_url]",
+	Short: "Check the connection to a Harvester cluster before downloading a bundle",
+	Long: `Check step by step what downloading a bundle needs: DNS resolution, TCP
+reachability, the TLS handshake and certificate, the login, the API version and
+the permissions to list and create support bundles.
+
+Each check passes, warns or fails with a hint on how to fix it. Checks depending
+on a failed one are skipped. The JSON output can be attached to tickets.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runDoctor(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to check cluster: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var (
+	doctorOptions = doctor.Options{}
+	doctorOutput  string
+)
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().BoolVar(&doctorOptions.NoAuth, "noauth", false, "do not check the login")
+	doctorCmd.Flags().StringVar(&doctorOptions.User, "user", "", "username")
+	doctorCmd.Flags().StringVar(&doctorOptions.Password, "password", "", "password")
+	doctorCmd.Flags().BoolVar(&doctorOptions.Insecure, "insecure", false, "do not verify server certificate")
+	doctorCmd.Flags().DurationVar(&doctorOptions.Timeout, "timeout", 10*time.Second, "timeout of the DNS, TCP and TLS checks")
+	doctorCmd.Flags().StringVarP(&doctorOutput, "output", "o", "table", "output format: table or json")
+}
+
+func runDoctor(apiURL string) error {
+	switch doctorOutput {
+	case "json", "table":
+	default:
+		return fmt.Errorf("unknown output format %q", doctorOutput)
+	}
+	doctorOptions.URL = apiURL
+	report := doctor.Run(context.Background(), doctorOptions)
+
+	if doctorOutput == "json" {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range report.Checks {
+			fmt.Printf("[%s] %s", strings.ToUpper(string(c.Status)), c.Name)
+			if c.Detail != "" {
+				fmt.Printf(": %s", c.Detail)
+			}
+			fmt.Println()
+			if c.Hint != "" && c.Status != doctor.StatusPass {
+				fmt.Printf("       hint: %s\n", c.Hint)
+			}
+		}
+	}
+	if report.Failed() {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
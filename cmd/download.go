@@ -1,36 +1,198 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/bk201/support-bundle-utils/pkg/attach"
 	"github.com/bk201/support-bundle-utils/pkg/client"
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // downloadCmd represents the download command
 var downloadCmd = &cobra.Command{
 	Use:   "download [api_url]",
 	Short: "Generate and download a support bundle from a Harvester cluster",
-	Long:  "Generate and download a support bundle from a Harvester cluster",
+	Long: `Generate and download a support bundle from a Harvester cluster.
+
+Bundles are created with the Harvester REST API at api_url, or as SupportBundle
+custom resources with a kubeconfig, see --backend. api_url can be omitted when
+a kubeconfig is used.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := cmdConfig.Run(args[0]); err != nil {
+		if err := prepareDownload(); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid download options: %s\n", err)
+			os.Exit(1)
+		}
+		if err := cmdConfig.Run(apiURL(args)); err != nil {
 			fmt.Fprintf(os.Stderr, "fail to download support bundle: %s\n", err)
+			if os.IsExist(err) {
+				fmt.Fprintln(os.Stderr, "use --force to overwrite it or --output to save the bundle somewhere else")
+			}
 			os.Exit(1)
 		}
 	},
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MaximumNArgs(1),
 }
 
-var cmdConfig = client.SupportBundleClient{}
+var (
+	cmdConfig          = client.SupportBundleClient{Stdout: os.Stdout, Stderr: os.Stderr}
+	downloadEncrypt    bool
+	downloadEncryption = encryptionOptions{}
+	downloadSplit      string
+	downloadAttach     bool
+	downloadAttachment = attach.Options{}
+	downloadHooks      = hookOptions{}
+	downloadNoLibrary  bool
+	downloadLimitRate  string
+	downloadSince      string
+	downloadUntil      string
+	downloadVMLogs     bool
+)
 
 func init() {
 	rootCmd.AddCommand(downloadCmd)
-	downloadCmd.PersistentFlags().BoolVar(&cmdConfig.NoAuth, "noauth", false, "authorize before getting the bundle")
-	downloadCmd.PersistentFlags().StringVar(&cmdConfig.User, "user", "", "username")
-	downloadCmd.PersistentFlags().StringVar(&cmdConfig.Password, "password", "", "password")
-	downloadCmd.PersistentFlags().StringVar(&cmdConfig.OutputFile, "output", "", "output file path (default ${bundle_name}.zip)")
-	downloadCmd.PersistentFlags().BoolVar(&cmdConfig.Insecure, "insecure", false, "do not verify server certificate")
-	downloadCmd.PersistentFlags().StringVar(&cmdConfig.IssueURL, "issue", "", "issue URL")
-	downloadCmd.PersistentFlags().StringVar(&cmdConfig.IssueDescription, "description", "No description", "issue description")
+	addDownloadFlags(downloadCmd.PersistentFlags())
+	downloadCmd.PersistentFlags().StringVar(&cmdConfig.OutputFile, "output", "", "output file path, - to write the bundle to stdout (default the name sent by the server, or ${bundle_name}.zip)")
+	downloadCmd.PersistentFlags().StringVar(&cmdConfig.OutputDir, "output-dir", "", "directory to save the bundle to (default the current directory)")
+	downloadCmd.PersistentFlags().BoolVar(&cmdConfig.Force, "force", false, "overwrite an existing bundle file")
+}
+
+// addDownloadFlags adds the flags controlling how a bundle is generated and
+// post-processed. They are shared by the commands that download bundles.
+func addDownloadFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&cmdConfig.NoAuth, "noauth", false, "authorize before getting the bundle")
+	flags.StringVar(&cmdConfig.User, "user", "", "username")
+	flags.StringVar(&cmdConfig.Password, "password", "", "password")
+	flags.BoolVar(&cmdConfig.Insecure, "insecure", false, "do not verify server certificate")
+	flags.StringVar(&cmdConfig.Backend, "backend", client.BackendAuto, "how bundles are created: "+strings.Join(client.Backends, ", ")+"; auto uses SupportBundle resources when a kubeconfig is set or api_url is omitted")
+	flags.StringVar(&cmdConfig.Kubeconfig, "kubeconfig", "", "kubeconfig file of the cluster for SupportBundle resources (default $KUBECONFIG or ~/.kube/config)")
+	flags.StringVar(&cmdConfig.RancherToken, "rancher-token", "", "Rancher API token, api_url is then a Rancher URL (default $"+rancherTokenEnv+")")
+	flags.StringVar(&cmdConfig.Cluster, "cluster", "", "ID or name of the Harvester cluster in Rancher, see the clusters command")
+	flags.IntVar(&cmdConfig.Connections, "connections", 1, "download the bundle in byte ranges over this many concurrent connections")
+	flags.IntVar(&cmdConfig.Retries, "retries", 3, "number of times a failed byte range is retried")
+	flags.StringVar(&downloadLimitRate, "limit-rate", "", "cap the download rate in bytes per second, e.g., 10M")
+	flags.StringVar(&cmdConfig.IssueURL, "issue", "", "issue URL")
+	flags.StringVar(&cmdConfig.IssueDescription, "description", "No description", "issue description")
+	flags.StringSliceVar(&cmdConfig.Scope.Namespaces, "namespaces", nil, "only collect resources and pod logs of these namespaces")
+	flags.StringSliceVar(&cmdConfig.Scope.Nodes, "nodes", nil, "only collect the logs of these nodes")
+	flags.StringVar(&downloadSince, "since", "", "only collect log lines since a time, as RFC 3339 or a duration before now, e.g., 24h")
+	flags.StringVar(&downloadUntil, "until", "", "only collect log lines until a time, as RFC 3339 or a duration before now")
+	flags.BoolVar(&downloadVMLogs, "vm-logs", true, "collect the logs of the virt-launcher pods running VMs")
+	flags.BoolVar(&cmdConfig.Reuse, "reuse", true, "reuse a bundle of the same issue being generated or generated within --reuse-window, unless a scope is set")
+	flags.DurationVar(&cmdConfig.ReuseWindow, "reuse-window", time.Hour, "how recent a generated bundle of the same issue must be to reuse it")
+	flags.StringVar(&cmdConfig.ReuseBundle, "reuse-bundle", "", "download the existing bundle of this name instead of creating one")
+	flags.BoolVar(&cmdConfig.Cleanup, "cleanup", false, "delete the bundle from the cluster once it's downloaded and verified, reused bundles are kept")
+	flags.BoolVar(&downloadEncrypt, "encrypt", false, "encrypt the bundle as it's received, see the encrypt command")
+	flags.StringVar(&downloadEncryption.Passphrase, "encrypt-passphrase", "", "encrypt with a passphrase")
+	flags.StringVar(&downloadEncryption.PassphraseFile, "encrypt-passphrase-file", "", "encrypt with a passphrase read from a file")
+	flags.StringSliceVar(&downloadEncryption.Recipients, "recipient", nil, "encrypt for a public key or a file containing public keys (can be repeated)")
+	flags.StringVar(&downloadSplit, "split", "", "also split the bundle into parts of this size, e.g., 200M, see the split command")
+	flags.BoolVar(&downloadAttach, "attach", false, "post a bundle summary to the issue, see the attach command")
+	flags.StringVar(&downloadAttachment.Token, "issue-token", "", "issue tracker API token")
+	flags.StringVar(&downloadAttachment.WebhookURL, "issue-webhook", "", "post the summary as JSON to this URL instead of the issue")
+	flags.StringVar(&downloadAttachment.WebhookToken, "issue-webhook-token", "", "bearer token sent to the issue webhook")
+	flags.BoolVar(&downloadAttachment.Upload, "issue-upload", false, "upload the bundle if the issue tracker supports attachments")
+	downloadHooks.addFlags(flags)
+	flags.BoolVar(&downloadNoLibrary, "no-library", false, "do not register the bundle in the local library")
+	flags.StringVar(&libraryPath, "library", "", "library index file path (default $HOME/.support-bundle-utils/library.json)")
+}
+
+// apiURL returns the optional api_url argument.
+func apiURL(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+// prepareDownload applies the download options that need parsing to cmdConfig.
+func prepareDownload() error {
+	if cmdConfig.RancherToken == "" {
+		cmdConfig.RancherToken = os.Getenv(rancherTokenEnv)
+	}
+	if cmdConfig.Cluster != "" && cmdConfig.RancherToken == "" {
+		return fmt.Errorf("--cluster requires a Rancher API token, set --rancher-token or $%s", rancherTokenEnv)
+	}
+	if cmdConfig.Cluster == "" {
+		// The token is only used to reach a cluster through Rancher.
+		cmdConfig.RancherToken = ""
+	}
+	since, err := parseTime(downloadSince)
+	if err != nil {
+		return fmt.Errorf("since: %s", err)
+	}
+	until, err := parseTime(downloadUntil)
+	if err != nil {
+		return fmt.Errorf("until: %s", err)
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		return errors.New("--until is before --since")
+	}
+	cmdConfig.Scope.Since = since
+	cmdConfig.Scope.Until = until
+	cmdConfig.Scope.ExcludeVMLogs = !downloadVMLogs
+	if !downloadEncrypt && (downloadEncryption.Passphrase != "" || downloadEncryption.PassphraseFile != "" || len(downloadEncryption.Recipients) > 0) {
+		return errors.New("--encrypt-passphrase, --encrypt-passphrase-file and --recipient require --encrypt")
+	}
+	if downloadEncrypt {
+		recipients, err := downloadEncryption.recipients()
+		if err != nil {
+			return fmt.Errorf("encryption: %s", err)
+		}
+		cmdConfig.Recipients = recipients
+	}
+	if downloadLimitRate != "" {
+		rate, err := utils.ParseSize(downloadLimitRate)
+		if err != nil {
+			return fmt.Errorf("limit rate: %s", err)
+		}
+		cmdConfig.RateLimit = rate
+	}
+	if downloadSplit != "" {
+		size, err := utils.ParseSize(downloadSplit)
+		if err != nil {
+			return fmt.Errorf("split: %s", err)
+		}
+		cmdConfig.SplitSize = size
+	}
+	if downloadAttach {
+		downloadAttachment.IssueURL = cmdConfig.IssueURL
+		if downloadAttachment.Token == "" {
+			downloadAttachment.Token = os.Getenv(issueTokenEnv)
+		}
+		tracker, err := attach.NewTracker(downloadAttachment)
+		if err != nil {
+			return fmt.Errorf("attach: %s", err)
+		}
+		cmdConfig.Tracker = tracker
+	}
+	notifier, err := downloadHooks.notifier()
+	if err != nil {
+		return fmt.Errorf("hooks: %s", err)
+	}
+	cmdConfig.Notifier = notifier
+	if !downloadNoLibrary {
+		lib, err := openLibrary()
+		if err != nil {
+			return fmt.Errorf("library: %s", err)
+		}
+		cmdConfig.Library = lib
+	}
+	return nil
+}
+
+// parseTime parses an RFC 3339 time, or a duration before now.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bk201/support-bundle-utils/pkg/encrypt"
+	"github.com/spf13/cobra"
+)
+
+const (
+	encryptedSuffix = ".enc"
+	passphraseEnv   = "SUPPORT_BUNDLE_PASSPHRASE"
+)
+
+// encryptCmd represents the encrypt command
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt [bundle]",
+	Short: "Encrypt a support bundle",
+	Long: `Encrypt a support bundle with a passphrase or for one or more recipient public keys.
+
+The passphrase can also be passed with the ` + passphraseEnv + ` environment variable.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runEncrypt(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to encrypt support bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+// decryptCmd represents the decrypt command
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt [encrypted_bundle]",
+	Short: "Decrypt an encrypted support bundle",
+	Long: `Decrypt an encrypted support bundle with a passphrase or identity files.
+
+The passphrase can also be passed with the ` + passphraseEnv + ` environment variable.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runDecrypt(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to decrypt support bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+type encryptionOptions struct {
+	Passphrase     string
+	PassphraseFile string
+	Recipients     []string
+	Identities     []string
+}
+
+var (
+	encryptConfig     = encryptionOptions{}
+	encryptOutput     string
+	encryptBundleName string
+
+	decryptConfig = encryptionOptions{}
+	decryptOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(encryptCmd)
+	encryptCmd.PersistentFlags().StringVar(&encryptOutput, "output", "", "output file path (default ${bundle}.enc)")
+	encryptCmd.PersistentFlags().StringVar(&encryptBundleName, "name", "", "bundle name recorded in the header (default bundle file name)")
+	encryptCmd.PersistentFlags().StringVar(&encryptConfig.Passphrase, "passphrase", "", "encrypt with a passphrase")
+	encryptCmd.PersistentFlags().StringVar(&encryptConfig.PassphraseFile, "passphrase-file", "", "encrypt with a passphrase read from a file")
+	encryptCmd.PersistentFlags().StringSliceVar(&encryptConfig.Recipients, "recipient", nil, "encrypt for a public key or a file containing public keys (can be repeated)")
+
+	rootCmd.AddCommand(decryptCmd)
+	decryptCmd.PersistentFlags().StringVar(&decryptOutput, "output", "", "output file path (default input without .enc suffix)")
+	decryptCmd.PersistentFlags().StringVar(&decryptConfig.Passphrase, "passphrase", "", "decrypt with a passphrase")
+	decryptCmd.PersistentFlags().StringVar(&decryptConfig.PassphraseFile, "passphrase-file", "", "decrypt with a passphrase read from a file")
+	decryptCmd.PersistentFlags().StringSliceVar(&decryptConfig.Identities, "identity", nil, "decrypt with a secret key file (can be repeated)")
+}
+
+func runEncrypt(path string) error {
+	recipients, err := encryptConfig.recipients()
+	if err != nil {
+		return err
+	}
+
+	output := encryptOutput
+	if output == "" {
+		output = path + encryptedSuffix
+	}
+	name := encryptBundleName
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), ".zip")
+	}
+
+	if err := encrypt.EncryptFile(path, output, name, recipients...); err != nil {
+		return err
+	}
+	fmt.Printf("encrypted bundle is saved to %s\n", output)
+	return nil
+}
+
+func runDecrypt(path string) error {
+	identities, err := decryptConfig.identities()
+	if err != nil {
+		return err
+	}
+
+	output := decryptOutput
+	if output == "" {
+		output = strings.TrimSuffix(path, encryptedSuffix)
+		if output == path {
+			output = path + ".zip"
+		}
+	}
+
+	hdr, err := encrypt.DecryptFile(path, output, identities...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bundle %s is decrypted to %s\n", hdr.BundleName, output)
+	return nil
+}
+
+func (o *encryptionOptions) passphrase() (string, error) {
+	if o.Passphrase != "" {
+		return o.Passphrase, nil
+	}
+	if o.PassphraseFile != "" {
+		data, err := ioutil.ReadFile(o.PassphraseFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return os.Getenv(passphraseEnv), nil
+}
+
+func (o *encryptionOptions) recipients() ([]encrypt.Recipient, error) {
+	var recipients []encrypt.Recipient
+
+	passphrase, err := o.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		r, err := encrypt.NewPassphraseRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	for _, value := range o.Recipients {
+		keys := []string{value}
+		if !strings.HasPrefix(value, encrypt.PublicKeyPrefix) {
+			if keys, err = readKeyFile(value); err != nil {
+				return nil, err
+			}
+		}
+		for _, key := range keys {
+			r, err := encrypt.ParseRecipient(key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", value, err)
+			}
+			recipients = append(recipients, r)
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil, errors.New("a passphrase or at least one recipient is required")
+	}
+	return recipients, nil
+}
+
+func (o *encryptionOptions) identities() ([]encrypt.Identity, error) {
+	var identities []encrypt.Identity
+
+	passphrase, err := o.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		id, err := encrypt.NewPassphraseIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, id)
+	}
+
+	for _, file := range o.Identities {
+		keys, err := readKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			id, err := encrypt.ParseIdentity(key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", file, err)
+			}
+			identities = append(identities, id)
+		}
+	}
+
+	if len(identities) == 0 {
+		return nil, errors.New("a passphrase or at least one identity is required")
+	}
+	return identities, nil
+}
+
+// readKeyFile returns the keys in a file, one per line. Empty lines and lines
+// starting with "#" are ignored.
+func readKeyFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys found", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/bk201/support-bundle-utils/pkg/hook"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// hookOptions holds hooks given on the command line. More hooks can be
+// configured with the "hooks" key of the config file, see hook.Config.
+type hookOptions struct {
+	Webhooks []string
+	Slack    []string
+	Commands []string
+}
+
+func (o *hookOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&o.Webhooks, "hook-webhook", nil, "post lifecycle events as JSON to this URL (can be repeated)")
+	flags.StringSliceVar(&o.Slack, "hook-slack", nil, "post lifecycle events to this Slack-compatible incoming webhook URL (can be repeated)")
+	flags.StringArrayVar(&o.Commands, "hook-exec", nil, "run this shell command with sh -c on lifecycle events, with the JSON event on stdin (can be repeated)")
+}
+
+// notifier returns a notifier for the hooks in the options and the config
+// file, or nil if there are none.
+func (o *hookOptions) notifier() (*hook.Notifier, error) {
+	var configs []hook.Config
+	if err := viper.UnmarshalKey("hooks", &configs); err != nil {
+		return nil, fmt.Errorf("invalid hooks in config file: %s", err)
+	}
+	for _, url := range o.Webhooks {
+		configs = append(configs, hook.Config{Type: hook.TypeWebhook, URL: url})
+	}
+	for _, url := range o.Slack {
+		configs = append(configs, hook.Config{Type: hook.TypeSlack, URL: url})
+	}
+	for _, command := range o.Commands {
+		// Quoting and pipes work as typed, like in the shell.
+		configs = append(configs, hook.Config{Type: hook.TypeExec, Command: []string{"sh", "-c", command}})
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	n := &hook.Notifier{}
+	for _, c := range configs {
+		h, err := hook.New(c)
+		if err != nil {
+			return nil, err
+		}
+		n.Hooks = append(n.Hooks, h)
+	}
+	return n, nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bk201/support-bundle-utils/pkg/encrypt"
+	"github.com/spf13/cobra"
+)
+
+// keygenCmd represents the keygen command
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a key pair for encrypting support bundles",
+	Long: `Generate a key pair for encrypting support bundles.
+
+The secret key is written to the output file. Share the printed public key with
+whoever sends you bundles so they can encrypt with --recipient.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runKeygen(); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to generate key: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.NoArgs,
+}
+
+var keygenOutput string
+
+func init() {
+	rootCmd.AddCommand(keygenCmd)
+	keygenCmd.PersistentFlags().StringVar(&keygenOutput, "output", "support-bundle.key", "secret key file path")
+}
+
+func runKeygen() error {
+	id, err := encrypt.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(keygenOutput); err == nil {
+		return fmt.Errorf("%s already exists", keygenOutput)
+	}
+
+	pub := id.Recipient().String()
+	content := fmt.Sprintf("# public key: %s\n%s\n", pub, id.String())
+	if err := ioutil.WriteFile(keygenOutput, []byte(content), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("secret key is saved to %s\n", keygenOutput)
+	fmt.Printf("public key: %s\n", pub)
+	return nil
+}
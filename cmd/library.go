@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/library"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// libraryCmd represents the library command
+var libraryCmd = &cobra.Command{
+	Use:   "library",
+	Short: "Query and clean up the local bundle library",
+	Long: `Query and clean up the local bundle library.
+
+Every downloaded bundle is registered in the library index with the cluster,
+issue and checksum it belongs to. The index path can be set with --library or
+the "library" key of the config file.`,
+}
+
+var libraryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List bundles in the library",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runLibraryList(); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to list bundles: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.NoArgs,
+}
+
+var libraryShowCmd = &cobra.Command{
+	Use:   "show [id|name]",
+	Short: "Show a bundle in the library",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runLibraryShow(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to show bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var libraryAddCmd = &cobra.Command{
+	Use:   "add [bundle]",
+	Short: "Register an existing bundle file in the library",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runLibraryAdd(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to add bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var libraryTagCmd = &cobra.Command{
+	Use:   "tag [id|name] [tag]...",
+	Short: "Tag a bundle in the library",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runLibraryTag(args[0], args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to tag bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.MinimumNArgs(2),
+}
+
+var libraryPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove bundles from the library by age, cluster or tag",
+	Long: `Remove bundles from the library by age, cluster or tag. All given filters must
+match. Bundle files are only deleted with --delete-files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runLibraryPrune(); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to prune bundles: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.NoArgs,
+}
+
+// libraryFilter selects library entries. Empty fields match everything.
+type libraryFilter struct {
+	Cluster   string
+	Issue     string
+	Tag       string
+	OlderThan time.Duration
+	Missing   bool
+}
+
+var (
+	libraryPath string
+
+	libraryListFilter = libraryFilter{}
+	libraryListOutput string
+
+	libraryAddConfig = library.Entry{}
+	libraryAddTags   []string
+
+	libraryTagRemove bool
+
+	libraryPruneFilter      = libraryFilter{}
+	libraryPruneDeleteFiles bool
+	libraryPruneDryRun      bool
+)
+
+func init() {
+	rootCmd.AddCommand(libraryCmd)
+	libraryCmd.PersistentFlags().StringVar(&libraryPath, "library", "", "library index file path (default $HOME/.support-bundle-utils/library.json)")
+
+	libraryCmd.AddCommand(libraryListCmd)
+	libraryListFilter.addFlags(libraryListCmd)
+	libraryListCmd.Flags().StringVarP(&libraryListOutput, "output", "o", "table", "output format: table or json")
+
+	libraryCmd.AddCommand(libraryShowCmd)
+
+	libraryCmd.AddCommand(libraryAddCmd)
+	libraryAddCmd.Flags().StringVar(&libraryAddConfig.Name, "name", "", "bundle name (default bundle file name)")
+	libraryAddCmd.Flags().StringVar(&libraryAddConfig.ClusterURL, "cluster", "", "cluster API URL the bundle was collected from")
+	libraryAddCmd.Flags().StringVar(&libraryAddConfig.IssueURL, "issue", "", "issue URL")
+	libraryAddCmd.Flags().StringVar(&libraryAddConfig.Description, "description", "", "issue description")
+	libraryAddCmd.Flags().StringSliceVar(&libraryAddTags, "tag", nil, "tag (can be repeated)")
+
+	libraryCmd.AddCommand(libraryTagCmd)
+	libraryTagCmd.Flags().BoolVar(&libraryTagRemove, "remove", false, "remove the tags instead of adding them")
+
+	libraryCmd.AddCommand(libraryPruneCmd)
+	libraryPruneFilter.addFlags(libraryPruneCmd)
+	libraryPruneCmd.Flags().DurationVar(&libraryPruneFilter.OlderThan, "older-than", 0, "only bundles collected longer ago than this, e.g., 720h")
+	libraryPruneCmd.Flags().BoolVar(&libraryPruneFilter.Missing, "missing", false, "only bundles whose file no longer exists")
+	libraryPruneCmd.Flags().BoolVar(&libraryPruneDeleteFiles, "delete-files", false, "also delete the bundle files")
+	libraryPruneCmd.Flags().BoolVar(&libraryPruneDryRun, "dry-run", false, "only print what would be removed")
+}
+
+func (f *libraryFilter) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.Cluster, "cluster", "", "only bundles from clusters whose URL contains this")
+	cmd.Flags().StringVar(&f.Issue, "issue", "", "only bundles for this issue URL")
+	cmd.Flags().StringVar(&f.Tag, "tag", "", "only bundles with this tag")
+}
+
+func (f *libraryFilter) empty() bool {
+	return *f == libraryFilter{}
+}
+
+func (f *libraryFilter) match(e *library.Entry) bool {
+	if f.Cluster != "" && !strings.Contains(e.ClusterURL, f.Cluster) {
+		return false
+	}
+	if f.Issue != "" && e.IssueURL != f.Issue {
+		return false
+	}
+	if f.Tag != "" && !e.HasTag(f.Tag) {
+		return false
+	}
+	if f.OlderThan > 0 && time.Since(e.CreatedAt) < f.OlderThan {
+		return false
+	}
+	if f.Missing {
+		if _, err := os.Stat(e.Path); !os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// openLibrary opens the library at the --library path, the "library" config
+// key or the default path, in this order.
+func openLibrary() (*library.Library, error) {
+	path := libraryPath
+	if path == "" {
+		path = viper.GetString("library")
+	}
+	if path == "" {
+		var err error
+		if path, err = library.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+	return library.New(path), nil
+}
+
+func runLibraryList() error {
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	entries, err := lib.List()
+	if err != nil {
+		return err
+	}
+	var matched []*library.Entry
+	for _, e := range entries {
+		if libraryListFilter.match(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	switch libraryListOutput {
+	case "json":
+		return printJSON(matched)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCLUSTER\tSIZE\tCOLLECTED\tTAGS\tISSUE")
+		for _, e := range matched {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Name, e.ClusterURL, utils.FormatSize(e.Size),
+				e.CreatedAt.Local().Format("2006-01-02 15:04"), strings.Join(e.Tags, ","), e.IssueURL)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown output format %q", libraryListOutput)
+}
+
+func runLibraryShow(ref string) error {
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	e, err := lib.Get(ref)
+	if err != nil {
+		return err
+	}
+	return printJSON(e)
+}
+
+func runLibraryAdd(path string) error {
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	e, err := library.NewEntry(libraryAddConfig.Name, path)
+	if err != nil {
+		return err
+	}
+	e.ClusterURL = libraryAddConfig.ClusterURL
+	e.IssueURL = libraryAddConfig.IssueURL
+	e.Description = libraryAddConfig.Description
+	e.Tags = libraryAddTags
+	if err := lib.Add(e); err != nil {
+		return err
+	}
+	fmt.Printf("bundle %s is added as %s\n", e.Name, e.ID)
+	return nil
+}
+
+func runLibraryTag(ref string, tags []string) error {
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	e, err := lib.Tag(ref, tags, libraryTagRemove)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bundle %s tags: %s\n", e.ID, strings.Join(e.Tags, ","))
+	return nil
+}
+
+func runLibraryPrune() error {
+	if libraryPruneFilter.empty() {
+		return errors.New("at least one filter is required, e.g., --older-than 720h")
+	}
+	lib, err := openLibrary()
+	if err != nil {
+		return err
+	}
+
+	var removed []*library.Entry
+	if libraryPruneDryRun {
+		entries, err := lib.List()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if libraryPruneFilter.match(e) {
+				removed = append(removed, e)
+			}
+		}
+	} else {
+		// The entries are removed even if deleting some of their files
+		// failed, that error is returned once they're listed.
+		removed, err = lib.Remove(libraryPruneFilter.match, libraryPruneDeleteFiles)
+		if err != nil && len(removed) == 0 {
+			return err
+		}
+	}
+
+	for _, e := range removed {
+		fmt.Printf("%s %s %s\n", e.ID, e.Name, e.Path)
+	}
+	verb := "removed"
+	if libraryPruneDryRun {
+		verb = "would be removed"
+	}
+	fmt.Printf("%d bundle(s) %s\n", len(removed), verb)
+	return err
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/upload"
+	"github.com/spf13/cobra"
+)
+
+const uploadTokenEnv = "SUPPORT_BUNDLE_UPLOAD_TOKEN"
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push [bundle] [server_url]",
+	Short: "Upload a support bundle to a bundle server",
+	Long: `Upload a support bundle to a bundle server started with "serve --upload-tokens".
+
+The bundle is sent in chunks and verified with its sha256 checksum on the
+server. Running the same push again after an interruption resumes from the
+last chunk the server received.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runPush(args[0], args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to push support bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(2),
+}
+
+var (
+	pushToken     string
+	pushChunkSize string
+	pushRetries   int
+	pushInsecure  bool
+)
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+	pushCmd.PersistentFlags().StringVar(&pushToken, "token", "", "upload token (default $"+uploadTokenEnv+")")
+	pushCmd.PersistentFlags().StringVar(&pushChunkSize, "chunk-size", "8M", "size of each uploaded chunk")
+	pushCmd.PersistentFlags().IntVar(&pushRetries, "retries", 5, "number of retries of a failed chunk")
+	pushCmd.PersistentFlags().BoolVarP(&pushInsecure, "insecure", "k", false, "skip TLS verification")
+}
+
+func runPush(path, serverURL string) error {
+	token := pushToken
+	if token == "" {
+		token = os.Getenv(uploadTokenEnv)
+	}
+	if token == "" {
+		return errors.New("an upload token is required, set --token or $" + uploadTokenEnv)
+	}
+	chunkSize, err := utils.ParseSize(pushChunkSize)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	c := upload.NewClient(serverURL, token, pushInsecure)
+	c.ChunkSize = chunkSize
+	c.Retries = pushRetries
+	c.Progress = func(sent, total int64) {
+		fmt.Fprintf(os.Stderr, "\ruploading %s / %s", utils.FormatSize(sent), utils.FormatSize(total))
+	}
+	s, err := c.Push(ctx, path)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bundle is uploaded to %s (sha256 %s)\n", s.Location, s.SHA256)
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/bk201/support-bundle-utils/pkg/replay"
+	"github.com/spf13/cobra"
+)
+
+// replayAPICmd represents the replay-api command
+var replayAPICmd = &cobra.Command{
+	Use:   "replay-api [bundle]",
+	Short: "Serve the Kubernetes resources in a bundle as a read-only API server",
+	Long: `Serve the Kubernetes resources in a bundle as a read-only Kubernetes API server.
+
+The server supports discovery, get and list with label and field selectors and
+table output, so kubectl and other read-only tools work against the snapshot:
+
+  support-bundle-utils replay-api supportbundle.zip --kubeconfig replay.kubeconfig
+  kubectl --kubeconfig replay.kubeconfig get vm -A
+
+It uses a self-signed certificate and a random token, both written to the
+kubeconfig, which is valid as long as the server runs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runReplayAPI(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to serve bundle API: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var (
+	replayAPIListen     string
+	replayAPIKubeconfig string
+)
+
+func init() {
+	rootCmd.AddCommand(replayAPICmd)
+	replayAPICmd.PersistentFlags().StringVar(&replayAPIListen, "listen", "127.0.0.1:6443", "address to listen on")
+	replayAPICmd.PersistentFlags().StringVar(&replayAPIKubeconfig, "kubeconfig", "replay.kubeconfig", "path to write the kubeconfig to")
+	replayAPICmd.PersistentFlags().BoolVar(&resourcesShowErrors, "show-errors", false, "print the files that could not be parsed")
+}
+
+func runReplayAPI(bundle string) error {
+	idx, err := loadResources(bundle)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", replayAPIListen)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return err
+	}
+	hosts := []string{"127.0.0.1", "localhost", "::1"}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	} else {
+		hosts = append(hosts, host)
+	}
+
+	s, err := replay.New(idx, hosts)
+	if err != nil {
+		return err
+	}
+	serverURL := "https://" + net.JoinHostPort(host, port)
+	if err := s.WriteKubeconfig(replayAPIKubeconfig, serverURL); err != nil {
+		return err
+	}
+	fmt.Printf("serving %d resource types from %s on %s\n", len(idx.Types()), bundle, serverURL)
+	fmt.Printf("kubeconfig is written to %s, e.g., kubectl --kubeconfig %s get vm -A\n", replayAPIKubeconfig, replayAPIKubeconfig)
+	return s.Serve(l)
+}
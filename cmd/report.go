@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Analyze a support bundle",
+	Long: `Analyze a support bundle and report the problems found in it.
+
+Reports accept a bundle zip or an extracted bundle directory.`,
+}
+
+var reportVMsCmd = &cobra.Command{
+	Use:   "vms [bundle]",
+	Short: "Report the health of the VMs in a bundle",
+	Long: `Report the health of the VMs in a bundle.
+
+VMs are correlated with their instances, launcher pods, PVCs, Longhorn volumes
+and nodes, and inconsistencies are flagged, e.g., an instance running on a node
+that is NotReady or a degraded volume.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runReportVMs(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to report VMs: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var reportLonghornCmd = &cobra.Command{
+	Use:   "longhorn [bundle]",
+	Short: "Report the health of the Longhorn volumes, replicas and disks in a bundle",
+	Long: `Report the health of the Longhorn volumes, replicas and disks in a bundle.
+
+Volumes are reported with their robustness, replica placement, rebuilds and
+the PVC and VM using them. Disks are checked for pressure and
+over-provisioning, and the Longhorn logs are scanned for rebuild failures.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runReportLonghorn(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to report Longhorn health: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var reportNodesCmd = &cobra.Command{
+	Use:   "nodes [bundle]",
+	Short: "Report the problems found in the node logs of a bundle",
+	Long: `Report the problems found in the node logs of a bundle.
+
+The logs collected from every node are scanned for OOM kills, kernel panics
+and oopses, disk I/O errors, NIC link flaps, read-only remounts, clock jumps,
+reboots and k3s restarts. Each is reported with a count and the first and last
+time it was seen. Reboots and k3s restarts alone are not reported as problems.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runReportNodes(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to report node logs: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var reportHTMLCmd = &cobra.Command{
+	Use:   "html [bundle]",
+	Short: "Write a self-contained HTML report of a bundle",
+	Long: `Write a self-contained HTML report of a bundle.
+
+The report is a single HTML file without external assets, suitable for
+attaching to a ticket. It has a cluster overview, the findings of the VM,
+Longhorn and nodes reports, node, VM and volume health, and charts of the
+error log lines and warning events over time.
+
+The issue URL and description are taken from the SupportBundle resource in the
+bundle unless --issue or --description is set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runReportHTML(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to write HTML report: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var (
+	reportOutput       string
+	reportProblemsOnly bool
+	reportNamespace    string
+	reportVMsEvents    int
+	reportHTMLFile     string
+	reportHTMLOptions  report.HTMLOptions
+)
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.PersistentFlags().StringVarP(&reportOutput, "output", "o", "table", "output format: table or json")
+	reportCmd.PersistentFlags().BoolVar(&reportProblemsOnly, "problems-only", false, "only report objects with issues")
+	reportCmd.PersistentFlags().BoolVar(&resourcesShowErrors, "show-errors", false, "print the files that could not be parsed")
+
+	reportCmd.AddCommand(reportVMsCmd)
+	reportVMsCmd.Flags().StringVarP(&reportNamespace, "namespace", "n", "", "only VMs in this namespace")
+	reportVMsCmd.Flags().IntVar(&reportVMsEvents, "events", 3, "number of recent events to report per VM")
+
+	reportCmd.AddCommand(reportLonghornCmd)
+
+	reportCmd.AddCommand(reportNodesCmd)
+
+	reportCmd.AddCommand(reportHTMLCmd)
+	reportHTMLCmd.Flags().StringVarP(&reportHTMLFile, "file", "f", "", "HTML file path, - for stdout (default ${bundle}.html)")
+	reportHTMLCmd.Flags().StringVar(&reportHTMLOptions.Title, "title", "", "report title (default the bundle name)")
+	reportHTMLCmd.Flags().StringVar(&reportHTMLOptions.IssueURL, "issue", "", "issue URL")
+	reportHTMLCmd.Flags().StringVar(&reportHTMLOptions.Description, "description", "", "issue description")
+}
+
+func runReportVMs(bundle string) error {
+	idx, err := loadResources(bundle)
+	if err != nil {
+		return err
+	}
+	var vms []*report.VMReport
+	for _, vm := range report.VMs(idx, report.VMOptions{Events: reportVMsEvents}) {
+		if reportNamespace != "" && vm.Namespace != reportNamespace {
+			continue
+		}
+		if reportProblemsOnly && len(vm.Issues) == 0 {
+			continue
+		}
+		vms = append(vms, vm)
+	}
+
+	switch reportOutput {
+	case "json":
+		return printJSON(vms)
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %q", reportOutput)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tSTATUS\tNODE\tVOLUMES\tROBUSTNESS\tISSUES")
+	for _, vm := range vms {
+		var volumes, robustness []string
+		for _, v := range vm.Volumes {
+			volumes = append(volumes, v.PVC)
+			robustness = append(robustness, orNone(v.Robustness))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", vm.Namespace, vm.Name, orNone(vm.Status), orNone(vm.Node),
+			orNone(strings.Join(volumes, ",")), orNone(strings.Join(robustness, ",")), len(vm.Issues))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, vm := range vms {
+		if len(vm.Issues) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s/%s:\n", vm.Namespace, vm.Name)
+		for _, issue := range vm.Issues {
+			fmt.Printf("  ! %s\n", issue)
+		}
+		for _, e := range vm.Events {
+			fmt.Printf("  %s %s %s %s: %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Type, e.Object, e.Reason, e.Message)
+		}
+	}
+	return nil
+}
+
+func runReportLonghorn(bundle string) error {
+	idx, err := loadResources(bundle)
+	if err != nil {
+		return err
+	}
+	lh, err := report.Longhorn(idx, bundle)
+	if err != nil {
+		return err
+	}
+	if reportProblemsOnly {
+		var volumes []*report.LonghornVolume
+		for _, v := range lh.Volumes {
+			if len(v.Issues) > 0 {
+				volumes = append(volumes, v)
+			}
+		}
+		var nodes []*report.LonghornNode
+		for _, n := range lh.Nodes {
+			if len(n.Issues) > 0 {
+				nodes = append(nodes, n)
+			}
+		}
+		lh.Volumes, lh.Nodes = volumes, nodes
+	}
+
+	switch reportOutput {
+	case "json":
+		return printJSON(lh)
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %q", reportOutput)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VOLUME\tSTATE\tROBUSTNESS\tSIZE\tREPLICAS\tNODE\tPVC\tVM\tISSUES")
+	for _, v := range lh.Volumes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d\t%s\t%s\t%s\t%d\n", v.Name, orNone(v.State), orNone(v.Robustness),
+			utils.FormatSize(v.Size), v.HealthyReplicas, v.DesiredReplicas, orNone(v.AttachedNode), orNone(v.PVC), orNone(v.VM), len(v.Issues))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "NODE\tREADY\tDISK\tAVAILABLE\tMAXIMUM\tSCHEDULED\tREPLICAS\tSCHEDULABLE")
+	for _, n := range lh.Nodes {
+		for _, d := range n.Disks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", n.Name, orNone(n.Ready), d.Path, utils.FormatSize(d.Available),
+				utils.FormatSize(d.Maximum), utils.FormatSize(d.Scheduled), d.Replicas, orNone(d.Schedulable))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, v := range lh.Volumes {
+		if len(v.Issues) == 0 {
+			continue
+		}
+		fmt.Printf("\nvolume %s:\n", v.Name)
+		for _, issue := range v.Issues {
+			fmt.Printf("  ! %s\n", issue)
+		}
+		for _, r := range v.Replicas {
+			fmt.Printf("  replica %s on %s disk %s: %s %s\n", r.Name, r.Node, orNone(r.Disk), orNone(r.State), orNone(r.Mode))
+		}
+		for _, r := range v.Rebuilds {
+			fmt.Printf("  rebuilding %s: %d%% %s\n", r.Replica, r.Progress, r.Error)
+		}
+		if v.LogRebuild.Lines > 0 {
+			fmt.Printf("  %d rebuild log line(s), last: %s\n", v.LogRebuild.Lines, v.LogRebuild.LastMessage)
+		}
+	}
+	for _, n := range lh.Nodes {
+		if len(n.Issues) == 0 {
+			continue
+		}
+		fmt.Printf("\nnode %s:\n", n.Name)
+		for _, issue := range n.Issues {
+			fmt.Printf("  ! %s\n", issue)
+		}
+	}
+	return nil
+}
+
+func runReportNodes(bundle string) error {
+	idx, err := loadResources(bundle)
+	if err != nil {
+		return err
+	}
+	reports, err := report.Nodes(bundle, idx.CollectedAt)
+	if err != nil {
+		return err
+	}
+	var nodes []*report.NodeReport
+	for _, n := range reports {
+		if reportProblemsOnly && n.Problems() == 0 {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+
+	switch reportOutput {
+	case "json":
+		return printJSON(nodes)
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %q", reportOutput)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	headers := []string{"NODE", "FILES"}
+	for _, f := range report.NodeFindings {
+		headers = append(headers, strings.ToUpper(string(f)))
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, n := range nodes {
+		row := []string{n.Name, fmt.Sprint(n.Files)}
+		for _, f := range report.NodeFindings {
+			count := 0
+			if stat := n.Findings[f]; stat != nil {
+				count = stat.Count
+			}
+			row = append(row, fmt.Sprint(count))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if len(n.Findings) == 0 {
+			continue
+		}
+		fmt.Printf("\nnode %s:\n", n.Name)
+		for _, f := range report.NodeFindings {
+			stat := n.Findings[f]
+			if stat == nil {
+				continue
+			}
+			fmt.Printf("  %s: %d, first %s, last %s\n", f, stat.Count, formatLogTime(stat.First), formatLogTime(stat.Last))
+			fmt.Printf("    %s\n", stat.Example)
+		}
+	}
+	return nil
+}
+
+func runReportHTML(bundle string) error {
+	idx, err := loadResources(bundle)
+	if err != nil {
+		return err
+	}
+	r, err := report.HTML(idx, bundle, reportHTMLOptions)
+	if err != nil {
+		return err
+	}
+	if reportHTMLFile == "-" {
+		return r.Render(os.Stdout)
+	}
+
+	path := reportHTMLFile
+	if path == "" {
+		path = strings.TrimSuffix(strings.TrimSuffix(bundle, "/"), ".zip") + ".html"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Render(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("report is saved to %s\n", path)
+	return nil
+}
+
+func formatLogTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
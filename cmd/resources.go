@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// resourcesCmd represents the resources command
+var resourcesCmd = &cobra.Command{
+	Use:   "resources",
+	Short: "Query the Kubernetes resources in a support bundle",
+	Long: `Query the Kubernetes resources in a support bundle, like a read-only offline kubectl.
+
+The YAML files in a bundle zip or an extracted bundle directory are indexed by
+type, namespace and name. Resource types are named as in kubectl, e.g., vm,
+virtualmachines or virtualmachines.kubevirt.io.`,
+}
+
+var resourcesTypesCmd = &cobra.Command{
+	Use:     "types [bundle]",
+	Aliases: []string{"api-resources"},
+	Short:   "List the resource types in a bundle",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runResourcesTypes(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to list resource types: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var resourcesGetCmd = &cobra.Command{
+	Use:   "get [bundle] [type] [name]...",
+	Short: "List or get resources in a bundle",
+	Long: `List or get resources in a bundle.
+
+Objects can be filtered by label selectors (-l) and by field queries (--where),
+which compare the values a JSONPath selects, e.g.:
+
+  resources get bundle.zip vm -A --where status.printableStatus!=Running
+  resources get bundle.zip pods -n harvester-system -l app=harvester -o wide
+  resources get bundle.zip nodes -o jsonpath='{.items[*].status.nodeInfo.kubeletVersion}'
+  resources get bundle.zip lhv -A -o custom-columns=NAME:.metadata.name,STATE:.status.state`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runResourcesGet(args[0], args[1], args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to get resources: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.MinimumNArgs(2),
+}
+
+var (
+	resourcesNamespace     string
+	resourcesAllNamespaces bool
+	resourcesSelector      string
+	resourcesWhere         []string
+	resourcesOutput        string
+	resourcesShowErrors    bool
+)
+
+func init() {
+	rootCmd.AddCommand(resourcesCmd)
+	resourcesCmd.PersistentFlags().BoolVar(&resourcesShowErrors, "show-errors", false, "print the files that could not be parsed")
+
+	resourcesCmd.AddCommand(resourcesTypesCmd)
+
+	resourcesCmd.AddCommand(resourcesGetCmd)
+	resourcesGetCmd.Flags().StringVarP(&resourcesNamespace, "namespace", "n", "default", "namespace of namespaced resources")
+	resourcesGetCmd.Flags().BoolVarP(&resourcesAllNamespaces, "all-namespaces", "A", false, "list resources in all namespaces")
+	resourcesGetCmd.Flags().StringVarP(&resourcesSelector, "selector", "l", "", "label selector, e.g., app=harvester,tier!=db")
+	resourcesGetCmd.Flags().StringSliceVar(&resourcesWhere, "where", nil, "field query, e.g., status.phase!=Running (can be repeated)")
+	resourcesGetCmd.Flags().StringVarP(&resourcesOutput, "output", "o", "", "output format: wide, yaml, json, name, jsonpath=TEMPLATE or custom-columns=SPEC")
+}
+
+func loadResources(bundle string) (*resources.Index, error) {
+	idx, err := resources.Load(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if resourcesShowErrors {
+		for _, err := range idx.Errors {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+		}
+	} else if len(idx.Errors) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d file(s) could not be parsed, see --show-errors\n", len(idx.Errors))
+	}
+	return idx, nil
+}
+
+func runResourcesTypes(bundle string) error {
+	idx, err := loadResources(bundle)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSHORTNAMES\tAPIVERSION\tNAMESPACED\tKIND\tCOUNT")
+	for _, t := range idx.Types() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%d\n", t.Resource, strings.Join(t.ShortNames, ","),
+			t.GroupVersion().String(), t.Namespaced, t.Kind, t.Count)
+	}
+	return w.Flush()
+}
+
+func runResourcesGet(bundle, typeName string, names []string) error {
+	opts := resources.ListOptions{}
+	if resourcesSelector != "" {
+		selector, err := labels.Parse(resourcesSelector)
+		if err != nil {
+			return err
+		}
+		opts.Selector = selector
+	}
+	for _, where := range resourcesWhere {
+		q, err := resources.ParseFieldQuery(where)
+		if err != nil {
+			return err
+		}
+		opts.Fields = append(opts.Fields, q)
+	}
+	if len(names) > 0 && (resourcesAllNamespaces || opts.Selector != nil || len(opts.Fields) > 0) {
+		return errors.New("names can't be used with -A, -l or --where")
+	}
+
+	idx, err := loadResources(bundle)
+	if err != nil {
+		return err
+	}
+	types, err := idx.ResolveType(typeName)
+	if err != nil {
+		return err
+	}
+	if len(types) > 1 {
+		var candidates []string
+		for _, t := range types {
+			candidates = append(candidates, t.GroupResource()+"/"+t.Version)
+		}
+		fmt.Fprintf(os.Stderr, "warning: %q matches %s, using %s\n", typeName, strings.Join(candidates, ", "), candidates[0])
+	}
+	t := types[0]
+	if t.Namespaced && !resourcesAllNamespaces {
+		opts.Namespace = resourcesNamespace
+	}
+
+	var objs []*unstructured.Unstructured
+	if len(names) > 0 {
+		for _, name := range names {
+			obj := idx.Get(t, opts.Namespace, name)
+			if obj == nil {
+				return fmt.Errorf("%s %q not found", t.GroupResource(), name)
+			}
+			objs = append(objs, obj)
+		}
+	} else if objs, err = idx.List(t, opts); err != nil {
+		return err
+	}
+
+	return printResources(idx, t, objs, len(names) == 1)
+}
+
+// printResources prints objects in the --output format. single is set when
+// one object is asked for by name, which is printed without a list.
+func printResources(idx *resources.Index, t *resources.Type, objs []*unstructured.Unstructured, single bool) error {
+	var data interface{}
+	if single {
+		data = objs[0].Object
+	} else {
+		items := make([]interface{}, 0, len(objs))
+		for _, obj := range objs {
+			items = append(items, obj.Object)
+		}
+		data = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      items,
+		}
+	}
+
+	switch {
+	case resourcesOutput == "yaml":
+		out, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	case resourcesOutput == "json":
+		return printJSON(data)
+	case resourcesOutput == "name":
+		for _, obj := range objs {
+			fmt.Printf("%s/%s\n", t.GroupResource(), obj.GetName())
+		}
+		return nil
+	case strings.HasPrefix(resourcesOutput, "jsonpath="):
+		jp, err := resources.ParseJSONPath(strings.TrimPrefix(resourcesOutput, "jsonpath="))
+		if err != nil {
+			return err
+		}
+		if err := jp.Execute(os.Stdout, data); err != nil {
+			return err
+		}
+		fmt.Println()
+		return nil
+	case strings.HasPrefix(resourcesOutput, "custom-columns="):
+		columns, err := resources.ParseColumns(strings.TrimPrefix(resourcesOutput, "custom-columns="))
+		if err != nil {
+			return err
+		}
+		return printTable(resources.NewCustomTable(columns, objs))
+	case resourcesOutput == "" || resourcesOutput == "wide":
+		if len(objs) == 0 {
+			fmt.Fprintln(os.Stderr, "No resources found")
+			return nil
+		}
+		withNamespace := t.Namespaced && resourcesAllNamespaces
+		return printTable(idx.NewTable(t, objs, withNamespace, resourcesOutput == "wide"))
+	}
+	return fmt.Errorf("unknown output format %q", resourcesOutput)
+}
+
+func printTable(table *resources.Table) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(w, strings.Join(table.Headers, "\t"))
+	for _, row := range table.Rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
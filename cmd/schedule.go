@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/schedule"
+	"github.com/spf13/cobra"
+)
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:     "schedule [api_url]",
+	Aliases: []string{"daemon"},
+	Short:   "Collect support bundles from a Harvester cluster on a schedule",
+	Long: `Collect support bundles from a Harvester cluster on a cron schedule, e.g., "0 */6 * * *"
+for every 6 hours, and keep them according to the retention options.
+
+Bundles are saved as ${prefix}-${timestamp}.zip in the output directory. The
+/healthz and /status endpoints report the last run when --listen is set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := prepareDownload(); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid download options: %s\n", err)
+			os.Exit(1)
+		}
+		if err := runSchedule(apiURL(args)); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to schedule support bundles: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.MaximumNArgs(1),
+}
+
+var (
+	scheduleConfig   = schedule.Scheduler{}
+	scheduleMaxTotal string
+	scheduleListen   string
+	scheduleRunNow   bool
+)
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	addDownloadFlags(scheduleCmd.PersistentFlags())
+	scheduleCmd.PersistentFlags().StringVar(&scheduleConfig.Spec, "cron", "0 */6 * * *", "cron expression, or a descriptor like @hourly or @every 2h")
+	scheduleCmd.PersistentFlags().StringVar(&scheduleConfig.OutputDir, "output-dir", ".", "directory to save bundles to")
+	scheduleCmd.PersistentFlags().StringVar(&scheduleConfig.Prefix, "prefix", "supportbundle", "bundle file name prefix")
+	scheduleCmd.PersistentFlags().IntVar(&scheduleConfig.Retention.Keep, "keep", 0, "keep at most this many bundles (default unlimited)")
+	scheduleCmd.PersistentFlags().DurationVar(&scheduleConfig.Retention.MaxAge, "max-age", 0, "remove bundles older than this, e.g., 168h (default unlimited)")
+	scheduleCmd.PersistentFlags().StringVar(&scheduleMaxTotal, "max-total", "", "remove the oldest bundles when all bundles take more than this, e.g., 20G (default unlimited)")
+	scheduleCmd.PersistentFlags().IntVar(&scheduleConfig.MaxFailures, "max-failures", 3, "report unhealthy after this many consecutive failures (0 to never)")
+	scheduleCmd.PersistentFlags().StringVar(&scheduleListen, "listen", "", "address to serve /healthz and /status on, e.g., :8080")
+	scheduleCmd.PersistentFlags().BoolVar(&scheduleRunNow, "run-now", false, "collect a bundle immediately at start")
+}
+
+func runSchedule(url string) error {
+	if scheduleMaxTotal != "" {
+		size, err := utils.ParseSize(scheduleMaxTotal)
+		if err != nil {
+			return err
+		}
+		scheduleConfig.Retention.MaxBytes = size
+	}
+	scheduleConfig.Job = func(ctx context.Context, output string) (string, error) {
+		c := cmdConfig
+		c.OutputFile = output
+		// Every run collects a new bundle, and doesn't leave it on the
+		// cluster.
+		c.Reuse = false
+		c.ReuseBundle = ""
+		c.Cleanup = true
+		if err := c.RunContext(ctx, url); err != nil {
+			return "", err
+		}
+		return c.Saved(), nil
+	}
+
+	scheduleConfig.Library = cmdConfig.Library
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := scheduleConfig.Start(ctx); err != nil {
+		return err
+	}
+
+	var server *http.Server
+	if scheduleListen != "" {
+		server = &http.Server{Addr: scheduleListen, Handler: scheduleConfig.Handler()}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("fail to serve status endpoint: %s", err)
+			}
+		}()
+	}
+
+	if scheduleRunNow {
+		go scheduleConfig.RunOnce()
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	log.Printf("received %s, waiting for the current run to finish, send it again to interrupt the run", sig)
+	go func() {
+		sig := <-sigs
+		log.Printf("received %s, interrupting the current run", sig)
+		cancel()
+	}()
+
+	scheduleConfig.Stop()
+	cancel()
+	if server != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		return server.Shutdown(shutdownCtx)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/server"
+	"github.com/bk201/support-bundle-utils/pkg/upload"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a directory of support bundles",
+	Long: `Serve a directory of support bundles over HTTP.
+
+Bundles and the node archives nested in them can be browsed in the browser:
+text and log files are shown with line numbers, YAML and JSON are highlighted,
+and every file can be searched or downloaded individually.
+
+With --upload-tokens the server also accepts bundle uploads, e.g., from the
+push command. The tokens file has one "<customer> <token>" pair per line and
+uploaded bundles are stored in a directory per customer.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runServe(); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to serve support bundles: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.NoArgs,
+}
+
+var (
+	serveDir     string
+	serveListen  string
+	serveTLSCert string
+	serveTLSKey  string
+
+	serveUploadTokens  string
+	serveStagingDir    string
+	serveMaxUploadSize string
+)
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.PersistentFlags().StringVar(&serveDir, "dir", ".", "directory holding the bundles")
+	serveCmd.PersistentFlags().StringVar(&serveListen, "listen", ":8080", "address to listen on")
+	serveCmd.PersistentFlags().StringVar(&serveTLSCert, "tls-cert", "", "TLS certificate file, serve HTTPS when set with --tls-key")
+	serveCmd.PersistentFlags().StringVar(&serveTLSKey, "tls-key", "", "TLS key file")
+	serveCmd.PersistentFlags().StringVar(&serveUploadTokens, "upload-tokens", "", "file of per-customer upload tokens, accept uploads when set")
+	serveCmd.PersistentFlags().StringVar(&serveStagingDir, "staging-dir", "", "directory for in-progress uploads, outside --dir (default ${dir}.uploads)")
+	serveCmd.PersistentFlags().StringVar(&serveMaxUploadSize, "max-upload-size", "10G", "maximum size of an uploaded bundle")
+}
+
+func runServe() error {
+	info, err := os.Stat(serveDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", serveDir)
+	}
+
+	s := server.New(serveDir)
+	if serveUploadTokens != "" {
+		tokens, err := upload.LoadTokens(serveUploadTokens)
+		if err != nil {
+			return err
+		}
+		maxSize, err := utils.ParseSize(serveMaxUploadSize)
+		if err != nil {
+			return err
+		}
+		if s.Receiver, err = upload.NewReceiver(serveDir, serveStagingDir, tokens, maxSize); err != nil {
+			return err
+		}
+		if serveTLSCert == "" {
+			fmt.Fprintln(os.Stderr, "warning: uploads are accepted over plain HTTP, tokens are sent in clear text")
+		}
+	}
+	fmt.Printf("serving bundles in %s on %s\n", serveDir, serveListen)
+	if serveTLSCert != "" || serveTLSKey != "" {
+		return http.ListenAndServeTLS(serveListen, serveTLSCert, serveTLSKey, s.Handler())
+	}
+	return http.ListenAndServe(serveListen, s.Handler())
+}
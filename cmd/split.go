@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/split"
+	"github.com/spf13/cobra"
+)
+
+// splitCmd represents the split command
+var splitCmd = &cobra.Command{
+	Use:   "split [bundle]",
+	Short: "Split a support bundle into size-limited parts",
+	Long: `Split a support bundle into size-limited parts, e.g., to fit attachment limits.
+
+Parts are named ${bundle}.part001, ${bundle}.part002, ... and an index file
+${bundle}.index.json records the checksum of every part. Use the join command
+to reassemble them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runSplit(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to split support bundle: %s\n", err)
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+// joinCmd represents the join command
+var joinCmd = &cobra.Command{
+	Use:   "join [index_file]",
+	Short: "Reassemble a support bundle from its parts",
+	Long:  "Reassemble a support bundle from its parts. Every part is verified against the index before joining.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runJoin(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "fail to join support bundle: %s\n", err)
+			if os.IsExist(err) {
+				fmt.Fprintln(os.Stderr, "use --force to overwrite it or --output to join the bundle somewhere else")
+			}
+			os.Exit(1)
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+var (
+	splitSize      string
+	splitOutputDir string
+	joinOutput     string
+	joinForce      bool
+)
+
+func init() {
+	rootCmd.AddCommand(splitCmd)
+	splitCmd.PersistentFlags().StringVar(&splitSize, "size", "200M", "maximum size of each part, e.g., 200M or 1G")
+	splitCmd.PersistentFlags().StringVar(&splitOutputDir, "output-dir", "", "directory to write parts to (default the bundle directory)")
+
+	rootCmd.AddCommand(joinCmd)
+	joinCmd.PersistentFlags().StringVar(&joinOutput, "output", "", "output file path (default the original bundle name next to the index)")
+	joinCmd.PersistentFlags().BoolVar(&joinForce, "force", false, "overwrite an existing bundle file")
+}
+
+func runSplit(path string) error {
+	size, err := utils.ParseSize(splitSize)
+	if err != nil {
+		return err
+	}
+	dir := splitOutputDir
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+
+	indexPath, err := split.Split(path, dir, size)
+	if err != nil {
+		return err
+	}
+	idx, err := split.ReadIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bundle is split into %d part(s), index is saved to %s\n", len(idx.Parts), indexPath)
+	return nil
+}
+
+func runJoin(indexPath string) error {
+	idx, err := split.Join(indexPath, joinOutput, joinForce)
+	if err != nil {
+		return err
+	}
+	output := joinOutput
+	if output == "" {
+		output = filepath.Join(filepath.Dir(indexPath), idx.Name)
+	}
+	fmt.Printf("bundle is joined to %s (%d part(s) verified)\n", output, len(idx.Parts))
+	return nil
+}
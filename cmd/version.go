@@ -2,13 +2,18 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"text/tabwriter"
 
+	"github.com/bk201/support-bundle-utils/pkg/client"
 	"github.com/spf13/cobra"
 )
 
 var (
 	AppVersion = "dev"
 	GitCommit  = "commit"
+
+	versionCompat bool
 )
 
 // versionCmd represents the version command
@@ -18,9 +23,26 @@ var versionCmd = &cobra.Command{
 	Long:  "Get application version",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Printf("%s (%s)\n", AppVersion, GitCommit)
+		if versionCompat {
+			printCompatibilities()
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().BoolVar(&versionCompat, "compat", false, "also print the Harvester versions this client supports")
+}
+
+func printCompatibilities() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nHARVESTER\tTESTED UP TO\tAUTH\tBUNDLE API")
+	for i, c := range client.Compatibilities {
+		versions := ">= " + c.MinVersion
+		if i+1 < len(client.Compatibilities) {
+			versions += ", < " + client.Compatibilities[i+1].MinVersion
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", versions, c.Tested, c.Auth, c.Bundles)
+	}
+	w.Flush()
 }
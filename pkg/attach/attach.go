@@ -0,0 +1,194 @@
+package attach
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+const (
+	TrackerGitHub  = "github"
+	TrackerGitLab  = "gitlab"
+	TrackerWebhook = "webhook"
+
+	// MaxHighlights is the number of analysis findings put in a summary.
+	MaxHighlights = 10
+)
+
+// Summary describes a downloaded bundle for an issue comment.
+type Summary struct {
+	Name        string    `json:"name"`
+	File        string    `json:"file"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	IssueURL    string    `json:"issueURL"`
+	Description string    `json:"description"`
+	Highlights  []string  `json:"highlights,omitempty"`
+	BundleURL   string    `json:"bundleURL,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	// ServerVersion is the Harvester version of the cluster, if detected.
+	ServerVersion string `json:"serverVersion,omitempty"`
+}
+
+// NewSummary computes the size and checksum of the bundle at path.
+func NewSummary(name, path string) (*Summary, error) {
+	sum, size, err := utils.SHA256File(path)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), ".zip")
+	}
+	return &Summary{
+		Name:      name,
+		File:      filepath.Base(path),
+		Size:      size,
+		SHA256:    sum,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Markdown renders the summary as an issue comment. link is the markdown to
+// reach the bundle, e.g., an uploaded file reference, and may be empty.
+func (s *Summary) Markdown(link string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Support bundle `%s`\n\n", s.Name)
+	fmt.Fprintf(&b, "| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| File | `%s` |\n", s.File)
+	fmt.Fprintf(&b, "| Size | %s |\n", utils.FormatSize(s.Size))
+	fmt.Fprintf(&b, "| SHA-256 | `%s` |\n", s.SHA256)
+	if s.Description != "" {
+		fmt.Fprintf(&b, "| Description | %s |\n", tableCell(s.Description))
+	}
+	if s.ServerVersion != "" {
+		fmt.Fprintf(&b, "| Harvester version | %s |\n", tableCell(s.ServerVersion))
+	}
+	fmt.Fprintf(&b, "| Collected at | %s |\n", s.CreatedAt.Format(time.RFC3339))
+
+	if len(s.Highlights) > 0 {
+		fmt.Fprintf(&b, "\n**Analysis highlights**\n\n")
+		for _, h := range s.Highlights {
+			fmt.Fprintf(&b, "- %s\n", h)
+		}
+	}
+
+	switch {
+	case link != "":
+		fmt.Fprintf(&b, "\nBundle: %s\n", link)
+	case s.BundleURL != "":
+		fmt.Fprintf(&b, "\nBundle: %s\n", s.BundleURL)
+	default:
+		fmt.Fprintf(&b, "\nThe bundle is not uploaded, please ask the reporter for `%s`.\n", s.File)
+	}
+	return b.String()
+}
+
+// tableCell escapes s for a cell of a Markdown table, which ends at a line
+// break or an unescaped pipe.
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", " ")
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// A Tracker posts a bundle summary to an issue.
+type Tracker interface {
+	// Attach comments on the issue and, if the tracker supports it and
+	// upload is requested, uploads the bundle at path. It returns a URL
+	// pointing to the comment when the tracker provides one.
+	Attach(ctx context.Context, summary *Summary, path string) (string, error)
+}
+
+type Options struct {
+	// Tracker forces the tracker type. It is detected from IssueURL if empty.
+	Tracker  string
+	IssueURL string
+	Token    string
+	// APIURL overrides the tracker API endpoint, e.g., for GitHub Enterprise.
+	APIURL string
+	// WebhookURL receives the summary as JSON for trackers without a
+	// dedicated integration. It takes precedence over the issue URL.
+	WebhookURL string
+	// WebhookToken is sent as a bearer token to the webhook. The issue
+	// tracker Token is never sent there.
+	WebhookToken string
+	// Upload uploads the bundle when the tracker supports attachments.
+	Upload   bool
+	Insecure bool
+}
+
+// NewTracker returns the tracker matching the options.
+func NewTracker(opts Options) (Tracker, error) {
+	kind := opts.Tracker
+	if kind == "" {
+		kind = detect(opts)
+	}
+
+	// Uploads can take long, requests are bounded by the context instead.
+	httpClient := utils.NewHTTPClient(0, opts.Insecure)
+	switch kind {
+	case TrackerGitHub:
+		return newGitHub(opts, httpClient)
+	case TrackerGitLab:
+		return newGitLab(opts, httpClient)
+	case TrackerWebhook:
+		if opts.WebhookURL == "" {
+			return nil, errors.New("webhook URL is required")
+		}
+		return &webhook{url: opts.WebhookURL, token: opts.WebhookToken, httpClient: httpClient}, nil
+	case "":
+		return nil, fmt.Errorf("unable to detect issue tracker from %q, please specify a webhook URL", opts.IssueURL)
+	}
+	return nil, fmt.Errorf("unsupported issue tracker %q", kind)
+}
+
+func detect(opts Options) string {
+	if opts.WebhookURL != "" {
+		return TrackerWebhook
+	}
+	u, err := url.Parse(opts.IssueURL)
+	if err == nil {
+		switch {
+		case u.Host == "github.com":
+			return TrackerGitHub
+		case strings.Contains(u.Host, "gitlab") || strings.Contains(u.Path, "/-/issues/"):
+			return TrackerGitLab
+		}
+	}
+	return ""
+}
+
+func doRequest(ctx context.Context, httpClient *http.Client, method, url string, header http.Header, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status: %s. Body: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return respBody, nil
+}
@@ -0,0 +1,234 @@
+package attach
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request is what a tracker stand-in received.
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newTracker starts a stand-in that records the requests and answers with
+// the response of their path.
+func newTracker(t *testing.T, responses map[string]string) (*httptest.Server, *[]request) {
+	t.Helper()
+	var got []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, request{r.Method, r.URL.EscapedPath(), r.Header, body})
+		resp, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(resp))
+	}))
+	return ts, &got
+}
+
+func testSummary(t *testing.T) (*Summary, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "attach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "bundle-x7k2q.zip")
+	if err := ioutil.WriteFile(path, []byte("bundle"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := NewSummary("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary.Description = "VM | stuck"
+	summary.Highlights = []string{"error: vm default/vm1: instance runs on NotReady node"}
+	return summary, path
+}
+
+func TestGitHub(t *testing.T) {
+	ts, got := newTracker(t, map[string]string{
+		"/repos/harvester/harvester/issues/1234/comments": `{"html_url":"https://github.com/harvester/harvester/issues/1234#issuecomment-1"}`,
+	})
+	defer ts.Close()
+
+	tracker, err := NewTracker(Options{IssueURL: "https://github.com/harvester/harvester/issues/1234", Token: "secret", APIURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, path := testSummary(t)
+	link, err := tracker.Attach(context.Background(), summary, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "https://github.com/harvester/harvester/issues/1234#issuecomment-1" {
+		t.Errorf("got link %q", link)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*got))
+	}
+	r := (*got)[0]
+	if r.method != http.MethodPost || r.header.Get("Authorization") != "token secret" {
+		t.Errorf("got %s with authorization %q", r.method, r.header.Get("Authorization"))
+	}
+	var comment struct {
+		Body string `json:"body"`
+	}
+	if err := json.Unmarshal(r.body, &comment); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"`bundle-x7k2q`", summary.SHA256, "instance runs on NotReady node", `VM \| stuck`} {
+		if !strings.Contains(comment.Body, want) {
+			t.Errorf("comment lacks %q:\n%s", want, comment.Body)
+		}
+	}
+}
+
+func TestGitLab(t *testing.T) {
+	ts, got := newTracker(t, map[string]string{
+		"/api/v4/projects/group%2Fproject/uploads":        `{"markdown":"[bundle-x7k2q.zip](/uploads/abc/bundle-x7k2q.zip)"}`,
+		"/api/v4/projects/group%2Fproject/issues/7/notes": `{"id":42}`,
+	})
+	defer ts.Close()
+
+	issueURL := ts.URL + "/group/project/-/issues/7"
+	tracker, err := NewTracker(Options{Tracker: TrackerGitLab, IssueURL: issueURL, Token: "secret", Upload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, path := testSummary(t)
+	link, err := tracker.Attach(context.Background(), summary, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != issueURL+"#note_42" {
+		t.Errorf("got link %q", link)
+	}
+	if len(*got) != 2 {
+		t.Fatalf("got %d requests, want the upload and the note", len(*got))
+	}
+	upload, note := (*got)[0], (*got)[1]
+	for _, r := range *got {
+		if r.header.Get("PRIVATE-TOKEN") != "secret" {
+			t.Errorf("%s got token %q", r.path, r.header.Get("PRIVATE-TOKEN"))
+		}
+	}
+	if !strings.HasPrefix(upload.header.Get("Content-Type"), "multipart/form-data") || !strings.Contains(string(upload.body), "bundle") {
+		t.Errorf("got upload %s: %s", upload.header.Get("Content-Type"), upload.body)
+	}
+	if !strings.Contains(string(note.body), "/uploads/abc/bundle-x7k2q.zip") {
+		t.Errorf("note doesn't link the upload: %s", note.body)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	ts, got := newTracker(t, map[string]string{"/hook": `{}`})
+	defer ts.Close()
+
+	// The webhook takes precedence over the issue, and doesn't get the
+	// issue token.
+	tracker, err := NewTracker(Options{
+		IssueURL:     "https://github.com/harvester/harvester/issues/1234",
+		Token:        "issue-secret",
+		WebhookURL:   ts.URL + "/hook",
+		WebhookToken: "hook-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, path := testSummary(t)
+	if _, err := tracker.Attach(context.Background(), summary, path); err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*got))
+	}
+	r := (*got)[0]
+	if auth := r.header.Get("Authorization"); auth != "Bearer hook-secret" {
+		t.Errorf("got authorization %q", auth)
+	}
+	var payload struct {
+		Name       string   `json:"name"`
+		SHA256     string   `json:"sha256"`
+		Highlights []string `json:"highlights"`
+		Comment    string   `json:"comment"`
+	}
+	if err := json.Unmarshal(r.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Name != "bundle-x7k2q" || payload.SHA256 != summary.SHA256 || len(payload.Highlights) != 1 || payload.Comment == "" {
+		t.Errorf("got payload %+v", payload)
+	}
+}
+
+func TestAttachError(t *testing.T) {
+	ts, _ := newTracker(t, nil)
+	defer ts.Close()
+
+	tracker, err := NewTracker(Options{WebhookURL: ts.URL + "/missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, path := testSummary(t)
+	_, err = tracker.Attach(context.Background(), summary, path)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got error %v, want the status", err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{IssueURL: "https://github.com/harvester/harvester/issues/1"}, TrackerGitHub},
+		{Options{IssueURL: "https://gitlab.com/group/project/-/issues/1"}, TrackerGitLab},
+		{Options{IssueURL: "https://git.example.com/group/project/-/issues/1"}, TrackerGitLab},
+		{Options{IssueURL: "https://github.com/harvester/harvester/issues/1", WebhookURL: "https://relay.example.com"}, TrackerWebhook},
+		{Options{IssueURL: "https://jira.example.com/browse/HAR-1"}, ""},
+	}
+	for _, tt := range tests {
+		if got := detect(tt.opts); got != tt.want {
+			t.Errorf("detect(%+v) = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	s := &Summary{
+		Name:          "bundle-x7k2q",
+		File:          "bundle-x7k2q.zip",
+		Size:          2048,
+		SHA256:        "abc",
+		Description:   "disk | full\nafter upgrade",
+		ServerVersion: "v1.2.0",
+		CreatedAt:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+	md := s.Markdown("")
+	for _, want := range []string{
+		"| Description | disk \\| full after upgrade |\n",
+		"| Harvester version | v1.2.0 |\n",
+		"| Size | 2.0 KiB |\n",
+		"please ask the reporter for `bundle-x7k2q.zip`",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "Analysis highlights") {
+		t.Error("markdown has highlights without any")
+	}
+}
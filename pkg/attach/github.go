@@ -0,0 +1,77 @@
+package attach
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type github struct {
+	apiURL     string
+	owner      string
+	repo       string
+	number     string
+	token      string
+	httpClient *http.Client
+}
+
+// newGitHub parses an issue URL like https://github.com/owner/repo/issues/1.
+// GitHub has no API to attach files to issues, so the comment only links the
+// bundle.
+func newGitHub(opts Options, httpClient *http.Client) (*github, error) {
+	u, err := url.Parse(opts.IssueURL)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 4 || (parts[2] != "issues" && parts[2] != "pull") {
+		return nil, fmt.Errorf("unexpected GitHub issue URL: %s", opts.IssueURL)
+	}
+
+	apiURL := opts.APIURL
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+		if u.Host != "github.com" {
+			apiURL = fmt.Sprintf("%s://%s/api/v3", u.Scheme, u.Host)
+		}
+	}
+	return &github{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		owner:      parts[0],
+		repo:       parts[1],
+		number:     parts[3],
+		token:      opts.Token,
+		httpClient: httpClient,
+	}, nil
+}
+
+func (g *github) Attach(ctx context.Context, summary *Summary, path string) (string, error) {
+	data, err := json.Marshal(map[string]string{"body": summary.Markdown("")})
+	if err != nil {
+		return "", err
+	}
+
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github.v3+json")
+	header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		header.Set("Authorization", "token "+g.token)
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%s/comments", g.apiURL, g.owner, g.repo, g.number)
+	resp, err := doRequest(ctx, g.httpClient, http.MethodPost, url, header, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("fail to comment on issue: %s", err)
+	}
+
+	var comment struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(resp, &comment); err != nil {
+		return "", err
+	}
+	return comment.HTMLURL, nil
+}
@@ -0,0 +1,138 @@
+package attach
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type gitlab struct {
+	apiURL     string
+	issueURL   string
+	project    string
+	iid        string
+	token      string
+	upload     bool
+	httpClient *http.Client
+}
+
+// newGitLab parses an issue URL like https://gitlab.com/group/project/-/issues/1.
+func newGitLab(opts Options, httpClient *http.Client) (*gitlab, error) {
+	u, err := url.Parse(opts.IssueURL)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.Trim(u.Path, "/")
+	sep := "/-/issues/"
+	if !strings.Contains(path, sep) {
+		sep = "/issues/"
+	}
+	parts := strings.SplitN(path, sep, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.Contains(parts[1], "/") {
+		return nil, fmt.Errorf("unexpected GitLab issue URL: %s", opts.IssueURL)
+	}
+
+	apiURL := opts.APIURL
+	if apiURL == "" {
+		apiURL = fmt.Sprintf("%s://%s/api/v4", u.Scheme, u.Host)
+	}
+	return &gitlab{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		issueURL:   opts.IssueURL,
+		project:    parts[0],
+		iid:        parts[1],
+		token:      opts.Token,
+		upload:     opts.Upload,
+		httpClient: httpClient,
+	}, nil
+}
+
+func (g *gitlab) projectURL() string {
+	return fmt.Sprintf("%s/projects/%s", g.apiURL, url.PathEscape(g.project))
+}
+
+func (g *gitlab) header() http.Header {
+	header := http.Header{}
+	if g.token != "" {
+		header.Set("PRIVATE-TOKEN", g.token)
+	}
+	return header
+}
+
+func (g *gitlab) Attach(ctx context.Context, summary *Summary, path string) (string, error) {
+	var link string
+	if g.upload {
+		markdown, err := g.uploadFile(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("fail to upload bundle: %s", err)
+		}
+		link = markdown
+	}
+
+	data, err := json.Marshal(map[string]string{"body": summary.Markdown(link)})
+	if err != nil {
+		return "", err
+	}
+	header := g.header()
+	header.Set("Content-Type", "application/json")
+	url := fmt.Sprintf("%s/issues/%s/notes", g.projectURL(), g.iid)
+	resp, err := doRequest(ctx, g.httpClient, http.MethodPost, url, header, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("fail to comment on issue: %s", err)
+	}
+
+	var note struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(resp, &note); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s#note_%d", g.issueURL, note.ID), nil
+}
+
+// uploadFile streams the bundle to the project uploads API and returns the
+// markdown reference to it.
+func (g *gitlab) uploadFile(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	header := g.header()
+	header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := doRequest(ctx, g.httpClient, http.MethodPost, g.projectURL()+"/uploads", header, pr)
+	pr.Close()
+	if err != nil {
+		return "", err
+	}
+
+	var upload struct {
+		Markdown string `json:"markdown"`
+	}
+	if err := json.Unmarshal(resp, &upload); err != nil {
+		return "", err
+	}
+	return upload.Markdown, nil
+}
@@ -0,0 +1,38 @@
+package attach
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type webhook struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+type webhookPayload struct {
+	*Summary
+	Comment string `json:"comment"`
+}
+
+// Attach posts the summary as JSON to the webhook. Trackers without a
+// dedicated integration can consume it, e.g., with a small relay service.
+func (w *webhook) Attach(ctx context.Context, summary *Summary, path string) (string, error) {
+	data, err := json.Marshal(webhookPayload{Summary: summary, Comment: summary.Markdown("")})
+	if err != nil {
+		return "", err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		header.Set("Authorization", "Bearer "+w.token)
+	}
+	if _, err := doRequest(ctx, w.httpClient, http.MethodPost, w.url, header, bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("fail to post to webhook: %s", err)
+	}
+	return "", nil
+}
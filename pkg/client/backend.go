@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/scope"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// BackendAuto uses the SupportBundle custom resource when a kubeconfig is
+	// set or no URL is given, and the cluster serves the resource. It falls
+	// back to the REST API otherwise.
+	BackendAuto = "auto"
+	// BackendREST creates bundles with the Harvester REST API.
+	BackendREST = "rest"
+	// BackendCR creates SupportBundle custom resources with a kubeconfig.
+	BackendCR = "cr"
+)
+
+// Backends are the names accepted by SupportBundleClient.Backend.
+var Backends = []string{BackendAuto, BackendREST, BackendCR}
+
+// backend creates bundles on a cluster, reports their state and downloads
+// them.
+type backend interface {
+	// version returns the Harvester version of the cluster.
+	version(ctx context.Context) (string, error)
+	create(ctx context.Context, req BundleRequest) (*SupportBundleResource, error)
+	get(ctx context.Context, sbr *SupportBundleResource) (*SupportBundleResource, error)
+	// list returns the bundles on the cluster.
+	list(ctx context.Context) ([]*SupportBundleResource, error)
+	// watch calls onUpdate with the bundle as it changes, until it's done or
+	// fails.
+	watch(ctx context.Context, sbr *SupportBundleResource, onUpdate func(*SupportBundleResource) (bool, error)) error
+	download(ctx context.Context, sbr *SupportBundleResource, opts DownloadOptions) (string, error)
+	// remove deletes a bundle from the cluster. A bundle already gone isn't
+	// an error.
+	remove(ctx context.Context, sbr *SupportBundleResource) error
+	// close ends the session with the cluster.
+	close(ctx context.Context) error
+}
+
+// BundleRequest is what a bundle is created with.
+type BundleRequest struct {
+	IssueURL    string
+	Description string
+	// Scope narrows the bundle down. Servers that don't support scoped
+	// bundles generate the whole bundle, see
+	// SupportBundleResource.ScopeApplied and scope.Filter.
+	Scope scope.Scope
+}
+
+// restBackend creates bundles with the Harvester REST API, in the shape of
+// the compatibility of the server.
+type restBackend struct {
+	r *RESTClient
+}
+
+func (b *restBackend) version(ctx context.Context) (string, error) {
+	return b.r.ServerVersionContext(ctx)
+}
+
+func (b *restBackend) create(ctx context.Context, req BundleRequest) (*SupportBundleResource, error) {
+	compat, _ := b.r.Compatibility()
+	var input interface{} = newInitiateInput(req)
+	if compat.Bundles == BundleAPISteve {
+		obj := supportBundleObject(req)
+		obj.Object["type"] = supportBundleResourceType
+		input = obj.Object
+	}
+	url := b.r.apiURL + compat.BundlesPath
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.r.RequestContext(ctx, http.MethodPost, url, data)
+	if err != nil {
+		return nil, err
+	}
+	if compat.Bundles == BundleAPISteve {
+		var obj unstructured.Unstructured
+		if err := json.Unmarshal(resp, &obj.Object); err != nil {
+			return nil, err
+		}
+		sbr := bundleFromObject(&obj)
+		sbr.ScopeApplied = scopeApplied(&obj, req.Scope)
+		return sbr, nil
+	}
+	return decodeBundle(compat, resp)
+}
+
+func newInitiateInput(req BundleRequest) SupportBundleInitateInput {
+	input := SupportBundleInitateInput{
+		IssueURL:      req.IssueURL,
+		Description:   req.Description,
+		Namespaces:    req.Scope.Namespaces,
+		Nodes:         req.Scope.Nodes,
+		ExcludeVMLogs: req.Scope.ExcludeVMLogs,
+	}
+	if !req.Scope.Since.IsZero() {
+		input.Since = req.Scope.Since.UTC().Format(time.RFC3339)
+	}
+	if !req.Scope.Until.IsZero() {
+		input.Until = req.Scope.Until.UTC().Format(time.RFC3339)
+	}
+	return input
+}
+
+func (b *restBackend) get(ctx context.Context, sbr *SupportBundleResource) (*SupportBundleResource, error) {
+	compat, _ := b.r.Compatibility()
+	resp, err := b.r.RequestContext(ctx, http.MethodGet, b.r.apiURL+bundlePath(compat, sbr), nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBundle(compat, resp)
+}
+
+func (b *restBackend) list(ctx context.Context) ([]*SupportBundleResource, error) {
+	compat, _ := b.r.Compatibility()
+	resp, err := b.r.RequestContext(ctx, http.MethodGet, b.r.apiURL+compat.BundlesPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var collection struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &collection); err != nil {
+		return nil, err
+	}
+	bundles := make([]*SupportBundleResource, 0, len(collection.Data))
+	for _, data := range collection.Data {
+		sbr, err := decodeBundle(compat, data)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, sbr)
+	}
+	return bundles, nil
+}
+
+// bundlePath returns the path of a bundle in the API.
+func bundlePath(compat Compatibility, sbr *SupportBundleResource) string {
+	if compat.Bundles == BundleAPISteve {
+		return fmt.Sprintf("%s/%s/%s", compat.BundlesPath, sbr.Namespace, sbr.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", compat.BundlesPath, sbr.BackendID(), sbr.Name)
+}
+
+// decodeBundle decodes a bundle of the API.
+func decodeBundle(compat Compatibility, data []byte) (*SupportBundleResource, error) {
+	if compat.Bundles == BundleAPISteve {
+		var obj unstructured.Unstructured
+		if err := json.Unmarshal(data, &obj.Object); err != nil {
+			return nil, err
+		}
+		return bundleFromObject(&obj), nil
+	}
+	var sbr SupportBundleResource
+	if err := json.Unmarshal(data, &sbr); err != nil {
+		return nil, err
+	}
+	return &sbr, nil
+}
+
+// watch polls the bundle, at once when the server notifies of a change if
+// it supports subscriptions.
+func (b *restBackend) watch(ctx context.Context, sbr *SupportBundleResource, onUpdate func(*SupportBundleResource) (bool, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	compat, _ := b.r.Compatibility()
+	namespace := sbr.Namespace
+	if namespace == "" {
+		namespace = supportBundleNamespace
+	}
+	changes, err := b.r.subscribe(ctx, compat.SubscribePath, supportBundleResourceType, namespace+"/"+sbr.Name)
+	if err != nil {
+		changes = nil
+	}
+	get := func(ctx context.Context) (*SupportBundleResource, error) {
+		return b.get(ctx, sbr)
+	}
+	return poll(ctx, get, changes, onUpdate)
+}
+
+func (b *restBackend) download(ctx context.Context, sbr *SupportBundleResource, opts DownloadOptions) (string, error) {
+	compat, _ := b.r.Compatibility()
+	url := b.r.apiURL + bundlePath(compat, sbr) + "/download"
+	if compat.DownloadPath != "" {
+		url = b.r.apiURL + fmt.Sprintf(compat.DownloadPath, sbr.Name)
+	}
+	return b.r.DownloadContext(ctx, url, opts)
+}
+
+// remove deletes a SupportBundle resource. The legacy API has no way to
+// delete bundles, it removes them once they are downloaded.
+func (b *restBackend) remove(ctx context.Context, sbr *SupportBundleResource) error {
+	compat, _ := b.r.Compatibility()
+	if compat.Bundles != BundleAPISteve {
+		return nil
+	}
+	_, err := b.r.RequestContext(ctx, http.MethodDelete, b.r.apiURL+bundlePath(compat, sbr), nil)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (b *restBackend) close(ctx context.Context) error {
+	return b.r.LogoutContext(ctx)
+}
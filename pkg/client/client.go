@@ -1,13 +1,25 @@
 package client
 
 import (
+	"archive/zip"
 	"context"
-	"encoding/json"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/bk201/support-bundle-utils/pkg/attach"
 	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/encrypt"
+	"github.com/bk201/support-bundle-utils/pkg/hook"
+	"github.com/bk201/support-bundle-utils/pkg/library"
+	"github.com/bk201/support-bundle-utils/pkg/report"
+	"github.com/bk201/support-bundle-utils/pkg/scope"
+	"github.com/bk201/support-bundle-utils/pkg/split"
 	wait "k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -19,14 +31,90 @@ type SupportBundleClient struct {
 	OutputFile string
 	Insecure   bool
 
+	// OutputDir is the directory a relative or server supplied bundle path,
+	// see OutputFile, is saved in.
+	OutputDir string
+	// Force overwrites an existing bundle file.
+	Force bool
+	// Connections downloads the bundle in ranges over this many concurrent
+	// connections when set.
+	Connections int
+	// Retries is the number of times a failed range is retried.
+	Retries int
+	// RateLimit caps the download rate in bytes per second when set.
+	RateLimit int64
+
+	// RancherToken reaches the cluster through a Rancher server when set. The
+	// URL passed to Run is then the Rancher URL and Cluster is the ID or name
+	// of the Harvester cluster in Rancher.
+	RancherToken string
+	Cluster      string
+
+	// Backend selects how bundles are created, see BackendAuto.
+	Backend string
+	// Kubeconfig is the kubeconfig file of the SupportBundle custom resource
+	// backend. The default loading rules apply if empty.
+	Kubeconfig string
+
 	IssueURL         string
 	IssueDescription string
-	r                *RESTClient
+	// Scope narrows the bundle down. Bundles of servers that don't support
+	// scopes are filtered after the download.
+	Scope scope.Scope
+
+	// Reuse attaches to a bundle of the same issue being generated, or
+	// generated within ReuseWindow, instead of creating a new one. Bundles
+	// aren't reused when a Scope is set.
+	Reuse       bool
+	ReuseWindow time.Duration
+	// ReuseBundle attaches to the bundle of this name instead of creating one.
+	ReuseBundle string
+	// Cleanup deletes the bundle from the cluster once it's downloaded and
+	// verified, if this run created it. Reused bundles are always kept, other
+	// downloads may be waiting on them.
+	Cleanup bool
+
+	// Recipients encrypt the downloaded bundle when set
+	Recipients []encrypt.Recipient
+	// SplitSize splits the downloaded bundle into parts of this size when set
+	SplitSize int64
+	// Tracker posts a bundle summary to the issue when set
+	Tracker attach.Tracker
+	// Notifier fires lifecycle events to hooks when set
+	Notifier *hook.Notifier
+	// Library registers the downloaded bundle when set
+	Library *library.Library
+
+	// Stdout receives progress messages, or the bundle when it's streamed to
+	// stdout, and Stderr warnings, and progress messages when the bundle is
+	// streamed. Nothing is written when they are nil.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	client  *Client
+	version string
+	sbr     *SupportBundleResource
+	saved   string
+
+	// reported is the last generation progress milestone sent to hooks.
+	reported int
 }
 
+// OutputStdout is the OutputFile streaming the bundle to stdout instead of
+// saving it.
+const OutputStdout = "-"
+
 type SupportBundleInitateInput struct {
 	IssueURL    string `json:"issueURL"`
 	Description string `json:"description"`
+
+	// The scope of the bundle, see scope.Scope. Servers that don't support
+	// scoped bundles ignore them.
+	Namespaces    []string `json:"namespaces,omitempty"`
+	Nodes         []string `json:"nodes,omitempty"`
+	Since         string   `json:"since,omitempty"`
+	Until         string   `json:"until,omitempty"`
+	ExcludeVMLogs bool     `json:"excludeVMLogs,omitempty"`
 }
 
 type BundleState string
@@ -46,6 +134,15 @@ type SupportBundleResource struct {
 	Name               string      `json:"name"`
 	ErrorMessage       BundleError `json:"errorMessage"`
 	ProgressPercentage int         `json:"progressPercentage"`
+	// Namespace and DownloadURL are set by the custom resource backend.
+	Namespace   string `json:"namespace,omitempty"`
+	DownloadURL string `json:"downloadURL,omitempty"`
+	// ScopeApplied reports whether the server generates the bundle in the
+	// requested scope.
+	ScopeApplied bool `json:"scopeApplied,omitempty"`
+	// IssueURL and Created, in RFC 3339, identify bundles to reuse.
+	IssueURL string `json:"issueURL,omitempty"`
+	Created  string `json:"created,omitempty"`
 }
 
 func (sbr *SupportBundleResource) BackendID() string {
@@ -56,100 +153,467 @@ func (sbr *SupportBundleResource) BackendID() string {
 	return sbr.NodeID
 }
 
-func (sbr *SupportBundleResource) readyCondition(r *RESTClient) wait.ConditionFunc {
-	return func() (done bool, err error) {
-		url := fmt.Sprintf("%s/v1/supportbundles/%s/%s", r.apiURL, sbr.BackendID(), sbr.Name)
-		resp, err := r.Get(url)
+// progressMilestones are the generation progress percentages reported to hooks
+var progressMilestones = []int{25, 50, 75}
+
+// failedNotifyTimeout bounds sending the failure of a run to hooks.
+const failedNotifyTimeout = 30 * time.Second
+
+// Run generates and downloads a bundle of the cluster at url.
+func (c *SupportBundleClient) Run(url string) error {
+	return c.RunContext(context.Background(), url)
+}
+
+// RunContext is like Run, cancelling ctx interrupts the run.
+func (c *SupportBundleClient) RunContext(ctx context.Context, url string) error {
+	c.url = url
+
+	err := c.run(ctx)
+	if err != nil {
+		// The run may have failed because ctx is done, the failure is still
+		// sent.
+		notifyCtx, cancel := context.WithTimeout(context.Background(), failedNotifyTimeout)
+		defer cancel()
+		c.notify(notifyCtx, &hook.Event{Type: hook.EventFailed, Error: err.Error()})
+	}
+	return err
+}
+
+func (c *SupportBundleClient) run(ctx context.Context) error {
+	if c.streaming() && (len(c.Recipients) > 0 || c.SplitSize > 0 || c.Tracker != nil) {
+		return errors.New("a bundle streamed to stdout can't be encrypted, split or attached to an issue")
+	}
+	if c.streaming() && c.Stdout == nil {
+		return errors.New("no stdout to stream the bundle to")
+	}
+
+	cl, err := New(ctx, c.url, c.options(ctx)...)
+	if err != nil {
+		return err
+	}
+	c.client = cl
+	defer func() {
+		if err := cl.Close(ctx); err != nil {
+			fmt.Fprintf(c.stderr(), "fail to logout: %s\n", err)
+		}
+	}()
+	c.url = cl.URL()
+	c.version = cl.ServerVersion()
+
+	sbr, err := c.findBundle(ctx)
+	if err != nil {
+		return err
+	}
+	reused := sbr != nil
+	if !reused {
+		sbr, err = cl.Create(ctx, BundleRequest{IssueURL: c.IssueURL, Description: c.IssueDescription, Scope: c.Scope})
 		if err != nil {
-			return false, err
+			return err
 		}
-		var newSbr SupportBundleResource
-		err = json.Unmarshal(resp, &newSbr)
+	}
+	c.sbr = sbr
+	filter := !c.Scope.IsZero() && !sbr.ScopeApplied
+	var refusal error
+	switch {
+	case filter && c.streaming():
+		refusal = errors.New("the server doesn't support scoped bundles, and a bundle streamed to stdout can't be filtered")
+	case filter && len(c.Recipients) > 0:
+		refusal = errors.New("the server doesn't support scoped bundles, and a bundle encrypted while it's downloaded can't be filtered")
+	}
+	if refusal != nil {
+		// Whether the server applies scopes is only known once the bundle
+		// is created, it isn't left behind.
+		if !reused {
+			if err := cl.Delete(ctx, sbr); err != nil {
+				fmt.Fprintf(c.stderr(), "fail to remove bundle %s from the cluster: %s\n", sbr.Name, err)
+			}
+		}
+		return refusal
+	}
+	if reused {
+		fmt.Fprintf(c.console(), "reusing bundle %s...", sbr.Name)
+	} else {
+		fmt.Fprintf(c.console(), "bundle %s is being generated...", sbr.Name)
+	}
+	c.notify(ctx, &hook.Event{Type: hook.EventCreated})
+
+	err = c.wait(ctx, sbr)
+	if err != nil {
+		return err
+	}
+	c.notify(ctx, &hook.Event{Type: hook.EventReady, Progress: 100})
+
+	saved, err := c.download(ctx, sbr)
+	if err != nil {
+		return err
+	}
+	if c.Cleanup && !reused {
+		// A streamed or encrypted bundle can't be read through, the download
+		// already checked it's complete.
+		if !c.streaming() && len(c.Recipients) == 0 {
+			if err := verifyBundle(saved); err != nil {
+				return fmt.Errorf("bundle %s is kept on the cluster, the download is corrupted: %s", sbr.Name, err)
+			}
+		}
+		if err := cl.Delete(ctx, sbr); err != nil {
+			fmt.Fprintf(c.stderr(), "fail to remove bundle %s from the cluster: %s\n", sbr.Name, err)
+		} else {
+			fmt.Fprintf(c.console(), "bundle %s is removed from the cluster\n", sbr.Name)
+		}
+	}
+	if c.streaming() {
+		c.notify(ctx, &hook.Event{Type: hook.EventDownloaded, Progress: 100, OutputPath: OutputStdout})
+		return nil
+	}
+
+	if filter {
+		fmt.Fprintln(c.console(), "the server doesn't support scoped bundles, filtering the bundle")
+		stats, err := scope.Filter(saved, c.Scope)
+		if err != nil {
+			return fmt.Errorf("fail to filter bundle: %s", err)
+		}
+		fmt.Fprintf(c.console(), "removed %d of %d files and %d log lines out of scope\n", stats.RemovedFiles, stats.Files, stats.RemovedLines)
+	}
+
+	// The version is kept in the zip comment, an encrypted bundle only has
+	// it in the library and the issue summary.
+	if c.version != "" && len(c.Recipients) == 0 {
+		if err := setZipComment(saved, versionComment+c.version); err != nil {
+			fmt.Fprintf(c.stderr(), "fail to record the server version in the bundle: %s\n", err)
+		}
+	}
+
+	c.saved = saved
+	fmt.Fprintf(c.console(), "bundle is saved to %s\n", saved)
+	c.notifyDownloaded(ctx, saved)
+
+	var files []string
+	if c.SplitSize > 0 {
+		indexPath, err := split.Split(saved, filepath.Dir(saved), c.SplitSize)
 		if err != nil {
-			return false, err
+			return fmt.Errorf("fail to split bundle: %s", err)
+		}
+		fmt.Fprintf(c.console(), "bundle is split into parts, index is saved to %s\n", indexPath)
+		if files, err = splitFiles(indexPath); err != nil {
+			return err
+		}
+	}
+
+	if c.Library != nil {
+		if err := c.register(sbr, saved, files); err != nil {
+			fmt.Fprintf(c.stderr(), "fail to register bundle in library: %s\n", err)
 		}
-		if newSbr.State == BundleStateReadyForDownload {
-			utils.WriteStdout(".100\n")
-			return true, nil
+	}
+
+	if c.Tracker != nil {
+		// The bundle is already saved, so failing to comment on the issue
+		// should not fail the run.
+		if err := c.attach(ctx, sbr, saved); err != nil {
+			fmt.Fprintf(c.stderr(), "fail to attach bundle to issue: %s\n", err)
 		}
-		utils.WriteStdout(".")
-		return false, nil
 	}
+	return nil
 }
 
-func (c *SupportBundleClient) Run(url string) error {
-	c.url = url
+// Saved returns the path the bundle was saved to by the last successful Run.
+func (c *SupportBundleClient) Saved() string {
+	return c.saved
+}
 
-	c.r = NewRESTClient(context.TODO(), c.url, c.User, c.Password, c.Insecure)
-	if !c.NoAuth {
-		err := c.r.Login()
+// findBundle returns the bundle to reuse, or nil if a new one is created.
+// Failing to look for a bundle of the issue isn't an error, failing to find
+// ReuseBundle is.
+func (c *SupportBundleClient) findBundle(ctx context.Context) (*SupportBundleResource, error) {
+	if c.ReuseBundle != "" {
+		return c.client.Find(ctx, c.ReuseBundle)
+	}
+	if !c.Reuse || c.IssueURL == "" || !c.Scope.IsZero() {
+		return nil, nil
+	}
+	sbr, err := c.client.FindReusable(ctx, c.IssueURL, time.Now().Add(-c.ReuseWindow))
+	if err != nil {
+		fmt.Fprintf(c.stderr(), "fail to look for a bundle to reuse: %s\n", err)
+		return nil, nil
+	}
+	return sbr, nil
+}
+
+// verifyBundle reads the downloaded bundle through, which checks the
+// checksums of its files.
+func verifyBundle(path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		rc, err := f.Open()
 		if err != nil {
-			return fmt.Errorf("fail to login: %s", err)
+			return fmt.Errorf("%s: %s", f.Name, err)
+		}
+		_, err = io.Copy(ioutil.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.Name, err)
 		}
-		defer func() {
-			err = c.r.Logout()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "fail to logout: %s\n", err)
-			}
-		}()
 	}
+	return nil
+}
+
+// versionComment prefixes the server version in the comment of a bundle,
+// e.g., "Harvester version: v1.1.0". unzip -z prints it.
+const versionComment = "Harvester version: "
 
-	sbr, err := c.create()
+// setZipComment sets the comment of the zip file at path, which must have
+// none yet. The comment ends the file, so it's appended in place.
+func setZipComment(path, comment string) error {
+	const (
+		endSignature = 0x06054b50
+		endSize      = 22
+	)
+	if len(comment) > 0xffff {
+		return errors.New("zip comment is too long")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("bundle %s is being generated...", sbr.Name)
+	end := make([]byte, endSize)
+	if info.Size() < endSize {
+		return errors.New("not a zip file")
+	}
+	if _, err := f.ReadAt(end, info.Size()-endSize); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(end) != endSignature {
+		return errors.New("the bundle already has a comment or isn't a zip file")
+	}
+	binary.LittleEndian.PutUint16(end[endSize-2:], uint16(len(comment)))
+	if _, err := f.WriteAt(append(end[endSize-2:], comment...), info.Size()-2); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// options returns the options of the Client.
+func (c *SupportBundleClient) options(ctx context.Context) []Option {
+	opts := []Option{
+		WithCredentials(c.User, c.Password),
+		WithBackend(c.Backend),
+		WithKubeconfig(c.Kubeconfig),
+		WithObserver(ObserverFunc(func(e Event) {
+			c.observe(ctx, e)
+		})),
+	}
+	if c.NoAuth {
+		opts = append(opts, WithoutAuth())
+	}
+	if c.Insecure {
+		opts = append(opts, WithInsecure())
+	}
+	if c.RancherToken != "" {
+		opts = append(opts, WithRancher(c.RancherToken, c.Cluster))
+	}
+	return opts
+}
+
+// observe prints the progress of the Client, and reports the generation
+// progress to hooks.
+func (c *SupportBundleClient) observe(ctx context.Context, e Event) {
+	switch e.Type {
+	case EventWarning:
+		fmt.Fprintf(c.stderr(), "warning: %s\n", e.Message)
+	case EventConnected:
+		if e.Version != "" {
+			fmt.Fprintf(c.console(), "connected to Harvester %s\n", e.Version)
+		}
+	case EventProgress:
+		c.sbr = e.Bundle
+		milestone := 0
+		for _, m := range progressMilestones {
+			if e.Bundle.ProgressPercentage >= m {
+				milestone = m
+			}
+		}
+		if milestone > c.reported {
+			c.reported = milestone
+			c.notify(ctx, &hook.Event{Type: hook.EventProgress, Progress: milestone})
+		}
+		fmt.Fprint(c.console(), ".")
+	case EventReady:
+		c.sbr = e.Bundle
+		fmt.Fprint(c.console(), ".100\n")
+	}
+}
+
+func (c *SupportBundleClient) wait(ctx context.Context, sbr *SupportBundleResource) error {
+	timeout := 2 * time.Minute
+	fmt.Fprint(c.console(), "\n")
+	c.reported = 0
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err := c.client.Wait(ctx, sbr)
+	var genErr *GenerationError
+	if errors.As(err, &genErr) {
+		fmt.Fprint(c.console(), "\n")
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timeout for waiting a bundle: %s", wait.ErrWaitTimeout)
+	}
+	return err
+}
 
-	err = c.wait(sbr)
+func (c *SupportBundleClient) download(ctx context.Context, sbr *SupportBundleResource) (string, error) {
+	progress := newProgressPrinter(c.console())
+	opts := DownloadOptions{
+		Path:        c.OutputFile,
+		Dir:         c.OutputDir,
+		DefaultName: sbr.Name + ".zip",
+		Force:       c.Force,
+		Connections: c.Connections,
+		Retries:     c.Retries,
+		RateLimit:   c.RateLimit,
+		Progress:    progress.update,
+	}
+	if c.streaming() {
+		opts.Writer = c.Stdout
+	}
+	if len(c.Recipients) > 0 {
+		// The bundle is encrypted as it's received, so it's never on disk in
+		// plain text.
+		opts.Wrap = func(w io.Writer) (io.WriteCloser, error) {
+			return encrypt.NewWriter(w, sbr.Name, c.Recipients...)
+		}
+		opts.Suffix = ".enc"
+	}
+	saved, err := c.client.Download(ctx, sbr, opts)
+	progress.done(err == nil)
+	return saved, err
+}
+
+func (c *SupportBundleClient) streaming() bool {
+	return c.OutputFile == OutputStdout
+}
+
+// console returns where progress messages go, stderr when the bundle is
+// streamed to stdout.
+func (c *SupportBundleClient) console() io.Writer {
+	if c.streaming() {
+		return c.stderr()
+	}
+	return c.stdout()
+}
+
+func (c *SupportBundleClient) stdout() io.Writer {
+	if c.Stdout == nil {
+		return ioutil.Discard
+	}
+	return c.Stdout
+}
+
+func (c *SupportBundleClient) stderr() io.Writer {
+	if c.Stderr == nil {
+		return ioutil.Discard
+	}
+	return c.Stderr
+}
+
+func (c *SupportBundleClient) attach(ctx context.Context, sbr *SupportBundleResource, path string) error {
+	summary, err := attach.NewSummary(sbr.Name, path)
 	if err != nil {
 		return err
 	}
+	summary.IssueURL = c.IssueURL
+	summary.Description = c.IssueDescription
+	summary.ServerVersion = c.version
+	// An encrypted bundle can't be analyzed.
+	if len(c.Recipients) == 0 {
+		highlights, err := report.Highlights(path, attach.MaxHighlights)
+		if err != nil {
+			fmt.Fprintf(c.stderr(), "fail to analyze bundle: %s\n", err)
+		}
+		summary.Highlights = highlights
+	}
 
-	saved, err := c.download(sbr, c.OutputFile)
+	link, err := c.Tracker.Attach(ctx, summary, path)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("bundle is saved to %s\n", saved)
+	if link != "" {
+		fmt.Fprintf(c.console(), "bundle summary is posted to %s\n", link)
+	}
 	return nil
 }
 
-func (c *SupportBundleClient) create() (*SupportBundleResource, error) {
-	sbi := SupportBundleInitateInput{
-		IssueURL:    c.IssueURL,
-		Description: c.IssueDescription,
+func (c *SupportBundleClient) notify(ctx context.Context, e *hook.Event) {
+	if c.Notifier == nil {
+		return
+	}
+	e.ClusterURL = c.url
+	e.IssueURL = c.IssueURL
+	e.ServerVersion = c.version
+	if c.sbr != nil {
+		e.BundleName = c.sbr.Name
+		e.Bundle = c.sbr
+		if e.Progress == 0 {
+			e.Progress = c.sbr.ProgressPercentage
+		}
+	}
+	if err := c.Notifier.Notify(ctx, e); err != nil {
+		fmt.Fprintf(c.stderr(), "fail to fire %s hook: %s\n", e.Type, err)
 	}
-	url := c.url + "/v1/supportbundles"
+}
 
-	data, err := json.Marshal(sbi)
+func (c *SupportBundleClient) notifyDownloaded(ctx context.Context, path string) {
+	if c.Notifier == nil {
+		return
+	}
+	sum, _, err := utils.SHA256File(path)
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(c.stderr(), "fail to compute bundle checksum: %s\n", err)
 	}
-	resp, err := c.r.Post(url, data)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	c.notify(ctx, &hook.Event{Type: hook.EventDownloaded, Progress: 100, OutputPath: path, SHA256: sum})
+}
+
+// splitFiles returns the absolute paths of the index at indexPath and of the
+// parts it lists.
+func splitFiles(indexPath string) ([]string, error) {
+	idx, err := split.ReadIndex(indexPath)
 	if err != nil {
 		return nil, err
 	}
-
-	var sbr SupportBundleResource
-	err = json.Unmarshal(resp, &sbr)
+	indexPath, err = filepath.Abs(indexPath)
 	if err != nil {
 		return nil, err
 	}
-
-	return &sbr, nil
+	files := []string{indexPath}
+	for _, p := range idx.Parts {
+		files = append(files, filepath.Join(filepath.Dir(indexPath), p.Name))
+	}
+	return files, nil
 }
 
-func (c *SupportBundleClient) wait(sbr *SupportBundleResource) error {
-	interval := 5 * time.Second
-	timeout := 2 * time.Minute
-	utils.WriteStdout("\n")
-	err := wait.PollImmediate(interval, timeout, sbr.readyCondition(c.r))
+// register adds the bundle at path to the library. files are other files
+// belonging to it, see library.Entry.
+func (c *SupportBundleClient) register(sbr *SupportBundleResource, path string, files []string) error {
+	entry, err := library.NewEntry(sbr.Name, path)
 	if err != nil {
-		return fmt.Errorf("timeout for waiting a bundle: %s", err)
+		return err
 	}
-	return nil
-}
-
-func (c *SupportBundleClient) download(sbr *SupportBundleResource, path string) (string, error) {
-	url := fmt.Sprintf("%s/v1/supportbundles/%s/%s/download", c.url, sbr.BackendID(), sbr.Name)
-	return c.r.Download(url, path)
+	entry.Files = files
+	entry.ClusterURL = c.url
+	entry.ServerVersion = c.version
+	entry.IssueURL = c.IssueURL
+	entry.Description = c.IssueDescription
+	return c.Library.Add(entry)
 }
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"archive/zip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bk201/support-bundle-utils/pkg/encrypt"
+	"github.com/bk201/support-bundle-utils/pkg/hook"
+	"github.com/bk201/support-bundle-utils/pkg/scope"
+)
+
+func TestSetZipComment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeZip := func(name, comment string) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		w, _ := zw.Create("bundle/file.txt")
+		w.Write([]byte("data"))
+		if comment != "" {
+			zw.SetComment(comment)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		return path
+	}
+	notZip := filepath.Join(dir, "not.zip")
+	if err := ioutil.WriteFile(notZip, []byte("not a zip file, but longer than 22 bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"no comment", writeZip("plain.zip", ""), false},
+		{"comment", writeZip("comment.zip", "existing"), true},
+		{"not a zip", notZip, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setZipComment(tt.path, versionComment+"v1.1.0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if err := verifyBundle(tt.path); err != nil {
+				t.Fatal(err)
+			}
+			zr, err := zip.OpenReader(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			if zr.Comment != "Harvester version: v1.1.0" {
+				t.Errorf("got comment %q", zr.Comment)
+			}
+		})
+	}
+}
+
+func TestRunUnscopedServer(t *testing.T) {
+	passphrase, err := encrypt.NewPassphraseRecipient("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		output     string
+		recipients []encrypt.Recipient
+		wantErr    string
+	}{
+		{"streamed", OutputStdout, nil, "streamed to stdout can't be filtered"},
+		{"encrypted", "bundle.zip", []encrypt.Recipient{passphrase}, "encrypted while it's downloaded can't be filtered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var deleted []string
+			// The server creates bundles without the scope fields.
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v3-public/localProviders/local":
+					w.Write([]byte(`{"token":"token-1"}`))
+				case r.URL.Path == serverVersionPaths[0]:
+					w.Write([]byte(`{"value":"v1.0.3"}`))
+				case r.Method == http.MethodPost && r.URL.Path == Compatibilities[1].BundlesPath:
+					w.Write([]byte(`{"metadata":{"name":"bundle-x7k2q","namespace":"harvester-system"},"spec":{"issueURL":"","description":""}}`))
+				case r.Method == http.MethodDelete:
+					mu.Lock()
+					deleted = append(deleted, r.URL.Path)
+					mu.Unlock()
+				case r.URL.Path == "/v3/tokens":
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+
+			c := &SupportBundleClient{
+				User:       "admin",
+				Password:   "password",
+				Backend:    BackendREST,
+				OutputFile: tt.output,
+				Scope:      scope.Scope{Namespaces: []string{"default"}},
+				Recipients: tt.recipients,
+				Stdout:     ioutil.Discard,
+				Stderr:     ioutil.Discard,
+			}
+			err := c.Run(ts.URL)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+			want := Compatibilities[1].BundlesPath + "/harvester-system/bundle-x7k2q"
+			if len(deleted) != 1 || deleted[0] != want {
+				t.Errorf("got deletes %q, want %s", deleted, want)
+			}
+		})
+	}
+}
+
+// ctxHook records the events fired and whether their context was done.
+type ctxHook struct {
+	events []hook.EventType
+	done   []bool
+}
+
+func (h *ctxHook) Fire(ctx context.Context, e *hook.Event) error {
+	h.events = append(h.events, e.Type)
+	h.done = append(h.done, ctx.Err() != nil)
+	return nil
+}
+
+func TestRunFailedNotification(t *testing.T) {
+	h := &ctxHook{}
+	c := &SupportBundleClient{
+		Backend:  BackendREST,
+		NoAuth:   true,
+		Notifier: &hook.Notifier{Hooks: []hook.Hook{h}},
+		Stdout:   ioutil.Discard,
+		Stderr:   ioutil.Discard,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.RunContext(ctx, "http://127.0.0.1:1"); err == nil {
+		t.Fatal("run of a cancelled context succeeded")
+	}
+	if len(h.events) != 1 || h.events[0] != hook.EventFailed || h.done[0] {
+		t.Errorf("got events %v, done %v, want the failure with a live context", h.events, h.done)
+	}
+}
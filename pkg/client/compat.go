@@ -0,0 +1,131 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// AuthFlow is how a client logs in to a Harvester API.
+type AuthFlow string
+
+const (
+	// AuthJWE logs in to the Harvester auth endpoint, the token is sent in the
+	// jweToken header.
+	AuthJWE = AuthFlow("jwe")
+	// AuthRancher logs in to the local auth provider of the embedded Rancher,
+	// the token is sent as a bearer token.
+	AuthRancher = AuthFlow("rancher")
+)
+
+// BundleAPI is the shape of the support bundle endpoints.
+type BundleAPI string
+
+const (
+	// BundleAPILegacy creates bundles with SupportBundleInitateInput and
+	// addresses them by node and name.
+	BundleAPILegacy = BundleAPI("legacy")
+	// BundleAPISteve creates SupportBundle resources through the Steve API
+	// and addresses them by namespace and name.
+	BundleAPISteve = BundleAPI("steve")
+)
+
+// Compatibility is the API shape of a range of Harvester versions.
+type Compatibility struct {
+	// MinVersion is the first version of the range. The range ends at the
+	// MinVersion of the next entry of the table.
+	MinVersion string `json:"minVersion"`
+	// Tested is the latest version of the range tested with this client.
+	Tested string `json:"tested"`
+
+	Auth       AuthFlow `json:"auth"`
+	LoginPath  string   `json:"loginPath"`
+	LogoutPath string   `json:"logoutPath"`
+
+	Bundles     BundleAPI `json:"bundles"`
+	BundlesPath string    `json:"bundlesPath"`
+	// DownloadPath formats the download path of a bundle with its name. The
+	// legacy API downloads from the bundle path.
+	DownloadPath  string `json:"downloadPath,omitempty"`
+	SubscribePath string `json:"subscribePath"`
+}
+
+// Compatibilities is the compatibility table, oldest versions first.
+var Compatibilities = []Compatibility{
+	{
+		MinVersion:    "v0.1.0",
+		Tested:        "v0.2.0",
+		Auth:          AuthJWE,
+		LoginPath:     HarvesterURLAuthLogin,
+		LogoutPath:    HarvesterURLAuthLogout,
+		Bundles:       BundleAPILegacy,
+		BundlesPath:   "/v1/supportbundles",
+		SubscribePath: HarvesterURLSubscribe,
+	},
+	{
+		MinVersion:    "v0.3.0",
+		Tested:        "v1.0.3",
+		Auth:          AuthRancher,
+		LoginPath:     "/v3-public/localProviders/local?action=login",
+		LogoutPath:    "/v3/tokens?action=logout",
+		Bundles:       BundleAPISteve,
+		BundlesPath:   "/v1/harvester/harvesterhci.io.supportbundles",
+		DownloadPath:  "/v1/harvester/supportbundles/%s/download",
+		SubscribePath: "/v1/harvester/subscribe",
+	},
+}
+
+// CompatibilityFor returns the entry of the compatibility table for a
+// version, and whether the version was tested with this client. Versions
+// that can't be parsed, e.g., development builds, get the latest entry.
+func CompatibilityFor(version string) (Compatibility, bool) {
+	if _, ok := parseVersion(version); !ok {
+		return Compatibilities[len(Compatibilities)-1], false
+	}
+	if compareVersions(version, Compatibilities[0].MinVersion) < 0 {
+		return Compatibilities[0], false
+	}
+	compat := Compatibilities[0]
+	for _, c := range Compatibilities {
+		if compareVersions(version, c.MinVersion) >= 0 {
+			compat = c
+		}
+	}
+	return compat, compareVersions(version, compat.Tested) <= 0
+}
+
+// UntestedWarning explains that a version isn't tested with this client.
+func UntestedWarning(version string, compat Compatibility) string {
+	return fmt.Sprintf("Harvester %s is not tested with this client, it's handled like Harvester %s", version, compat.Tested)
+}
+
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseVersion returns the major, minor and patch numbers of a version.
+// Suffixes, e.g., -rc1, are ignored.
+func parseVersion(version string) ([3]int, bool) {
+	var v [3]int
+	m := versionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return v, false
+	}
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return v, true
+}
+
+// compareVersions compares two parsable versions like strings.Compare.
+func compareVersions(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for i := range va {
+		switch {
+		case va[i] < vb[i]:
+			return -1
+		case va[i] > vb[i]:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	"github.com/bk201/support-bundle-utils/pkg/scope"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// supportBundleNamespace is where Harvester generates bundles.
+	supportBundleNamespace = "harvester-system"
+	// supportBundleDownloadPath is the Harvester API path of bundle
+	// downloads, reached through the API server service proxy.
+	supportBundleDownloadPath = "/api/v1/namespaces/harvester-system/services/https:harvester:8443/proxy/v1/harvester/supportbundles/%s/download"
+
+	crStateReady = "ready"
+	crStateError = "error"
+)
+
+var (
+	supportBundleGVR = schema.GroupVersionResource{Group: "harvesterhci.io", Version: "v1beta1", Resource: "supportbundles"}
+	settingGVR       = schema.GroupVersionResource{Group: "harvesterhci.io", Version: "v1beta1", Resource: "settings"}
+)
+
+// crBackend creates bundles as SupportBundle custom resources, which newer
+// Harvester versions manage instead of the REST API.
+type crBackend struct {
+	config   *rest.Config
+	client   dynamic.Interface
+	insecure bool
+}
+
+// newCRBackend connects to the cluster of a kubeconfig. The default loading
+// rules, $KUBECONFIG and ~/.kube/config, apply if kubeconfig is empty, and
+// the in-cluster config is used when there is no kubeconfig at all.
+func newCRBackend(kubeconfig string, insecure bool) (*crBackend, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &crBackend{config: config, client: client, insecure: insecure}, nil
+}
+
+func (b *crBackend) resource() dynamic.ResourceInterface {
+	return b.client.Resource(supportBundleGVR).Namespace(supportBundleNamespace)
+}
+
+// served reports whether the cluster serves the SupportBundle resource.
+func (b *crBackend) served(ctx context.Context) (bool, error) {
+	_, err := b.resource().List(ctx, metav1.ListOptions{Limit: 1})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// supportBundleObject returns a new SupportBundle resource.
+func supportBundleObject(req BundleRequest) *unstructured.Unstructured {
+	spec := req.Scope.Spec()
+	spec["issueURL"] = req.IssueURL
+	spec["description"] = req.Description
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": supportBundleGVR.GroupVersion().String(),
+		"kind":       "SupportBundle",
+		"metadata": map[string]interface{}{
+			"generateName": "bundle-",
+			"namespace":    supportBundleNamespace,
+		},
+		"spec": spec,
+	}}
+}
+
+// scopeApplied reports whether a created SupportBundle resource kept the
+// scope fields of its request. Servers that don't know them prune them.
+func scopeApplied(obj *unstructured.Unstructured, s scope.Scope) bool {
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	for field := range s.Spec() {
+		if _, ok := spec[field]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// version reads the server-version setting.
+func (b *crBackend) version(ctx context.Context) (string, error) {
+	setting, err := b.client.Resource(settingGVR).Get(ctx, "server-version", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, _, _ := unstructured.NestedString(setting.Object, "value")
+	if value == "" {
+		value, _, _ = unstructured.NestedString(setting.Object, "default")
+	}
+	if value == "" {
+		return "", errors.New("the server-version setting is empty")
+	}
+	return value, nil
+}
+
+func (b *crBackend) create(ctx context.Context, req BundleRequest) (*SupportBundleResource, error) {
+	created, err := b.resource().Create(ctx, supportBundleObject(req), metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sbr := bundleFromObject(created)
+	sbr.ScopeApplied = scopeApplied(created, req.Scope)
+	return sbr, nil
+}
+
+func (b *crBackend) get(ctx context.Context, sbr *SupportBundleResource) (*SupportBundleResource, error) {
+	obj, err := b.resource().Get(ctx, sbr.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return bundleFromObject(obj), nil
+}
+
+// list returns the SupportBundle resources of the namespace.
+func (b *crBackend) list(ctx context.Context) ([]*SupportBundleResource, error) {
+	objs, err := b.resource().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	bundles := make([]*SupportBundleResource, 0, len(objs.Items))
+	for i := range objs.Items {
+		bundles = append(bundles, bundleFromObject(&objs.Items[i]))
+	}
+	return bundles, nil
+}
+
+// watch gets the bundle, then watches it from that version. A watch closed by
+// the server, or too old to resume, starts over. The bundle is polled if it
+// can't be watched, e.g., without the permission to.
+func (b *crBackend) watch(ctx context.Context, sbr *SupportBundleResource, onUpdate func(*SupportBundleResource) (bool, error)) error {
+	for {
+		obj, err := b.resource().Get(ctx, sbr.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if done, err := onUpdate(bundleFromObject(obj)); done || err != nil {
+			return err
+		}
+		w, err := b.resource().Watch(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", sbr.Name).String(),
+			ResourceVersion: obj.GetResourceVersion(),
+		})
+		if err != nil {
+			get := func(ctx context.Context) (*SupportBundleResource, error) {
+				return b.get(ctx, sbr)
+			}
+			return poll(ctx, get, nil, onUpdate)
+		}
+		done, err := consumeWatch(ctx, w, sbr.Name, onUpdate)
+		w.Stop()
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// consumeWatch passes the bundles received from w to onUpdate. It returns
+// false without an error when the watch has to be started over.
+func consumeWatch(ctx context.Context, w watch.Interface, name string, onUpdate func(*SupportBundleResource) (bool, error)) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			switch e.Type {
+			case watch.Error:
+				err := apierrors.FromObject(e.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					return false, nil
+				}
+				return false, err
+			case watch.Deleted:
+				return false, fmt.Errorf("bundle %s was deleted", name)
+			}
+			obj, ok := e.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			if done, err := onUpdate(bundleFromObject(obj)); done || err != nil {
+				return done, err
+			}
+		}
+	}
+}
+
+// download saves the bundle from the URL advertised in its status, or from
+// the Harvester API through the API server. Only requests to the API server
+// carry the kubeconfig credentials.
+func (b *crBackend) download(ctx context.Context, sbr *SupportBundleResource, opts DownloadOptions) (string, error) {
+	host := strings.TrimSuffix(b.config.Host, "/")
+	url := sbr.DownloadURL
+	switch {
+	case url == "":
+		url = host + fmt.Sprintf(supportBundleDownloadPath, sbr.Name)
+	case strings.HasPrefix(url, "/"):
+		url = host + url
+	}
+
+	r := NewRESTClient(ctx, host, "", "", b.insecure)
+	if url == host || strings.HasPrefix(url, host+"/") {
+		transport, err := rest.TransportFor(b.config)
+		if err != nil {
+			return "", err
+		}
+		r.downloadClient = &http.Client{Transport: transport}
+	} else {
+		r.downloadClient = utils.NewHTTPClient(0, b.insecure)
+	}
+	return r.DownloadContext(ctx, url, opts)
+}
+
+func (b *crBackend) remove(ctx context.Context, sbr *SupportBundleResource) error {
+	err := b.resource().Delete(ctx, sbr.Name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// close does nothing, kubeconfig credentials need no session.
+func (b *crBackend) close(ctx context.Context) error {
+	return nil
+}
+
+// bundleFromObject maps a SupportBundle resource to the bundle of the REST
+// API. A failed condition is reported as an error even if the state isn't
+// updated yet.
+func bundleFromObject(obj *unstructured.Unstructured) *SupportBundleResource {
+	sbr := &SupportBundleResource{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		State:     BundleStateInProgress,
+	}
+	sbr.IssueURL, _, _ = unstructured.NestedString(obj.Object, "spec", "issueURL")
+	if created := obj.GetCreationTimestamp(); !created.IsZero() {
+		sbr.Created = created.UTC().Format(time.RFC3339)
+	}
+	progress, _, _ := unstructured.NestedInt64(obj.Object, "status", "progress")
+	sbr.ProgressPercentage = int(progress)
+	sbr.DownloadURL, _, _ = unstructured.NestedString(obj.Object, "status", "downloadURL")
+
+	state, _, _ := unstructured.NestedString(obj.Object, "status", "state")
+	switch state {
+	case crStateReady:
+		sbr.State = BundleStateReadyForDownload
+	case crStateError:
+		sbr.State = BundleStateError
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		status, _, _ := unstructured.NestedString(cond, "status")
+		message, _, _ := unstructured.NestedString(cond, "message")
+		if status == string(metav1.ConditionFalse) && message != "" {
+			sbr.State = BundleStateError
+			sbr.ErrorMessage = BundleError(message)
+		}
+	}
+	if sbr.State == BundleStateError && sbr.ErrorMessage == "" {
+		sbr.ErrorMessage = "unknown error"
+	}
+	return sbr
+}
@@ -0,0 +1,516 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// minChunkSize bounds the ranges of parallel downloads, smaller ranges
+	// cost more requests than they save.
+	minChunkSize = 4 * 1024 * 1024
+	// chunksPerConnection splits a file into more ranges than connections,
+	// so fast connections pick up the work of slow ones.
+	chunksPerConnection = 4
+	copyBufferSize      = 32 * 1024
+)
+
+// DownloadOptions controls where and how Download saves a file.
+type DownloadOptions struct {
+	// Path is the file path. The name sent by the server is used if empty.
+	Path string
+	// Dir is the directory relative paths and server supplied names are saved
+	// in.
+	Dir string
+	// DefaultName is used when the server doesn't send a name.
+	DefaultName string
+	// Force overwrites an existing file.
+	Force bool
+	// Writer receives the file instead of saving it when set.
+	Writer io.Writer
+	// Wrap, when set, wraps the saved file before the download is written to
+	// it, e.g., to encrypt it, and Suffix is appended to its path. The file is
+	// then downloaded over a single connection, in order.
+	Wrap   func(w io.Writer) (io.WriteCloser, error)
+	Suffix string
+
+	// Connections fetches byte ranges of the file over this many concurrent
+	// connections, if the server supports ranges.
+	Connections int
+	// Retries is the number of times a failed range is retried.
+	Retries int
+	// RateLimit caps the download rate in bytes per second when set.
+	RateLimit int64
+	// Progress is called as the file is received with the bytes received so
+	// far and the file size, or -1 if the size is unknown. It's not called
+	// concurrently.
+	Progress func(received, total int64)
+}
+
+// Download saves the file at url and returns its path. The file is written
+// to a temporary file renamed on success, so an interrupted download never
+// leaves a truncated file behind, and an existing file is not overwritten
+// unless Force is set.
+func (r *RESTClient) Download(url string, opts DownloadOptions) (string, error) {
+	return r.DownloadContext(r.context, url, opts)
+}
+
+// DownloadContext is Download with the context of the download.
+func (r *RESTClient) DownloadContext(ctx context.Context, url string, opts DownloadOptions) (string, error) {
+	parallel := opts.Connections > 1 && opts.Writer == nil && opts.Wrap == nil
+	var header http.Header
+	if parallel {
+		// Probe for range support, the size of the file comes with the
+		// Content-Range.
+		header = http.Header{"Range": {"bytes=0-0"}}
+	}
+	resp, err := r.download(ctx, url, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	d := &downloader{
+		r:       r,
+		ctx:     ctx,
+		url:     url,
+		opts:    opts,
+		limiter: newRateLimiter(opts.RateLimit),
+		total:   resp.ContentLength,
+	}
+	if opts.Writer != nil {
+		_, err = d.copy(ctx, opts.Writer, resp.Body)
+		return "", err
+	}
+
+	path, err := opts.path(resp.Header.Get("Content-Disposition"))
+	if err != nil {
+		return "", err
+	}
+	path += opts.Suffix
+	if resp.StatusCode == http.StatusPartialContent {
+		total, ok := contentRangeSize(resp.Header.Get("Content-Range"))
+		if ok {
+			d.total = total
+			d.validator = resp.Header.Get("ETag")
+			if d.validator == "" {
+				d.validator = resp.Header.Get("Last-Modified")
+			}
+			return path, saveFile(path, opts.Force, d.fetchRanges)
+		}
+		// The size is unknown, start over with a single stream.
+		resp.Body.Close()
+		if resp, err = r.download(ctx, url, nil); err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		d.total = resp.ContentLength
+	}
+	return path, saveFile(path, opts.Force, func(f *os.File) error {
+		if opts.Wrap == nil {
+			_, err := d.copy(ctx, f, resp.Body)
+			return err
+		}
+		w, err := opts.Wrap(f)
+		if err != nil {
+			return err
+		}
+		if _, err := d.copy(ctx, w, resp.Body); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// download sends a GET request for url and checks the response status. The
+// request is sent again once with a new token if the token has expired.
+func (r *RESTClient) download(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	token := r.getToken()
+	resp, err := r.get(ctx, url, header, token)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && r.canReauthenticate(http.MethodGet, token) {
+		resp.Body.Close()
+		if err := r.reauthenticate(ctx, token); err != nil {
+			return nil, fmt.Errorf("fail to re-authenticate: %s", err)
+		}
+		resp, err = r.get(ctx, url, header, r.getToken())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+func (r *RESTClient) get(ctx context.Context, url string, header http.Header, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r.authorize(req.Header, token)
+	return r.downloadClient.Do(req)
+}
+
+// path returns the path to save a file to.
+func (opts *DownloadOptions) path(disposition string) (string, error) {
+	path := opts.Path
+	if path == "" {
+		name, err := getFilename(disposition)
+		if err != nil && opts.DefaultName == "" {
+			return "", fmt.Errorf("fail to parse filename from response header: %s", err)
+		}
+		if name == "" {
+			name = SanitizeFilename(opts.DefaultName)
+		}
+		if name == "" {
+			return "", fmt.Errorf("invalid file name %q", opts.DefaultName)
+		}
+		path = name
+	}
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(opts.Dir, path)
+		}
+	}
+	return path, nil
+}
+
+// saveFile calls write with a temporary file next to path and moves it to
+// path once complete.
+func saveFile(path string, force bool, write func(f *os.File) error) error {
+	if !force {
+		if _, err := os.Lstat(path); err == nil {
+			return &os.PathError{Op: "create", Path: path, Err: os.ErrExist}
+		}
+	}
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	// The temporary file is hidden and only readable by the user, bundles
+	// hold sensitive cluster data.
+	f, err := ioutil.TempFile(dir, "."+base+".*.part")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if force {
+		return os.Rename(tmp, path)
+	}
+	// A hard link fails if path was created in the meantime, unlike a
+	// rename. Not every file system supports links though.
+	err = os.Link(tmp, path)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return &os.PathError{Op: "create", Path: path, Err: os.ErrExist}
+	}
+	return os.Rename(tmp, path)
+}
+
+// downloader fetches a file, possibly in ranges over several connections.
+type downloader struct {
+	r    *RESTClient
+	ctx  context.Context
+	url  string
+	opts DownloadOptions
+	// validator is the ETag or modification time of the file, ranges of a
+	// file changed in the meantime are refused.
+	validator string
+	limiter   *rateLimiter
+
+	mu       sync.Mutex
+	total    int64
+	received int64
+}
+
+// fetchRanges downloads the file in ranges written at their offset in f.
+func (d *downloader) fetchRanges(f *os.File) error {
+	if err := f.Truncate(d.total); err != nil {
+		return err
+	}
+	connections := d.opts.Connections
+	chunkSize := d.total / int64(connections*chunksPerConnection)
+	if chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	ranges := make(chan [2]int64)
+	errs := make(chan error, connections)
+	var wg sync.WaitGroup
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rg := range ranges {
+				if err := d.fetchRange(ctx, f, rg[0], rg[1]); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+send:
+	for start := int64(0); start < d.total; start += chunkSize {
+		end := start + chunkSize - 1
+		if end >= d.total {
+			end = d.total - 1
+		}
+		select {
+		case ranges <- [2]int64{start, end}:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(ranges)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+	return d.ctx.Err()
+}
+
+// fetchRange downloads the bytes from start to end, inclusive, retrying from
+// where a failed attempt stopped.
+func (d *downloader) fetchRange(ctx context.Context, f *os.File, start, end int64) error {
+	var err error
+	for attempt := 0; attempt <= d.opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		var n int64
+		n, err = d.fetchPart(ctx, f, start, end)
+		start += n
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("fail to download bytes %d-%d: %s", start, end, err)
+}
+
+func (d *downloader) fetchPart(ctx context.Context, f *os.File, start, end int64) (int64, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, end)}}
+	if d.validator != "" {
+		header.Set("If-Range", d.validator)
+	}
+	resp, err := d.r.download(ctx, d.url, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent ||
+		!strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", start)) {
+		return 0, errors.New("the file changed or the server ignored the range")
+	}
+
+	size := end - start + 1
+	n, err := d.copy(ctx, &offsetWriter{f: f, off: start}, io.LimitReader(resp.Body, size))
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// copy copies r to w at the rate limit and reports the progress.
+func (d *downloader) copy(ctx context.Context, w io.Writer, r io.Reader) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	var written int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := d.limiter.wait(ctx, n); err != nil {
+				return written, err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+			d.progress(int64(n))
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+func (d *downloader) progress(n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.received += n
+	if d.opts.Progress != nil {
+		d.opts.Progress(d.received, d.total)
+	}
+}
+
+// offsetWriter writes to a file sequentially from an offset.
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// rateLimiter spreads reads over time to stay under a rate shared by all
+// connections. A nil rateLimiter doesn't limit.
+type rateLimiter struct {
+	rate int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate}
+}
+
+// wait blocks until n more bytes can be read.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var contentRange = regexp.MustCompile(`^bytes \d+-\d+/(\d+)$`)
+
+// contentRangeSize returns the complete length in a Content-Range header,
+// e.g., 1234 from "bytes 0-0/1234".
+func contentRangeSize(value string) (int64, bool) {
+	m := contentRange.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(m[1], 10, 64)
+	return size, err == nil && size > 0
+}
+
+// getFilename returns the sanitized file name of a "Content-Disposition"
+// header as defined by RFC 6266, e.g., "abc.zip" from either of
+//
+//	attachment; filename=abc.zip
+//	attachment; filename*=UTF-8''%C3%A4bc.zip; filename=abc.zip
+//
+// The extended filename* parameter takes precedence, it's decoded by
+// mime.ParseMediaType.
+func getFilename(disposition string) (string, error) {
+	errMsg := fmt.Errorf("unexpected disposition value: %s", disposition)
+
+	dispositionType, params, err := mime.ParseMediaType(disposition)
+	if err != nil || (dispositionType != "attachment" && dispositionType != "inline") {
+		return "", errMsg
+	}
+	filename := SanitizeFilename(params["filename"])
+	if filename == "" {
+		return "", errMsg
+	}
+	return filename, nil
+}
+
+const maxFilenameSize = 255
+
+// SanitizeFilename makes a server supplied name safe to use as a file name in
+// the current directory. Directories are stripped, so are control characters,
+// characters reserved on Windows, and leading dots to not create hidden files.
+// It returns "" if nothing is left.
+func SanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError:
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(name, ". ")
+	name = strings.TrimRight(name, ". ")
+	if len(name) > maxFilenameSize {
+		ext := filepath.Ext(name)
+		if len(ext) > maxFilenameSize/2 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:maxFilenameSize-len(ext)], "") + ext
+	}
+	return name
+}
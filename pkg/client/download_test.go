@@ -0,0 +1,356 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetFilename(t *testing.T) {
+	tests := []struct {
+		disposition string
+		want        string
+		wantErr     bool
+	}{
+		{disposition: "attachment; filename=abc.zip", want: "abc.zip"},
+		{disposition: `attachment; filename="a b.zip"`, want: "a b.zip"},
+		{disposition: `inline; filename="abc.zip"`, want: "abc.zip"},
+		{disposition: `Attachment; FILENAME="abc.zip"`, want: "abc.zip"},
+		{disposition: `attachment; filename*=UTF-8''%C3%A4bc.zip; filename=abc.zip`, want: "äbc.zip"},
+		{disposition: `attachment; filename=abc.zip; filename*=UTF-8''%C3%A4bc.zip`, want: "äbc.zip"},
+		{disposition: `attachment; filename="../../etc/passwd"`, want: "passwd"},
+		{disposition: `attachment; filename="..\\..\\evil.zip"`, want: "evil.zip"},
+		{disposition: `attachment; filename="/tmp/abs.zip"`, want: "abs.zip"},
+		{disposition: `attachment; filename=".hidden.zip"`, want: "hidden.zip"},
+		{disposition: `attachment; filename="a:b?.zip"`, want: "a_b_.zip"},
+		{disposition: `attachment; filename*=UTF-8''%2E%2E%2Fx.zip`, want: "x.zip"},
+		{disposition: `attachment; filename=".."`, wantErr: true},
+		{disposition: `attachment; filename="../"`, wantErr: true},
+		{disposition: "attachment", wantErr: true},
+		{disposition: "form-data; filename=abc.zip", wantErr: true},
+		{disposition: "", wantErr: true},
+		{disposition: `attachment; filename="unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.disposition, func(t *testing.T) {
+			got, err := getFilename(tt.disposition)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "bundle.zip", "bundle.zip"},
+		{"directories", "a/b/bundle.zip", "bundle.zip"},
+		{"windows directories", `C:\a\bundle.zip`, "bundle.zip"},
+		{"parent", "../bundle.zip", "bundle.zip"},
+		{"only dots", "...", ""},
+		{"leading dots", "..bundle.zip", "bundle.zip"},
+		{"trailing dots and spaces", "bundle.zip. . ", "bundle.zip"},
+		{"control characters", "bun\x00dle\n.zip", "bundle.zip"},
+		{"reserved characters", `b<u>n:d"l|e?*.zip`, "b_u_n_d_l_e__.zip"},
+		{"invalid UTF-8", "bun\xffdle.zip", "bundle.zip"},
+		{"empty", "", ""},
+		{"long", long + ".zip", long[:maxFilenameSize-4] + ".zip"},
+		{"long extension", "a." + long, ("a." + long)[:maxFilenameSize]},
+		{"long multibyte", strings.Repeat("ä", 200), strings.Repeat("ä", maxFilenameSize/2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeFilename(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	errWrite := errors.New("write failed")
+	write := func(data string) func(f *os.File) error {
+		return func(f *os.File) error {
+			_, err := f.WriteString(data)
+			return err
+		}
+	}
+	tests := []struct {
+		name     string
+		existing bool
+		force    bool
+		write    func(f *os.File) error
+		wantErr  error
+		want     string
+	}{
+		{"new", false, false, write("new"), nil, "new"},
+		{"existing", true, false, write("new"), os.ErrExist, "old"},
+		{"forced", true, true, write("new"), nil, "new"},
+		{"failed", false, false, func(f *os.File) error { f.WriteString("partial"); return errWrite }, errWrite, ""},
+		{"failed forced", true, true, func(f *os.File) error { f.WriteString("partial"); return errWrite }, errWrite, "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "download")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "bundle.zip")
+			if tt.existing {
+				if err := ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = saveFile(path, tt.force, tt.write)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			data, err := ioutil.ReadFile(path)
+			if tt.want == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("got a file after a failed download")
+				}
+			} else if string(data) != tt.want {
+				t.Errorf("got %q, want %q", data, tt.want)
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, ".*.part")); len(files) > 0 {
+				t.Errorf("temporary files are left: %v", files)
+			}
+		})
+	}
+}
+
+func TestDownloadPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        DownloadOptions
+		disposition string
+		want        string
+		wantErr     bool
+	}{
+		{"from server", DownloadOptions{}, "attachment; filename=sb.zip", "sb.zip", false},
+		{"in dir", DownloadOptions{Dir: "out"}, `attachment; filename="../sb.zip"`, filepath.Join("out", "sb.zip"), false},
+		{"explicit path", DownloadOptions{Path: "my.zip", Dir: "out"}, "attachment; filename=sb.zip", filepath.Join("out", "my.zip"), false},
+		{"absolute path", DownloadOptions{Path: "/tmp/my.zip", Dir: "out"}, "", "/tmp/my.zip", false},
+		{"default name", DownloadOptions{DefaultName: "bundle-1.zip"}, "", "bundle-1.zip", false},
+		{"unsafe default name", DownloadOptions{DefaultName: "../bundle-1.zip"}, "", "bundle-1.zip", false},
+		{"invalid default name", DownloadOptions{DefaultName: ".."}, "", "", true},
+		{"no name", DownloadOptions{}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "download")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			opts := tt.opts
+			want := tt.want
+			if opts.Dir != "" {
+				opts.Dir = filepath.Join(dir, opts.Dir)
+				if !filepath.IsAbs(want) {
+					want = filepath.Join(dir, want)
+				}
+			}
+
+			got, err := opts.path(tt.disposition)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// rangeServer serves data, with range support if ranges is set. fail, when
+// set, is called for every range request and returns how many bytes of the
+// range to send before the connection is cut, or -1 to send it all. ignored
+// answers range requests with the whole file.
+type rangeServer struct {
+	data    []byte
+	ranges  bool
+	ignored bool
+
+	mu     sync.Mutex
+	etag   string
+	fail   func(start int64) int
+	starts []int64
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rg := r.Header.Get("Range")
+	if rg != "" && rg != "bytes=0-0" {
+		var start, end int64
+		fmt.Sscanf(rg, "bytes=%d-%d", &start, &end)
+		s.mu.Lock()
+		s.starts = append(s.starts, start)
+		n := -1
+		if s.fail != nil {
+			n = s.fail(start)
+		}
+		s.mu.Unlock()
+		if s.ignored {
+			w.Write(s.data)
+			return
+		}
+		if n >= 0 {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(s.data)))
+			w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(s.data[start : start+int64(n)])
+			// Returning short of Content-Length cuts the connection.
+			return
+		}
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=bundle.zip")
+	if !s.ranges {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.data)))
+		w.Write(s.data)
+		return
+	}
+	s.mu.Lock()
+	w.Header().Set("ETag", s.etag)
+	s.mu.Unlock()
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.data))
+}
+
+func TestDownloadRanges(t *testing.T) {
+	size := 3*minChunkSize + 12345
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		ranges      bool
+		connections int
+		retries     int
+		fail        func(start int64) int
+		ignored     bool
+		etag        string
+		// wantStarts are the range requests expected, in any order.
+		wantStarts []int64
+		wantErr    bool
+	}{
+		{name: "single stream", ranges: false, connections: 4},
+		{name: "no ranges", ranges: true, connections: 1},
+		{name: "ranges", ranges: true, connections: 3,
+			wantStarts: []int64{0, minChunkSize, 2 * minChunkSize, 3 * minChunkSize}},
+		{name: "more connections than ranges", ranges: true, connections: 16,
+			wantStarts: []int64{0, minChunkSize, 2 * minChunkSize, 3 * minChunkSize}},
+		{name: "retry resumes the range", ranges: true, connections: 2, retries: 2,
+			fail: failOnce(minChunkSize, 1000),
+			// The retry continues where the cut connection stopped.
+			wantStarts: []int64{0, minChunkSize, minChunkSize + 1000, 2 * minChunkSize, 3 * minChunkSize}},
+		{name: "retry from the start of the range", ranges: true, connections: 2, retries: 1,
+			fail:       failOnce(2*minChunkSize, 0),
+			wantStarts: []int64{0, minChunkSize, 2 * minChunkSize, 2 * minChunkSize, 3 * minChunkSize}},
+		{name: "no retries", ranges: true, connections: 2, retries: 0,
+			fail: failOnce(minChunkSize, 1000), wantErr: true},
+		{name: "range ignored", ranges: true, connections: 2, ignored: true, wantErr: true},
+		{name: "file changed", ranges: true, connections: 2, etag: `"changed"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "download")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			s := &rangeServer{data: data, etag: `"v1"`, ranges: tt.ranges, fail: tt.fail, ignored: tt.ignored}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+			if tt.etag != "" {
+				// The ETag changes once the probe is answered.
+				probe := s.fail
+				s.fail = func(start int64) int {
+					s.etag = tt.etag
+					if probe != nil {
+						return probe(start)
+					}
+					return -1
+				}
+			}
+
+			var received, total int64
+			r := NewRESTClient(context.Background(), ts.URL, "", "", false)
+			path, err := r.Download(ts.URL, DownloadOptions{
+				Dir:         dir,
+				Connections: tt.connections,
+				Retries:     tt.retries,
+				Progress: func(r, t int64) {
+					received, total = r, t
+				},
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				if files, _ := ioutil.ReadDir(dir); len(files) > 0 {
+					t.Errorf("a failed download left %s", files[0].Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("downloaded file differs")
+			}
+			if total != int64(size) {
+				t.Errorf("got total %d, want %d", total, size)
+			}
+			if received < int64(size) {
+				t.Errorf("got %d bytes received, want at least %d", received, size)
+			}
+
+			sort.Slice(s.starts, func(i, j int) bool { return s.starts[i] < s.starts[j] })
+			if fmt.Sprint(s.starts) != fmt.Sprint(tt.wantStarts) {
+				t.Errorf("got range requests at %v, want %v", s.starts, tt.wantStarts)
+			}
+		})
+	}
+}
+
+// failOnce cuts the first request of the range at start after n bytes.
+func failOnce(start int64, n int) func(int64) int {
+	failed := false
+	return func(s int64) int {
+		if s == start && !failed {
+			failed = true
+			return n
+		}
+		return -1
+	}
+}
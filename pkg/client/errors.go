@@ -0,0 +1,50 @@
+package client
+
+import (
+	"fmt"
+)
+
+// OptionError is returned by New for an invalid option.
+type OptionError struct {
+	Option string
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Option, e.Reason)
+}
+
+// ConnectError is returned by New when it fails to reach the cluster or to
+// log in to it. Step is what failed, e.g., "login".
+type ConnectError struct {
+	Step string
+	Err  error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("fail to %s: %s", e.Step, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// GenerationError is returned by Wait when the server fails to generate a
+// bundle.
+type GenerationError struct {
+	Bundle  string
+	Message string
+}
+
+func (e *GenerationError) Error() string {
+	return fmt.Sprintf("bundle generation failed: %s", e.Message)
+}
+
+// NotFoundError is returned when a bundle doesn't exist on the cluster.
+type NotFoundError struct {
+	Bundle string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("bundle %s is not found", e.Bundle)
+}
@@ -0,0 +1,56 @@
+package client
+
+// EventType is the kind of an Event.
+type EventType string
+
+const (
+	// EventConnected is sent by New once the session is started, with the
+	// Harvester version if it's known.
+	EventConnected = EventType("connected")
+	// EventWarning reports a problem that doesn't stop the client, e.g., a
+	// fallback to the REST API or an untested Harvester version.
+	EventWarning = EventType("warning")
+	// EventCreated is sent when a bundle is created.
+	EventCreated = EventType("created")
+	// EventProgress is sent by Wait each time the bundle is updated.
+	EventProgress = EventType("progress")
+	// EventReady is sent by Wait when the bundle is ready for download.
+	EventReady = EventType("ready")
+	// EventDownloading is sent by Download as the bundle is received.
+	EventDownloading = EventType("downloading")
+	// EventDownloaded is sent by Download when the bundle is received.
+	EventDownloaded = EventType("downloaded")
+	// EventDeleted is sent when a bundle is deleted from the cluster.
+	EventDeleted = EventType("deleted")
+)
+
+// Event is something that happened to a bundle or to the session.
+type Event struct {
+	Type EventType
+	// Bundle is the bundle the event is about, if any.
+	Bundle *SupportBundleResource
+	// Version is the Harvester version of EventConnected.
+	Version string
+	// Received and Total are the bytes received so far and the size of the
+	// bundle, or -1 if unknown, of EventDownloading.
+	Received int64
+	Total    int64
+	// Path is where EventDownloaded saved the bundle, empty if it was written
+	// to DownloadOptions.Writer.
+	Path string
+	// Message explains EventWarning.
+	Message string
+}
+
+// Observer receives the events of a Client. Events are not sent
+// concurrently, and the Client waits for Observe to return.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc is an Observer function.
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
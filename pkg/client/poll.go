@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	minPollInterval = 5 * time.Second
+	maxPollInterval = 30 * time.Second
+)
+
+// poll gets a bundle until onUpdate is done or fails. The interval doubles up
+// to maxPollInterval while the bundle stays in the same state, and is reset
+// when the state changes. Progress alone doesn't reset it, it changes on
+// almost every poll. A value from changes polls at once, a closed changes
+// leaves polling on its own.
+func poll(ctx context.Context, get func(ctx context.Context) (*SupportBundleResource, error), changes <-chan struct{}, onUpdate func(*SupportBundleResource) (bool, error)) error {
+	interval := minPollInterval
+	var state BundleState
+	for {
+		sbr, err := get(ctx)
+		if err != nil {
+			return err
+		}
+		if done, err := onUpdate(sbr); done || err != nil {
+			return err
+		}
+		if sbr.State != state {
+			state = sbr.State
+			interval = minPollInterval
+		} else {
+			interval *= 2
+			if interval > maxPollInterval {
+				interval = maxPollInterval
+			}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		case _, ok := <-changes:
+			timer.Stop()
+			if !ok {
+				changes = nil
+			}
+		}
+	}
+}
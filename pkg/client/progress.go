@@ -0,0 +1,90 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+const (
+	progressInterval = 500 * time.Millisecond
+	// rateSmoothing weighs the latest throughput against the average, so the
+	// ETA doesn't jump around.
+	rateSmoothing = 0.3
+)
+
+// progressPrinter reports the progress of a download with the throughput
+// and the remaining time. The progress line is only printed on terminals,
+// logs only get the summary.
+type progressPrinter struct {
+	out      io.Writer
+	terminal bool
+
+	start     time.Time
+	last      time.Time
+	lastBytes int64
+	rate      float64
+	received  int64
+}
+
+func newProgressPrinter(out io.Writer) *progressPrinter {
+	p := &progressPrinter{out: out}
+	if f, ok := out.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			p.terminal = true
+		}
+	}
+	return p
+}
+
+func (p *progressPrinter) update(received, total int64) {
+	now := time.Now()
+	p.received = received
+	if p.start.IsZero() {
+		p.start, p.last = now, now
+		return
+	}
+	elapsed := now.Sub(p.last)
+	if elapsed < progressInterval {
+		return
+	}
+	rate := float64(received-p.lastBytes) / elapsed.Seconds()
+	if p.rate == 0 {
+		p.rate = rate
+	} else {
+		p.rate = rateSmoothing*rate + (1-rateSmoothing)*p.rate
+	}
+	p.last, p.lastBytes = now, received
+	if !p.terminal {
+		return
+	}
+
+	line := fmt.Sprintf("downloading %s", utils.FormatSize(received))
+	if total > 0 {
+		line += fmt.Sprintf(" / %s (%d%%)", utils.FormatSize(total), received*100/total)
+	}
+	line += fmt.Sprintf(", %s/s", utils.FormatSize(int64(p.rate)))
+	if total > 0 && p.rate > 0 {
+		eta := time.Duration(float64(total-received) / p.rate * float64(time.Second))
+		line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	// pad to clear a longer previous line
+	fmt.Fprintf(p.out, "\r%-70s", line)
+}
+
+// done ends the progress line and prints the summary of a completed
+// download.
+func (p *progressPrinter) done(completed bool) {
+	if p.terminal && !p.last.Equal(p.start) {
+		fmt.Fprintln(p.out)
+	}
+	if !completed || p.start.IsZero() {
+		return
+	}
+	elapsed := time.Since(p.start)
+	rate := int64(float64(p.received) / elapsed.Seconds())
+	fmt.Fprintf(p.out, "downloaded %s in %s (%s/s)\n", utils.FormatSize(p.received), elapsed.Round(time.Second), utils.FormatSize(rate))
+}
@@ -3,16 +3,15 @@ package client
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
-	"strings"
+	"sync"
 	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
 )
 
 const (
@@ -20,6 +19,9 @@ const (
 	HarvesterURLAuthLogout = "/v1-public/auth?action=logout"
 )
 
+// TokenSource returns a new API token when the current one expires.
+type TokenSource func(ctx context.Context) (string, error)
+
 type RESTClient struct {
 	context  context.Context
 	apiURL   string
@@ -27,8 +29,33 @@ type RESTClient struct {
 	password string
 	insecure bool
 
+	// TokenSource refreshes an expired token when set, instead of logging in
+	// again with the username and password.
+	TokenSource TokenSource
+
 	httpClient *http.Client
-	token      string
+	// downloadClient has no timeout, downloads of big bundles take long.
+	downloadClient *http.Client
+
+	// authMu serializes re-authentication, mu guards the token.
+	authMu sync.Mutex
+	mu     sync.Mutex
+	token  string
+	// bearer sends the token in the Authorization header.
+	bearer bool
+	// compat is the API shape of the server, nil until it's known.
+	compat *Compatibility
+}
+
+// StatusError is returned for responses with a status other than 200.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %s. Body: %s", e.Status, bytes.TrimSpace(e.Body))
 }
 
 type JWTAuthRequest struct {
@@ -40,56 +67,141 @@ type JWTAuthResponse struct {
 	JWEToken string `json:"jweToken"`
 }
 
+type RancherAuthRequest struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	ResponseType string `json:"responseType"`
+}
+
+type RancherAuthResponse struct {
+	Token string `json:"token"`
+}
+
 func NewRESTClient(ctx context.Context, apiURL string, username string, password string, insecure bool) *RESTClient {
-	httpClient := http.Client{
-		Timeout: 15 * time.Second,
-	}
-	if insecure {
-		httpClient.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		}
-	}
 	return &RESTClient{
-		context:    ctx,
-		apiURL:     apiURL,
-		username:   username,
-		password:   password,
-		insecure:   insecure,
-		httpClient: &httpClient,
+		context:        ctx,
+		apiURL:         apiURL,
+		username:       username,
+		password:       password,
+		insecure:       insecure,
+		httpClient:     utils.NewHTTPClient(15*time.Second, insecure),
+		downloadClient: utils.NewHTTPClient(0, insecure),
 	}
 }
 
+// SetBearerToken authenticates requests with an API token, e.g., a Rancher
+// API token, instead of logging in.
+func (r *RESTClient) SetBearerToken(token string) {
+	r.bearer = true
+	r.setToken(token)
+}
+
 func (r *RESTClient) Login() error {
-	auth := JWTAuthRequest{Username: r.username, Password: r.password}
-	data, err := json.Marshal(auth)
+	return r.LoginContext(r.context)
+}
+
+// LoginContext is Login with the context of the login requests.
+func (r *RESTClient) LoginContext(ctx context.Context) error {
+	token, err := r.login(ctx)
 	if err != nil {
 		return err
 	}
-	resp, err := r.Post(r.apiURL+HarvesterURLAuthLogin, data)
+	r.setToken(token)
+	return nil
+}
+
+// SetCompatibility sets the API shape of the server, see CompatibilityFor.
+func (r *RESTClient) SetCompatibility(compat Compatibility) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compat = &compat
+}
+
+// Compatibility returns the API shape of the server, and whether it's known.
+// The oldest API of the compatibility table is returned if it's not.
+func (r *RESTClient) Compatibility() (Compatibility, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.compat == nil {
+		return Compatibilities[0], false
+	}
+	return *r.compat, true
+}
+
+// login logs in with the auth flow of the server. If the API shape isn't
+// known yet, the auth flows of the compatibility table are tried, newest
+// first, until one succeeds. The error of the first flow served is returned
+// if none does.
+func (r *RESTClient) login(ctx context.Context) (string, error) {
+	if compat, ok := r.Compatibility(); ok {
+		return r.loginWith(ctx, compat)
+	}
+	var served error
+	var err error
+	for i := len(Compatibilities) - 1; i >= 0; i-- {
+		var token string
+		token, err = r.loginWith(ctx, Compatibilities[i])
+		if err == nil {
+			r.SetCompatibility(Compatibilities[i])
+			return token, nil
+		}
+		var statusErr *StatusError
+		if served == nil && !(errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound) {
+			served = err
+		}
+	}
+	if served != nil {
+		return "", served
+	}
+	return "", err
+}
+
+func (r *RESTClient) loginWith(ctx context.Context, compat Compatibility) (string, error) {
+	var auth interface{} = JWTAuthRequest{Username: r.username, Password: r.password}
+	if compat.Auth == AuthRancher {
+		auth = RancherAuthRequest{Username: r.username, Password: r.password, ResponseType: "json"}
+	}
+	data, err := json.Marshal(auth)
 	if err != nil {
-		return err
+		return "", err
+	}
+	resp, _, err := r.doContext(ctx, http.MethodPost, r.apiURL+compat.LoginPath, data, "")
+	if err != nil {
+		return "", err
 	}
 
+	if compat.Auth == AuthRancher {
+		var authResp RancherAuthResponse
+		err = json.Unmarshal(resp, &authResp)
+		return authResp.Token, err
+	}
 	var authResp JWTAuthResponse
 	err = json.Unmarshal(resp, &authResp)
 	if err != nil {
-		return err
+		return "", err
 	}
-	r.token = authResp.JWEToken
-	return nil
+	return authResp.JWEToken, nil
 }
 
+// Logout ends the session. It's best-effort: nothing is done without a
+// session, and an expired session is as good as ended.
 func (r *RESTClient) Logout() error {
-	if r.token == "" {
-		return errors.New("not login")
+	return r.LogoutContext(r.context)
+}
+
+// LogoutContext is Logout with the context of the logout request.
+func (r *RESTClient) LogoutContext(ctx context.Context) error {
+	token := r.getToken()
+	if token == "" || r.bearer {
+		return nil
 	}
-	_, err := r.Post(r.apiURL+HarvesterURLAuthLogout, nil)
-	if err != nil {
-		return err
+	r.setToken("")
+	compat, _ := r.Compatibility()
+	_, status, err := r.doContext(ctx, http.MethodPost, r.apiURL+compat.LogoutPath, nil, token)
+	if status == http.StatusUnauthorized {
+		return nil
 	}
-	return nil
+	return err
 }
 
 func (r *RESTClient) Get(url string) ([]byte, error) {
@@ -100,96 +212,112 @@ func (r *RESTClient) Post(url string, data []byte) ([]byte, error) {
 	return r.Request(http.MethodPost, url, data)
 }
 
+// Request sends a request with the session token. If the token has expired,
+// idempotent requests are sent again once after re-authenticating.
 func (r *RESTClient) Request(method string, url string, data []byte) ([]byte, error) {
-	req, err := http.NewRequestWithContext(r.context, method, url, bytes.NewBuffer(data))
+	return r.RequestContext(r.context, method, url, data)
+}
+
+// RequestContext is Request with the context of the request.
+func (r *RESTClient) RequestContext(ctx context.Context, method string, url string, data []byte) ([]byte, error) {
+	token := r.getToken()
+	respBody, status, err := r.doContext(ctx, method, url, data, token)
+	if status == http.StatusUnauthorized && r.canReauthenticate(method, token) {
+		if err := r.reauthenticate(ctx, token); err != nil {
+			return nil, fmt.Errorf("fail to re-authenticate: %s", err)
+		}
+		respBody, _, err = r.doContext(ctx, method, url, data, r.getToken())
+	}
+	return respBody, err
+}
+
+// doContext sends a request and returns the response body and status.
+// Statuses other than 200 are returned with an error.
+func (r *RESTClient) doContext(ctx context.Context, method string, url string, data []byte, token string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(data))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if data != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	if r.token != "" {
-		req.Header.Set("jweToken", r.token)
-	}
+	r.authorize(req.Header, token)
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, resp.StatusCode, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %s. Body: %s", resp.Status, respBody)
+		return nil, resp.StatusCode, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: respBody}
 	}
-	return respBody, nil
+	return respBody, resp.StatusCode, nil
 }
 
-func (r *RESTClient) Download(url string, path string) (string, error) {
-	req, err := http.NewRequestWithContext(r.context, http.MethodGet, url, nil)
-	if err != nil {
-		return "", err
+// canReauthenticate reports whether a request rejected with token can be
+// sent again with a new token. Requests that may have had an effect are not.
+func (r *RESTClient) canReauthenticate(method string, token string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+	default:
+		return false
 	}
-	if r.token != "" {
-		req.Header.Set("jweToken", r.token)
+	if r.TokenSource != nil {
+		return token != ""
 	}
+	return token != "" && !r.bearer && r.username != ""
+}
 
-	resp, err := r.httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+// reauthenticate replaces an expired token. Concurrent requests rejected with
+// the same token only re-authenticate once. ctx is the context of the
+// rejected request.
+func (r *RESTClient) reauthenticate(ctx context.Context, expired string) error {
+	r.authMu.Lock()
+	defer r.authMu.Unlock()
+	if r.getToken() != expired {
+		return nil
 	}
 
-	filename := path
-	if filename == "" {
-		filename, err = r.getFilename(resp.Header.Get("Content-Disposition"))
-		if err != nil {
-			return "", fmt.Errorf("fail to parse filename from response header: %s", err)
-		}
+	var token string
+	var err error
+	if r.TokenSource != nil {
+		token, err = r.TokenSource(ctx)
+	} else {
+		token, err = r.login(ctx)
 	}
-
-	f, err := os.Create(filename)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer f.Close()
-
-	_, err = io.Copy(f, resp.Body)
-	return filename, err
+	r.setToken(token)
+	return nil
 }
 
-// getFilename parse value of "Content-Disposition" header
-// e.g., extract "abc.zip" from "attachment; filename=abc.zip"
-func (r *RESTClient) getFilename(disposition string) (string, error) {
-	errMsg := fmt.Errorf("unexpected disposition value: %s", disposition)
-
-	if disposition == "" {
-		return "", errMsg
+func (r *RESTClient) authorize(header http.Header, token string) {
+	compat, _ := r.Compatibility()
+	switch {
+	case token == "":
+	case r.bearer || compat.Auth == AuthRancher:
+		header.Set("Authorization", "Bearer "+token)
+	default:
+		header.Set("jweToken", token)
 	}
+}
 
-	var attachement bool
-	var filename string
-
-	for _, param := range strings.Split(disposition, ";") {
-		p := strings.TrimSpace(param)
-		if p == "attachment" {
-			attachement = true
-		}
+func (r *RESTClient) getToken() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.token
+}
 
-		if strings.HasPrefix(p, "filename=") {
-			filename = strings.Trim(strings.SplitN(p, "filename=", 2)[1], "\"")
-		}
-	}
-	if attachement && filename != "" {
-		return filename, nil
-	}
-	return "", errMsg
+func (r *RESTClient) setToken(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.token = token
 }
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// authServer issues a new JWE token at every login and only accepts the
+// latest one until it expires.
+type authServer struct {
+	mu     sync.Mutex
+	logins int
+	valid  string
+	// failLogin rejects the logins after the first one.
+	failLogin bool
+}
+
+func (s *authServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path == "/v1-public/auth" {
+		if s.failLogin && s.logins > 0 {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		s.logins++
+		s.valid = fmt.Sprintf("token-%d", s.logins)
+		fmt.Fprintf(w, `{"jweToken":%q}`, s.valid)
+		return
+	}
+	if r.Header.Get("jweToken") != s.valid || s.valid == "" {
+		http.Error(w, "token expired", http.StatusUnauthorized)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func (s *authServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.valid = ""
+}
+
+func TestReauthenticate(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		failLogin  bool
+		wantLogins int
+		wantErr    string
+	}{
+		{name: "get replayed", method: http.MethodGet, wantLogins: 2},
+		{name: "delete replayed", method: http.MethodDelete, wantLogins: 2},
+		{name: "post not replayed", method: http.MethodPost, wantLogins: 1, wantErr: "token expired"},
+		{name: "login fails", method: http.MethodGet, failLogin: true, wantLogins: 1, wantErr: "fail to re-authenticate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &authServer{failLogin: tt.failLogin}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			// The client context has ended, re-authenticating uses the
+			// context of the request.
+			ctx, cancel := context.WithCancel(context.Background())
+			r := NewRESTClient(ctx, ts.URL, "admin", "password", false)
+			r.SetCompatibility(Compatibilities[0])
+			if err := r.Login(); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			s.expire()
+
+			body, err := r.RequestContext(context.Background(), tt.method, ts.URL+"/v1/things", nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil || string(body) != "ok" {
+				t.Errorf("got %q, %v", body, err)
+			}
+			if s.logins != tt.wantLogins {
+				t.Errorf("got %d logins, want %d", s.logins, tt.wantLogins)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/rancher"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Client creates support bundles on a Harvester cluster, waits for them and
+// downloads them:
+//
+//	c, err := client.New(ctx, "https://HARVESTER_API_IP:30443", client.WithCredentials("admin", "password"))
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close(ctx)
+//	sbr, err := c.Create(ctx, client.BundleRequest{IssueURL: issueURL})
+//	...
+//	sbr, err = c.Wait(ctx, sbr)
+//	...
+//	path, err := c.Download(ctx, sbr, client.DownloadOptions{Dir: dir})
+//	...
+//	err = c.Delete(ctx, sbr)
+//
+// Progress is reported to the Observer set with WithObserver. A Client never
+// writes to stdout or stderr.
+type Client struct {
+	url     string
+	config  config
+	backend backend
+	version string
+}
+
+type config struct {
+	user     string
+	password string
+	noAuth   bool
+	insecure bool
+
+	rancherToken string
+	cluster      string
+
+	backend    string
+	kubeconfig string
+
+	observer Observer
+}
+
+// Option configures a Client.
+type Option func(*config)
+
+// WithCredentials logs in to the REST API with a username and a password.
+func WithCredentials(user string, password string) Option {
+	return func(c *config) {
+		c.user = user
+		c.password = password
+	}
+}
+
+// WithoutAuth doesn't log in to the REST API.
+func WithoutAuth() Option {
+	return func(c *config) {
+		c.noAuth = true
+	}
+}
+
+// WithInsecure doesn't verify the certificate of the server.
+func WithInsecure() Option {
+	return func(c *config) {
+		c.insecure = true
+	}
+}
+
+// WithRancher reaches the cluster through a Rancher server with an API
+// token. The URL passed to New is then the Rancher URL, and cluster is the
+// ID or name of the Harvester cluster in Rancher.
+func WithRancher(token string, cluster string) Option {
+	return func(c *config) {
+		c.rancherToken = token
+		c.cluster = cluster
+	}
+}
+
+// WithBackend selects how bundles are created, see BackendAuto.
+func WithBackend(backend string) Option {
+	return func(c *config) {
+		c.backend = backend
+	}
+}
+
+// WithKubeconfig sets the kubeconfig file of the SupportBundle custom
+// resource backend. The default loading rules apply without it.
+func WithKubeconfig(path string) Option {
+	return func(c *config) {
+		c.kubeconfig = path
+	}
+}
+
+// WithObserver sends the events of the Client to an Observer.
+func WithObserver(o Observer) Option {
+	return func(c *config) {
+		c.observer = o
+	}
+}
+
+// New starts a session with the cluster at url and detects its Harvester
+// version. url can be empty with the SupportBundle custom resource backend.
+// Errors are an *OptionError or a *ConnectError.
+func New(ctx context.Context, url string, opts ...Option) (*Client, error) {
+	c := &Client{url: url}
+	for _, opt := range opts {
+		opt(&c.config)
+	}
+	switch c.config.backend {
+	case "", BackendAuto, BackendREST, BackendCR:
+	default:
+		return nil, &OptionError{Option: "backend", Reason: "unknown backend " + c.config.backend}
+	}
+	if c.config.cluster != "" && c.config.rancherToken == "" {
+		return nil, &OptionError{Option: "cluster", Reason: "a Rancher API token is required"}
+	}
+
+	b, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.backend = b
+	c.version = c.detectVersion(ctx)
+	c.observe(Event{Type: EventConnected, Version: c.version})
+	return c, nil
+}
+
+// URL returns the URL of the REST API, the Rancher proxy URL of the cluster
+// when it's reached through Rancher.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// ServerVersion returns the Harvester version of the cluster, empty if it
+// couldn't be detected.
+func (c *Client) ServerVersion() string {
+	return c.version
+}
+
+// Close ends the session with the cluster.
+func (c *Client) Close(ctx context.Context) error {
+	return c.backend.close(ctx)
+}
+
+// Create starts the generation of a bundle.
+func (c *Client) Create(ctx context.Context, req BundleRequest) (*SupportBundleResource, error) {
+	sbr, err := c.backend.create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c.observe(Event{Type: EventCreated, Bundle: sbr})
+	return sbr, nil
+}
+
+// Get returns the current state of a bundle.
+func (c *Client) Get(ctx context.Context, sbr *SupportBundleResource) (*SupportBundleResource, error) {
+	return c.backend.get(ctx, sbr)
+}
+
+// List returns the bundles on the cluster.
+func (c *Client) List(ctx context.Context) ([]*SupportBundleResource, error) {
+	return c.backend.list(ctx)
+}
+
+// Find returns the bundle of a name, or a *NotFoundError.
+func (c *Client) Find(ctx context.Context, name string) (*SupportBundleResource, error) {
+	bundles, err := c.backend.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, sbr := range bundles {
+		if sbr.Name == name {
+			return sbr, nil
+		}
+	}
+	return nil, &NotFoundError{Bundle: name}
+}
+
+// FindReusable returns the newest bundle of an issue being generated, or
+// generated since a time, or nil if there is none.
+func (c *Client) FindReusable(ctx context.Context, issueURL string, since time.Time) (*SupportBundleResource, error) {
+	bundles, err := c.backend.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found *SupportBundleResource
+	var foundCreated time.Time
+	for _, sbr := range bundles {
+		if sbr.IssueURL != issueURL || sbr.State == BundleStateError {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, sbr.Created)
+		if sbr.State == BundleStateReadyForDownload && (err != nil || created.Before(since)) {
+			continue
+		}
+		if found == nil || created.After(foundCreated) {
+			found, foundCreated = sbr, created
+		}
+	}
+	return found, nil
+}
+
+// Wait waits until a bundle is ready for download and returns it. A failed
+// generation is a *GenerationError. Wait returns the error of ctx when it's
+// done first.
+func (c *Client) Wait(ctx context.Context, sbr *SupportBundleResource) (*SupportBundleResource, error) {
+	last := sbr
+	err := c.backend.watch(ctx, sbr, func(newSbr *SupportBundleResource) (bool, error) {
+		last = newSbr
+		switch newSbr.State {
+		case BundleStateError:
+			return false, &GenerationError{Bundle: newSbr.Name, Message: string(newSbr.ErrorMessage)}
+		case BundleStateReadyForDownload:
+			c.observe(Event{Type: EventReady, Bundle: newSbr})
+			return true, nil
+		}
+		c.observe(Event{Type: EventProgress, Bundle: newSbr})
+		return false, nil
+	})
+	return last, err
+}
+
+// Download saves a bundle ready for download and returns its path, see
+// DownloadOptions.
+func (c *Client) Download(ctx context.Context, sbr *SupportBundleResource, opts DownloadOptions) (string, error) {
+	progress := opts.Progress
+	opts.Progress = func(received, total int64) {
+		if progress != nil {
+			progress(received, total)
+		}
+		c.observe(Event{Type: EventDownloading, Bundle: sbr, Received: received, Total: total})
+	}
+	path, err := c.backend.download(ctx, sbr, opts)
+	if err != nil {
+		return "", err
+	}
+	c.observe(Event{Type: EventDownloaded, Bundle: sbr, Path: path})
+	return path, nil
+}
+
+// Delete deletes a bundle from the cluster. A bundle already gone isn't an
+// error. The legacy REST API can't delete bundles, it removes them once they
+// are downloaded.
+func (c *Client) Delete(ctx context.Context, sbr *SupportBundleResource) error {
+	if err := c.backend.remove(ctx, sbr); err != nil {
+		return err
+	}
+	c.observe(Event{Type: EventDeleted, Bundle: sbr})
+	return nil
+}
+
+func (c *Client) observe(e Event) {
+	if c.config.observer != nil {
+		c.config.observer.Observe(e)
+	}
+}
+
+func (c *Client) warn(message string) {
+	c.observe(Event{Type: EventWarning, Message: message})
+}
+
+// connect picks the backend and starts a session with the cluster.
+func (c *Client) connect(ctx context.Context) (backend, error) {
+	// Without a backend, the custom resource is tried when a kubeconfig is
+	// given, or when it's the only way to reach the cluster.
+	tryCR := c.config.backend == BackendCR
+	if c.config.backend == "" || c.config.backend == BackendAuto {
+		tryCR = c.config.kubeconfig != "" || os.Getenv(clientcmd.RecommendedConfigPathEnvVar) != "" || c.url == ""
+	}
+	if tryCR {
+		cr, err := newCRBackend(c.config.kubeconfig, c.config.insecure)
+		if err == nil {
+			var served bool
+			if served, err = cr.served(ctx); err == nil && !served {
+				err = errors.New("the cluster doesn't serve SupportBundle resources")
+			}
+		}
+		switch {
+		case err == nil:
+			return cr, nil
+		case c.config.backend == BackendCR || c.url == "":
+			return nil, &ConnectError{Step: "use SupportBundle resources", Err: err}
+		}
+		c.warn("fail to use SupportBundle resources, falling back to the REST API: " + err.Error())
+	}
+	if c.url == "" {
+		return nil, &OptionError{Option: "URL", Reason: "the REST API requires a URL"}
+	}
+
+	if c.config.rancherToken != "" {
+		rc := rancher.NewClient(c.url, c.config.rancherToken, c.config.insecure)
+		cluster, err := rc.Resolve(ctx, c.config.cluster)
+		if err != nil {
+			return nil, &ConnectError{Step: "find cluster in Rancher", Err: err}
+		}
+		c.url = rc.ProxyURL(cluster.ID)
+	}
+
+	// The session outlives ctx, requests get the context of the calls.
+	r := NewRESTClient(context.Background(), c.url, c.config.user, c.config.password, c.config.insecure)
+	if c.config.rancherToken != "" {
+		r.SetBearerToken(c.config.rancherToken)
+	} else if !c.config.noAuth {
+		if err := r.LoginContext(ctx); err != nil {
+			return nil, &ConnectError{Step: "login", Err: err}
+		}
+	}
+	return &restBackend{r: r}, nil
+}
+
+// detectVersion reads the Harvester version of the cluster and sets the API
+// shape of the REST API for it. Untested versions are warned about. The API
+// found by the login, or the oldest one, is kept if the version can't be
+// read. The API found by the login is also kept if the version can't be
+// parsed, e.g., for development builds, or if its auth flow isn't the one
+// the login succeeded with.
+func (c *Client) detectVersion(ctx context.Context) string {
+	version, err := c.backend.version(ctx)
+	if err != nil {
+		c.warn("fail to detect Harvester version: " + err.Error())
+		return ""
+	}
+	compat, tested := CompatibilityFor(version)
+	if rest, ok := c.backend.(*restBackend); ok {
+		_, parsed := parseVersion(version)
+		if known, ok := rest.r.Compatibility(); ok && (!parsed || known.Auth != compat.Auth) {
+			compat, tested = known, false
+		} else {
+			rest.r.SetCompatibility(compat)
+		}
+	}
+	if !tested {
+		c.warn(UntestedWarning(version, compat))
+	}
+	return version
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		// rancher serves the Rancher login instead of the Harvester one.
+		rancher  bool
+		wantAuth AuthFlow
+		wantWarn string
+	}{
+		{name: "rancher login", version: "v1.0.3", rancher: true, wantAuth: AuthRancher},
+		{name: "jwe login", version: "v0.2.0", wantAuth: AuthJWE},
+		{name: "untested", version: "v9.0.0", rancher: true, wantAuth: AuthRancher, wantWarn: "handled like Harvester v1.0.3"},
+		// The login is right about the server when the version is not.
+		{name: "development build", version: "master-abc1234-head", wantAuth: AuthJWE, wantWarn: "handled like Harvester v0.2.0"},
+		{name: "auth flow mismatch", version: "v1.0.0", wantAuth: AuthJWE, wantWarn: "handled like Harvester v0.2.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v3-public/localProviders/local" && tt.rancher:
+					w.Write([]byte(`{"token":"token-1"}`))
+				case r.URL.Path == "/v1-public/auth" && !tt.rancher:
+					w.Write([]byte(`{"jweToken":"token-1"}`))
+				case r.URL.Path == serverVersionPaths[0]:
+					fmt.Fprintf(w, `{"value":%q}`, tt.version)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+
+			var warnings []string
+			c, err := New(context.Background(), ts.URL,
+				WithBackend(BackendREST),
+				WithCredentials("admin", "password"),
+				WithObserver(ObserverFunc(func(e Event) {
+					if e.Type == EventWarning {
+						warnings = append(warnings, e.Message)
+					}
+				})))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.version != tt.version {
+				t.Errorf("got version %q, want %q", c.version, tt.version)
+			}
+			compat, _ := c.backend.(*restBackend).r.Compatibility()
+			if compat.Auth != tt.wantAuth {
+				t.Errorf("got auth %s, want %s", compat.Auth, tt.wantAuth)
+			}
+			warning := strings.Join(warnings, "\n")
+			if (tt.wantWarn == "") != (warning == "") || !strings.Contains(warning, tt.wantWarn) {
+				t.Errorf("got warnings %q, want %q", warning, tt.wantWarn)
+			}
+		})
+	}
+}
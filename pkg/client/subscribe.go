@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// HarvesterURLSubscribe streams resource changes over a websocket. Newer
+	// versions serve it under another path, see Compatibility.
+	HarvesterURLSubscribe = "/v1/subscribe"
+	// supportBundleResourceType is the type of SupportBundle resources in
+	// subscriptions.
+	supportBundleResourceType = "harvesterhci.io.supportbundle"
+)
+
+// subscription asks the server for the changes of resources of a type.
+type subscription struct {
+	ResourceType string `json:"resourceType"`
+	Namespace    string `json:"namespace,omitempty"`
+	ID           string `json:"id,omitempty"`
+}
+
+// apiEvent is a message of a subscription. Data is the changed resource.
+type apiEvent struct {
+	Name         string `json:"name"`
+	ResourceType string `json:"resourceType"`
+	Data         struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// subscribe streams the changes of the resource with id, namespace/name for
+// namespaced resources, over a websocket at path. The returned channel receives a
+// value when the resource changes, changes received before it's read are
+// merged, and it's closed when the stream ends or ctx is done.
+func (r *RESTClient) subscribe(ctx context.Context, path string, resourceType string, id string) (<-chan struct{}, error) {
+	u, err := url.Parse(r.apiURL + path)
+	if err != nil {
+		return nil, err
+	}
+	origin := u.Scheme + "://" + u.Host
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	config, err := websocket.NewConfig(u.String(), origin)
+	if err != nil {
+		return nil, err
+	}
+	config.TlsConfig = &tls.Config{InsecureSkipVerify: r.insecure}
+	config.Dialer = &net.Dialer{Timeout: 15 * time.Second}
+	r.authorize(config.Header, r.getToken())
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := subscription{ResourceType: resourceType, ID: id}
+	if i := strings.Index(id, "/"); i >= 0 {
+		sub.Namespace = id[:i]
+	}
+	if err := websocket.JSON.Send(ws, sub); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		ws.Close()
+	}()
+	go func() {
+		defer close(changes)
+		for {
+			var e apiEvent
+			if err := websocket.JSON.Receive(ws, &e); err != nil {
+				return
+			}
+			if e.ResourceType != resourceType || e.Data.ID != id {
+				continue
+			}
+			switch e.Name {
+			case "resource.change", "resource.create", "resource.remove":
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
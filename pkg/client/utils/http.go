@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// NewHTTPClient returns an HTTP client with the given timeout. Server
+// certificates are not verified when insecure is set.
+func NewHTTPClient(timeout time.Duration, insecure bool) *http.Client {
+	httpClient := http.Client{
+		Timeout: timeout,
+	}
+	if insecure {
+		httpClient.Transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		}
+	}
+	return &httpClient
+}
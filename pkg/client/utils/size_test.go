@@ -0,0 +1,60 @@
+package utils
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "512", want: 512},
+		{in: "1K", want: 1 << 10},
+		{in: "1k", want: 1 << 10},
+		{in: "200M", want: 200 << 20},
+		{in: "200MB", want: 200 << 20},
+		{in: "512KiB", want: 512 << 10},
+		{in: "1.5G", want: 3 << 29},
+		{in: " 2T ", want: 2 << 40},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "0", wantErr: true},
+		{in: "-1G", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "+InfG", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "0.1", wantErr: true},
+		{in: "0.5K", want: 512},
+		{in: "8388608T", wantErr: true},
+		{in: "1e30", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{3 << 29, "1.5 GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.in); got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// serverVersionPaths are the paths of the server-version setting, newest API
+// first.
+var serverVersionPaths = []string{
+	"/v1/harvester/harvesterhci.io.settings/server-version",
+	"/v1/harvesterhci.io.settings/server-version",
+	"/v1/settings/server-version",
+}
+
+// ServerVersion returns the Harvester version of the server, read from the
+// server-version setting.
+func (r *RESTClient) ServerVersion() (string, error) {
+	return r.ServerVersionContext(r.context)
+}
+
+// ServerVersionContext is ServerVersion with the context of the requests.
+func (r *RESTClient) ServerVersionContext(ctx context.Context) (string, error) {
+	var err error
+	for _, path := range serverVersionPaths {
+		var resp []byte
+		resp, err = r.RequestContext(ctx, http.MethodGet, r.apiURL+path, nil)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		var setting struct {
+			Value   string `json:"value"`
+			Default string `json:"default"`
+		}
+		if err := json.Unmarshal(resp, &setting); err != nil {
+			return "", err
+		}
+		if setting.Value == "" {
+			setting.Value = setting.Default
+		}
+		if setting.Value == "" {
+			return "", errors.New("the server-version setting is empty")
+		}
+		return setting.Value, nil
+	}
+	return "", err
+}
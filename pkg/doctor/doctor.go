@@ -0,0 +1,317 @@
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client"
+)
+
+type Status string
+
+const (
+	StatusPass = Status("pass")
+	StatusWarn = Status("warn")
+	StatusFail = Status("fail")
+	StatusSkip = Status("skip")
+)
+
+// certExpiryWarning is how long before its expiry a certificate is reported.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// supportBundleSchemaPaths are the paths of the SupportBundle schema, which
+// lists the methods the user is allowed, newest API first.
+var supportBundleSchemaPaths = []string{
+	"/v1/harvester/schemas/harvesterhci.io.supportbundle",
+	"/v1/schemas/harvesterhci.io.supportbundle",
+}
+
+// prerequisites are the checks the later ones depend on.
+var prerequisites = map[string]bool{"dns": true, "tcp": true, "tls": true, "login": true}
+
+// Check is the result of a step of the preflight.
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Hint suggests how to fix a failed check.
+	Hint string `json:"hint,omitempty"`
+}
+
+// Options are the connection options of the download command.
+type Options struct {
+	URL      string
+	User     string
+	Password string
+	NoAuth   bool
+	Insecure bool
+	// Timeout bounds the DNS, TCP and TLS checks.
+	Timeout time.Duration
+}
+
+// Report is the result of all checks.
+type Report struct {
+	URL    string    `json:"url"`
+	Time   time.Time `json:"time"`
+	Checks []Check   `json:"checks"`
+}
+
+// Failed reports whether a check failed.
+func (r *Report) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// doctor runs the checks in order. Once a prerequisite fails, the checks
+// depending on it are skipped.
+type doctor struct {
+	opts   Options
+	report *Report
+	failed string
+}
+
+// Run checks step by step what download needs: name resolution, the TCP
+// connection, the TLS handshake, the login, the API version and the
+// permissions on support bundles.
+func Run(ctx context.Context, opts Options) *Report {
+	d := &doctor{opts: opts, report: &Report{URL: opts.URL, Time: time.Now()}}
+	u, err := url.Parse(opts.URL)
+	if err == nil && u.Host == "" {
+		err = errors.New("no host")
+	}
+	if err != nil {
+		d.add("url", StatusFail, err.Error(), "pass the URL of the Harvester API, e.g., https://HARVESTER_API_IP:30443")
+		return d.report
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	d.checkDNS(ctx, host)
+	d.checkTCP(ctx, net.JoinHostPort(host, port))
+	if u.Scheme == "https" {
+		d.checkTLS(host, net.JoinHostPort(host, port))
+	}
+
+	apiURL := strings.TrimSuffix(opts.URL, "/")
+	r := client.NewRESTClient(ctx, apiURL, opts.User, opts.Password, opts.Insecure)
+	d.checkLogin(r)
+	defer r.Logout()
+	d.checkVersion(r)
+	d.checkList(r, apiURL)
+	d.checkCreate(r, apiURL)
+	return d.report
+}
+
+func (d *doctor) add(name string, status Status, detail string, hint string) {
+	d.report.Checks = append(d.report.Checks, Check{Name: name, Status: status, Detail: detail, Hint: hint})
+	if status == StatusFail && prerequisites[name] && d.failed == "" {
+		d.failed = name
+	}
+}
+
+// skip records a check as skipped if a prerequisite failed.
+func (d *doctor) skip(name string) bool {
+	if d.failed == "" {
+		return false
+	}
+	d.add(name, StatusSkip, "the "+d.failed+" check failed", "")
+	return true
+}
+
+func (d *doctor) checkDNS(ctx context.Context, host string) {
+	if net.ParseIP(host) != nil {
+		d.add("dns", StatusPass, host+" is an IP address", "")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		d.add("dns", StatusFail, err.Error(), "check the host name and the DNS servers of this machine, or use the IP of the Harvester VIP")
+		return
+	}
+	d.add("dns", StatusPass, fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", ")), "")
+}
+
+func (d *doctor) checkTCP(ctx context.Context, addr string) {
+	if d.skip("tcp") {
+		return
+	}
+	dialer := &net.Dialer{Timeout: d.opts.Timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		d.add("tcp", StatusFail, err.Error(), "check that the cluster is up, and that no firewall or proxy blocks "+addr)
+		return
+	}
+	conn.Close()
+	d.add("tcp", StatusPass, fmt.Sprintf("connected to %s in %s", conn.RemoteAddr(), time.Since(start).Round(time.Millisecond)), "")
+}
+
+// checkTLS completes a handshake without verification to report the
+// certificate, then verifies it.
+func (d *doctor) checkTLS(host string, addr string) {
+	if d.skip("tls") {
+		return
+	}
+	dialer := &net.Dialer{Timeout: d.opts.Timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err != nil {
+		d.add("tls", StatusFail, err.Error(), "check that the URL points to the HTTPS port of the Harvester API")
+		return
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		d.add("tls", StatusFail, "the server sent no certificate", "")
+		return
+	}
+
+	leaf := certs[0]
+	detail := fmt.Sprintf("subject %q, issuer %q, expires %s", leaf.Subject.String(), leaf.Issuer.String(), leaf.NotAfter.UTC().Format(time.RFC3339))
+	if len(leaf.DNSNames) > 0 || len(leaf.IPAddresses) > 0 {
+		var names []string
+		names = append(names, leaf.DNSNames...)
+		for _, ip := range leaf.IPAddresses {
+			names = append(names, ip.String())
+		}
+		detail += ", names " + strings.Join(names, ", ")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates})
+	switch {
+	case err != nil && d.opts.Insecure:
+		d.add("tls", StatusWarn, detail+": "+err.Error(), "--insecure skips the verification, add the CA of the certificate to the system trust store to verify it")
+	case err != nil:
+		d.add("tls", StatusFail, detail+": "+err.Error(), "use --insecure for self-signed certificates, or add the CA of the certificate to the system trust store")
+	case time.Until(leaf.NotAfter) < certExpiryWarning:
+		d.add("tls", StatusWarn, detail, "the certificate expires soon, renew it")
+	default:
+		d.add("tls", StatusPass, detail, "")
+	}
+}
+
+func (d *doctor) checkLogin(r *client.RESTClient) {
+	if d.skip("login") {
+		return
+	}
+	if d.opts.NoAuth {
+		d.add("login", StatusSkip, "--noauth is set", "")
+		return
+	}
+	if err := r.Login(); err != nil {
+		hint := "check that the URL points to the Harvester API, e.g., https://HARVESTER_API_IP:30443"
+		if isStatus(err, http.StatusUnauthorized, http.StatusForbidden) {
+			hint = "check --user and --password"
+		}
+		d.add("login", StatusFail, err.Error(), hint)
+		return
+	}
+	compat, _ := r.Compatibility()
+	d.add("login", StatusPass, fmt.Sprintf("logged in as %s with the %s auth flow", d.opts.User, compat.Auth), "")
+}
+
+func (d *doctor) checkVersion(r *client.RESTClient) {
+	if d.skip("version") {
+		return
+	}
+	version, err := r.ServerVersion()
+	if err != nil {
+		d.add("version", StatusWarn, err.Error(), "the server may be an older Harvester version, or not Harvester at all")
+		return
+	}
+	compat, tested := client.CompatibilityFor(version)
+	r.SetCompatibility(compat)
+	if !tested {
+		d.add("version", StatusWarn, client.UntestedWarning(version, compat), "check for a newer release of this client")
+		return
+	}
+	d.add("version", StatusPass, fmt.Sprintf("Harvester %s, %s bundle API", version, compat.Bundles), "")
+}
+
+func (d *doctor) checkList(r *client.RESTClient, apiURL string) {
+	if d.skip("list bundles") {
+		return
+	}
+	compat, _ := r.Compatibility()
+	_, err := r.Get(apiURL + compat.BundlesPath)
+	switch {
+	case err == nil:
+		d.add("list bundles", StatusPass, "GET "+compat.BundlesPath+" is allowed", "")
+	case isStatus(err, http.StatusUnauthorized, http.StatusForbidden):
+		d.add("list bundles", StatusFail, err.Error(), "grant the user permission on supportbundles.harvesterhci.io")
+	case isStatus(err, http.StatusNotFound, http.StatusMethodNotAllowed):
+		d.add("list bundles", StatusWarn, err.Error(), "the server doesn't serve the REST API of bundles, try download --backend cr with a kubeconfig")
+	default:
+		d.add("list bundles", StatusFail, err.Error(), "")
+	}
+}
+
+// checkCreate looks up the methods allowed on bundles in their schema, so no
+// bundle is created.
+func (d *doctor) checkCreate(r *client.RESTClient, apiURL string) {
+	if d.skip("create bundles") {
+		return
+	}
+	for _, path := range supportBundleSchemaPaths {
+		resp, err := r.Get(apiURL + path)
+		if isStatus(err, http.StatusNotFound) {
+			continue
+		}
+		if err != nil {
+			d.add("create bundles", StatusFail, err.Error(), "")
+			return
+		}
+		var schema struct {
+			CollectionMethods []string `json:"collectionMethods"`
+		}
+		if err := json.Unmarshal(resp, &schema); err != nil {
+			d.add("create bundles", StatusFail, err.Error(), "")
+			return
+		}
+		for _, m := range schema.CollectionMethods {
+			if m == http.MethodPost {
+				d.add("create bundles", StatusPass, "the bundle schema allows POST", "")
+				return
+			}
+		}
+		d.add("create bundles", StatusFail, "the bundle schema doesn't allow POST", "grant the user permission to create supportbundles.harvesterhci.io")
+		return
+	}
+	d.add("create bundles", StatusWarn, "the server has no bundle schema", "the permission can't be checked without creating a bundle")
+}
+
+func isStatus(err error, codes ...int) bool {
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	for _, c := range codes {
+		if statusErr.StatusCode == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// An encrypted bundle is laid out as:
+//
+//	harvester-support-bundle-encrypted/v1\n
+//	{"version":1,"bundleName":"...",...,"stanzas":[...]}\n
+//	--- <base64 HMAC-SHA256 of the two lines above>\n
+//	<payload>
+//
+// The payload is the bundle sealed with ChaCha20-Poly1305 in chunks of
+// ChunkSize bytes. Each chunk nonce is an 11-byte big-endian counter followed
+// by a flag byte that is set only on the last chunk, so truncation, reordering
+// and appending are all detected.
+const (
+	FormatVersion = 1
+	ChunkSize     = 64 * 1024
+
+	magicLine = "harvester-support-bundle-encrypted/v1"
+	macPrefix = "--- "
+
+	fileKeySize = 16
+	nonceSize   = 16
+	tagSize     = 16
+
+	// maxHeaderSize bounds the header line so garbage input can't make us
+	// buffer an arbitrary amount of data.
+	maxHeaderSize = 64 * 1024
+)
+
+var (
+	ErrNotEncrypted = errors.New("not an encrypted support bundle")
+	ErrNoIdentity   = errors.New("no identity matched any of the recipients")
+	// ErrIncorrectPassphrase is returned when no identity matched and a
+	// passphrase was tried on a passphrase-encrypted bundle.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+)
+
+// Stanza carries the file key wrapped for one recipient.
+type Stanza struct {
+	Type string `json:"type"`
+
+	// scrypt
+	Salt string `json:"salt,omitempty"`
+	LogN int    `json:"logN,omitempty"`
+
+	// x25519
+	Ephemeral string `json:"ephemeral,omitempty"`
+
+	Body string `json:"body"`
+}
+
+// Header is the clear-text header of an encrypted bundle.
+type Header struct {
+	Version    int       `json:"version"`
+	BundleName string    `json:"bundleName"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ChunkSize  int       `json:"chunkSize"`
+	Nonce      string    `json:"nonce"`
+	Stanzas    []*Stanza `json:"stanzas"`
+}
+
+// A Recipient wraps a file key so that the matching Identity can recover it.
+type Recipient interface {
+	Wrap(fileKey []byte) (*Stanza, error)
+}
+
+// An Identity recovers a file key from a stanza. It returns errIncorrectIdentity
+// if the stanza is not addressed to it.
+type Identity interface {
+	Unwrap(s *Stanza) ([]byte, error)
+}
+
+var errIncorrectIdentity = errors.New("incorrect identity")
+
+// NewWriter writes the header for bundleName to w and returns a WriteCloser
+// that encrypts everything written to it. Close must be called to seal the
+// final chunk; it does not close w.
+func NewWriter(w io.Writer, bundleName string, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients specified")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	hdr := &Header{
+		Version:    FormatVersion,
+		BundleName: bundleName,
+		CreatedAt:  time.Now().UTC(),
+		ChunkSize:  ChunkSize,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+	}
+	for _, r := range recipients {
+		s, err := r.Wrap(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("fail to wrap file key: %s", err)
+		}
+		hdr.Stanzas = append(hdr.Stanzas, s)
+	}
+
+	raw, err := marshalHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	mac := headerMAC(fileKey, raw)
+	if _, err := io.WriteString(w, string(raw)); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(w, "%s%s\n", macPrefix, base64.StdEncoding.EncodeToString(mac)); err != nil {
+		return nil, err
+	}
+
+	return newStreamWriter(w, payloadKey(fileKey, nonce), ChunkSize)
+}
+
+// NewReader parses the header from r, unwraps the file key with the first
+// matching identity and returns a Reader over the decrypted bundle.
+func NewReader(r io.Reader, identities ...Identity) (*Header, io.Reader, error) {
+	br := bufio.NewReaderSize(r, maxHeaderSize)
+	hdr, raw, mac, err := readHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileKey, err := unwrap(hdr, identities)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hmac.Equal(mac, headerMAC(fileKey, raw)) {
+		return nil, nil, errors.New("header has been tampered with")
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(hdr.Nonce)
+	if err != nil || len(nonce) != nonceSize {
+		return nil, nil, errors.New("malformed header nonce")
+	}
+	sr, err := newStreamReader(br, payloadKey(fileKey, nonce), hdr.ChunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hdr, sr, nil
+}
+
+// ReadHeader parses the clear-text header without decrypting anything.
+func ReadHeader(r io.Reader) (*Header, error) {
+	hdr, _, _, err := readHeader(bufio.NewReaderSize(r, maxHeaderSize))
+	return hdr, err
+}
+
+func marshalHeader(hdr *Header) ([]byte, error) {
+	data, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(magicLine)
+	buf.WriteByte('\n')
+	buf.Write(data)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func readHeader(br *bufio.Reader) (*Header, []byte, []byte, error) {
+	magic, err := br.ReadSlice('\n')
+	if err != nil || strings.TrimSuffix(string(magic), "\n") != magicLine {
+		return nil, nil, nil, ErrNotEncrypted
+	}
+	raw := append([]byte{}, magic...)
+
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed header: %s", err)
+	}
+	raw = append(raw, line...)
+
+	var hdr Header
+	if err := json.Unmarshal(line, &hdr); err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed header: %s", err)
+	}
+	if hdr.Version != FormatVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported format version %d", hdr.Version)
+	}
+	if hdr.ChunkSize <= 0 || hdr.ChunkSize > 16*1024*1024 {
+		return nil, nil, nil, fmt.Errorf("invalid chunk size %d", hdr.ChunkSize)
+	}
+
+	macLine, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(macLine, macPrefix) {
+		return nil, nil, nil, errors.New("malformed header: missing MAC")
+	}
+	mac, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(macLine, macPrefix)))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("malformed header MAC: %s", err)
+	}
+	return &hdr, raw, mac, nil
+}
+
+func unwrap(hdr *Header, identities []Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("no identities specified")
+	}
+	passphraseTried := false
+	for _, id := range identities {
+		for _, s := range hdr.Stanzas {
+			if _, ok := id.(*PassphraseIdentity); ok && s.Type == StanzaTypeScrypt {
+				passphraseTried = true
+			}
+			fileKey, err := id.Unwrap(s)
+			if err == errIncorrectIdentity {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return fileKey, nil
+		}
+	}
+	if passphraseTried {
+		return nil, ErrIncorrectPassphrase
+	}
+	return nil, ErrNoIdentity
+}
+
+func headerMAC(fileKey, raw []byte) []byte {
+	h := hmac.New(sha256.New, deriveKey(fileKey, nil, "header"))
+	h.Write(raw)
+	return h.Sum(nil)
+}
+
+func payloadKey(fileKey, nonce []byte) []byte {
+	return deriveKey(fileKey, nonce, "payload")
+}
+
+func deriveKey(secret, salt []byte, info string) []byte {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		panic(err)
+	}
+	return key
+}
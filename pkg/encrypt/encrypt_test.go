@@ -0,0 +1,295 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	const chunkSize = 64
+	key := randomBytes(t, 32)
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one byte", 1},
+		{"short chunk", chunkSize - 1},
+		{"one chunk", chunkSize},
+		{"chunk and a byte", chunkSize + 1},
+		{"several chunks", 3 * chunkSize},
+		{"several chunks and a half", 3*chunkSize + chunkSize/2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := randomBytes(t, tt.size)
+			var sealed bytes.Buffer
+			w, err := newStreamWriter(&sealed, key, chunkSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Odd write sizes cross chunk boundaries.
+			for data := plain; len(data) > 0; {
+				n := 7
+				if n > len(data) {
+					n = len(data)
+				}
+				if _, err := w.Write(data[:n]); err != nil {
+					t.Fatal(err)
+				}
+				data = data[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := newStreamReader(bufio.NewReader(&sealed), key, chunkSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("got %d bytes, want %d bytes", len(got), len(plain))
+			}
+		})
+	}
+}
+
+func TestStreamCorruption(t *testing.T) {
+	const chunkSize = 64
+	key := randomBytes(t, 32)
+	var sealed bytes.Buffer
+	w, err := newStreamWriter(&sealed, key, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(randomBytes(t, 3*chunkSize)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	full := sealed.Bytes()
+	sealedChunk := chunkSize + tagSize
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		key    []byte
+	}{
+		{"truncated at a chunk boundary", func(b []byte) []byte { return b[:2*sealedChunk] }, key},
+		{"truncated in a chunk", func(b []byte) []byte { return b[:2*sealedChunk+10] }, key},
+		{"truncated in a tag", func(b []byte) []byte { return b[:3*sealedChunk-tagSize/2] }, key},
+		{"flipped bit", func(b []byte) []byte { b[sealedChunk+1] ^= 1; return b }, key},
+		{"swapped chunks", func(b []byte) []byte {
+			swapped := append([]byte{}, b[sealedChunk:2*sealedChunk]...)
+			swapped = append(swapped, b[:sealedChunk]...)
+			return append(swapped, b[2*sealedChunk:]...)
+		}, key},
+		{"appended data", func(b []byte) []byte { return append(b, 0) }, key},
+		{"wrong key", func(b []byte) []byte { return b }, randomBytes(t, 32)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.mutate(append([]byte{}, full...))
+			r, err := newStreamReader(bufio.NewReader(bytes.NewReader(data)), tt.key, chunkSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ioutil.ReadAll(r); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	alice, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := func(s string) *PassphraseRecipient {
+		r, err := NewPassphraseRecipient(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The default work factor is slow on purpose.
+		r.logN = 10
+		return r
+	}
+	passphraseIdentity := func(s string) *PassphraseIdentity {
+		id, err := NewPassphraseIdentity(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	tests := []struct {
+		name       string
+		recipients []Recipient
+		identities []Identity
+		wantErr    error
+	}{
+		{"passphrase", []Recipient{passphrase("secret")}, []Identity{passphraseIdentity("secret")}, nil},
+		{"key", []Recipient{alice.Recipient()}, []Identity{alice}, nil},
+		{"second recipient", []Recipient{alice.Recipient(), bob.Recipient()}, []Identity{bob}, nil},
+		{"second identity", []Recipient{bob.Recipient()}, []Identity{alice, bob}, nil},
+		{"wrong passphrase then key", []Recipient{passphrase("secret"), alice.Recipient()}, []Identity{passphraseIdentity("wrong"), alice}, nil},
+		{"key then passphrase", []Recipient{alice.Recipient(), passphrase("secret")}, []Identity{passphraseIdentity("secret")}, nil},
+		{"wrong passphrase", []Recipient{passphrase("secret")}, []Identity{passphraseIdentity("wrong")}, ErrIncorrectPassphrase},
+		{"wrong key", []Recipient{alice.Recipient()}, []Identity{bob}, ErrNoIdentity},
+		{"passphrase for a key", []Recipient{alice.Recipient()}, []Identity{passphraseIdentity("secret")}, ErrNoIdentity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := randomBytes(t, ChunkSize+100)
+			var sealed bytes.Buffer
+			w, err := NewWriter(&sealed, "bundle", tt.recipients...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(plain); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			hdr, r, err := NewReader(&sealed, tt.identities...)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if hdr.BundleName != "bundle" {
+				t.Errorf("got bundle name %q", hdr.BundleName)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Error("decrypted bundle differs")
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sealed bytes.Buffer
+	w, err := NewWriter(&sealed, "bundle", id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"zip", []byte("PK\x03\x04"), ErrNotEncrypted.Error()},
+		{"empty", nil, ErrNotEncrypted.Error()},
+		{"tampered name", bytes.Replace(sealed.Bytes(), []byte(`"bundle"`), []byte(`"bundlf"`), 1), "tampered"},
+		{"missing MAC", bytes.SplitAfterN(sealed.Bytes(), []byte("\n"), 3)[0], "malformed header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewReader(bytes.NewReader(tt.data), id)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptFile(t *testing.T) {
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "encrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	plain := randomBytes(t, 1000)
+	src := filepath.Join(dir, "bundle.zip")
+	if err := ioutil.WriteFile(src, plain, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output can't be the input.
+	if err := EncryptFile(src, src, "bundle", id.Recipient()); err == nil {
+		t.Error("encrypting a file into itself succeeded")
+	}
+	if err := os.Symlink(src, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptFile(src, filepath.Join(dir, "link"), "bundle", id.Recipient()); err == nil {
+		t.Error("encrypting a file into a link to itself succeeded")
+	}
+	if data, _ := ioutil.ReadFile(src); !bytes.Equal(data, plain) {
+		t.Fatal("the input was changed")
+	}
+
+	// A failure leaves an existing output alone.
+	dst := filepath.Join(dir, "bundle.zip.enc")
+	if err := ioutil.WriteFile(dst, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptFile(src, dst, "bundle"); err == nil {
+		t.Error("encrypting without recipients succeeded")
+	}
+	if data, _ := ioutil.ReadFile(dst); string(data) != "existing" {
+		t.Error("a failed encryption changed the output")
+	}
+
+	if err := EncryptFile(src, dst, "bundle", id.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.zip")
+	if _, err := DecryptFile(dst, out, id); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(out); !bytes.Equal(data, plain) {
+		t.Error("decrypted file differs")
+	}
+	if _, err := DecryptFile(dst, dst, id); err == nil {
+		t.Error("decrypting a file into itself succeeded")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, ".*.part"))
+	if len(files) > 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
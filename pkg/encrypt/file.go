@@ -0,0 +1,84 @@
+package encrypt
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// EncryptFile encrypts src into dst for the given recipients. dst is only
+// replaced once encryption succeeds.
+func EncryptFile(src, dst, bundleName string, recipients ...Recipient) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFile(in, dst, func(out io.Writer) error {
+		w, err := NewWriter(out, bundleName, recipients...)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, in); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// DecryptFile decrypts src into dst with the first matching identity.
+func DecryptFile(src, dst string, identities ...Identity) (*Header, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	hdr, r, err := NewReader(in, identities...)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFile(in, dst, func(out io.Writer) error {
+		_, err := io.Copy(out, r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hdr, nil
+}
+
+// writeFile calls fn with a temporary file next to path and moves it to path
+// once complete, so a failure leaves an existing file at path alone. Writing
+// over the input file in is refused.
+func writeFile(in *os.File, path string, fn func(io.Writer) error) error {
+	inInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if outInfo, err := os.Stat(path); err == nil && os.SameFile(inInfo, outInfo) {
+		return fmt.Errorf("%s is the input file", path)
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	out, err := ioutil.TempFile(dir, "."+base+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	if err := fn(out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
@@ -0,0 +1,251 @@
+package encrypt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	StanzaTypeScrypt = "scrypt"
+	StanzaTypeX25519 = "x25519"
+
+	PublicKeyPrefix = "sbu-pub-"
+	SecretKeyPrefix = "SBU-SECRET-KEY-"
+
+	// DefaultScryptLogN is the scrypt work factor (N = 2^15) used when
+	// encrypting with a passphrase. It takes about 100ms on a modern CPU.
+	DefaultScryptLogN = 15
+	// maxScryptLogN bounds the work factor accepted from a header, so a
+	// crafted file can't make decryption run for hours.
+	maxScryptLogN = 22
+)
+
+// PassphraseRecipient wraps the file key with a key derived from a passphrase
+// using scrypt.
+type PassphraseRecipient struct {
+	passphrase string
+	logN       int
+}
+
+func NewPassphraseRecipient(passphrase string) (*PassphraseRecipient, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+	return &PassphraseRecipient{passphrase: passphrase, logN: DefaultScryptLogN}, nil
+}
+
+func (p *PassphraseRecipient) Wrap(fileKey []byte) (*Stanza, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(p.passphrase), salt, 1<<p.logN, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	body, err := sealFileKey(key, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Stanza{
+		Type: StanzaTypeScrypt,
+		Salt: base64.StdEncoding.EncodeToString(salt),
+		LogN: p.logN,
+		Body: body,
+	}, nil
+}
+
+// PassphraseIdentity recovers a file key wrapped by a PassphraseRecipient.
+type PassphraseIdentity struct {
+	passphrase string
+}
+
+func NewPassphraseIdentity(passphrase string) (*PassphraseIdentity, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+	return &PassphraseIdentity{passphrase: passphrase}, nil
+}
+
+func (p *PassphraseIdentity) Unwrap(s *Stanza) ([]byte, error) {
+	if s.Type != StanzaTypeScrypt {
+		return nil, errIncorrectIdentity
+	}
+	if s.LogN <= 0 || s.LogN > maxScryptLogN {
+		return nil, fmt.Errorf("scrypt work factor %d is out of range", s.LogN)
+	}
+	salt, err := base64.StdEncoding.DecodeString(s.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("malformed scrypt salt: %s", err)
+	}
+	key, err := scrypt.Key([]byte(p.passphrase), salt, 1<<s.LogN, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := openFileKey(key, s.Body)
+	if err != nil {
+		// Another identity may match, see unwrap.
+		return nil, errIncorrectIdentity
+	}
+	return fileKey, nil
+}
+
+// X25519Recipient wraps the file key for the holder of an X25519 private key.
+type X25519Recipient struct {
+	publicKey []byte
+}
+
+// ParseRecipient parses a public key in the "sbu-pub-..." form.
+func ParseRecipient(s string) (*X25519Recipient, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, PublicKeyPrefix) {
+		return nil, fmt.Errorf("public key must start with %q", PublicKeyPrefix)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, PublicKeyPrefix))
+	if err != nil || len(key) != curve25519.PointSize {
+		return nil, errors.New("malformed public key")
+	}
+	return &X25519Recipient{publicKey: key}, nil
+}
+
+func (x *X25519Recipient) String() string {
+	return PublicKeyPrefix + base64.RawURLEncoding.EncodeToString(x.publicKey)
+}
+
+func (x *X25519Recipient) Wrap(fileKey []byte) (*Stanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return nil, err
+	}
+	ephemeralPub, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, x.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := sealFileKey(x25519WrapKey(shared, ephemeralPub, x.publicKey), fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Stanza{
+		Type:      StanzaTypeX25519,
+		Ephemeral: base64.StdEncoding.EncodeToString(ephemeralPub),
+		Body:      body,
+	}, nil
+}
+
+// X25519Identity is an X25519 private key.
+type X25519Identity struct {
+	secretKey []byte
+	publicKey []byte
+}
+
+// GenerateIdentity creates a new random X25519 identity.
+func GenerateIdentity() (*X25519Identity, error) {
+	secret := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return newX25519Identity(secret)
+}
+
+// ParseIdentity parses a private key in the "SBU-SECRET-KEY-..." form.
+func ParseIdentity(s string) (*X25519Identity, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, SecretKeyPrefix) {
+		return nil, fmt.Errorf("secret key must start with %q", SecretKeyPrefix)
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, SecretKeyPrefix))
+	if err != nil || len(secret) != curve25519.ScalarSize {
+		return nil, errors.New("malformed secret key")
+	}
+	return newX25519Identity(secret)
+}
+
+func newX25519Identity(secret []byte) (*X25519Identity, error) {
+	pub, err := curve25519.X25519(secret, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &X25519Identity{secretKey: secret, publicKey: pub}, nil
+}
+
+func (x *X25519Identity) String() string {
+	return SecretKeyPrefix + base64.RawURLEncoding.EncodeToString(x.secretKey)
+}
+
+func (x *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{publicKey: x.publicKey}
+}
+
+func (x *X25519Identity) Unwrap(s *Stanza) ([]byte, error) {
+	if s.Type != StanzaTypeX25519 {
+		return nil, errIncorrectIdentity
+	}
+	ephemeralPub, err := base64.StdEncoding.DecodeString(s.Ephemeral)
+	if err != nil || len(ephemeralPub) != curve25519.PointSize {
+		return nil, errors.New("malformed x25519 stanza")
+	}
+	shared, err := curve25519.X25519(x.secretKey, ephemeralPub)
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := openFileKey(x25519WrapKey(shared, ephemeralPub, x.publicKey), s.Body)
+	if err != nil {
+		// The stanza is addressed to another recipient.
+		return nil, errIncorrectIdentity
+	}
+	return fileKey, nil
+}
+
+func x25519WrapKey(shared, ephemeralPub, recipientPub []byte) []byte {
+	salt := append(append([]byte{}, ephemeralPub...), recipientPub...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(StanzaTypeX25519)), key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// sealFileKey encrypts the file key with a zero nonce, which is safe because
+// every wrapping key is used exactly once.
+func sealFileKey(key, fileKey []byte) (string, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, fileKey, nil)), nil
+}
+
+func openFileKey(key []byte, body string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	fileKey, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(fileKey) != fileKeySize {
+		return nil, errors.New("unexpected file key size")
+	}
+	return fileKey, nil
+}
@@ -0,0 +1,160 @@
+package encrypt
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const lastChunkFlag = 0x01
+
+type streamWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce [chacha20poly1305.NonceSize]byte
+	buf   []byte
+	size  int
+	err   error
+}
+
+func newStreamWriter(w io.Writer, key []byte, chunkSize int) (*streamWriter, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, chunkSize+tagSize),
+		size: chunkSize,
+	}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	total := len(p)
+	for len(p) > 0 {
+		// Only flush a full chunk once more data shows up, so that the last
+		// chunk is always sealed by Close with the last-chunk flag.
+		if len(s.buf) == s.size {
+			if err := s.flush(false); err != nil {
+				s.err = err
+				return total - len(p), err
+			}
+		}
+		n := copy(s.buf[len(s.buf):s.size], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (s *streamWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	err := s.flush(true)
+	s.err = errors.New("write to closed stream")
+	return err
+}
+
+func (s *streamWriter) flush(last bool) error {
+	setLastFlag(&s.nonce, last)
+	sealed := s.aead.Seal(s.buf[:0], s.nonce[:], s.buf, nil)
+	if _, err := s.w.Write(sealed); err != nil {
+		return err
+	}
+	s.buf = s.buf[:0]
+	return incrementCounter(&s.nonce)
+}
+
+type streamReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	nonce [chacha20poly1305.NonceSize]byte
+	chunk []byte
+	buf   []byte
+	plain []byte
+	done  bool
+}
+
+func newStreamReader(r *bufio.Reader, key []byte, chunkSize int) (*streamReader, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		r:     r,
+		aead:  aead,
+		chunk: make([]byte, chunkSize+tagSize),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+func (s *streamReader) next() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		if n < tagSize {
+			return errors.New("encrypted bundle is truncated")
+		}
+		s.done = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one only if nothing follows it.
+		if _, err := s.r.Peek(1); err == io.EOF {
+			s.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	setLastFlag(&s.nonce, s.done)
+	plain, err := s.aead.Open(s.buf[:0], s.nonce[:], s.chunk[:n], nil)
+	if err != nil {
+		if s.done {
+			return errors.New("fail to decrypt the last chunk: the bundle is truncated or corrupted")
+		}
+		return errors.New("fail to decrypt chunk: the bundle is corrupted or the key is wrong")
+	}
+	s.buf = plain
+	s.plain = plain
+	return incrementCounter(&s.nonce)
+}
+
+func setLastFlag(nonce *[chacha20poly1305.NonceSize]byte, last bool) {
+	if last {
+		nonce[len(nonce)-1] = lastChunkFlag
+	} else {
+		nonce[len(nonce)-1] = 0
+	}
+}
+
+func incrementCounter(nonce *[chacha20poly1305.NonceSize]byte) error {
+	for i := len(nonce) - 2; i >= 0; i-- {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return nil
+		}
+	}
+	return errors.New("stream counter overflow")
+}
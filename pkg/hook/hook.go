@@ -0,0 +1,263 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+type EventType string
+
+const (
+	EventCreated    = EventType("created")
+	EventProgress   = EventType("progress")
+	EventReady      = EventType("ready")
+	EventDownloaded = EventType("downloaded")
+	EventFailed     = EventType("failed")
+)
+
+var AllEvents = []EventType{EventCreated, EventProgress, EventReady, EventDownloaded, EventFailed}
+
+const (
+	TypeWebhook = "webhook"
+	TypeSlack   = "slack"
+	TypeExec    = "exec"
+
+	defaultTimeout = 10 * time.Second
+)
+
+// Event is the payload sent to hooks on bundle lifecycle changes.
+type Event struct {
+	Type       EventType   `json:"event"`
+	Time       time.Time   `json:"time"`
+	ClusterURL string      `json:"clusterURL"`
+	IssueURL   string      `json:"issueURL,omitempty"`
+	BundleName string      `json:"bundleName,omitempty"`
+	Progress   int         `json:"progress"`
+	Bundle     interface{} `json:"bundle,omitempty"`
+	OutputPath string      `json:"outputPath,omitempty"`
+	SHA256     string      `json:"sha256,omitempty"`
+	Error      string      `json:"error,omitempty"`
+
+	// ServerVersion is the Harvester version of the cluster, if detected.
+	ServerVersion string `json:"serverVersion,omitempty"`
+}
+
+// Message returns a one-line human readable description of the event.
+func (e *Event) Message() string {
+	switch e.Type {
+	case EventCreated:
+		return fmt.Sprintf("Support bundle %s is being generated on %s", e.BundleName, e.ClusterURL)
+	case EventProgress:
+		return fmt.Sprintf("Support bundle %s is %d%% generated", e.BundleName, e.Progress)
+	case EventReady:
+		return fmt.Sprintf("Support bundle %s is ready for download", e.BundleName)
+	case EventDownloaded:
+		return fmt.Sprintf("Support bundle %s is saved to %s (sha256 %s)", e.BundleName, e.OutputPath, e.SHA256)
+	case EventFailed:
+		return fmt.Sprintf("Support bundle %s on %s failed: %s", e.BundleName, e.ClusterURL, e.Error)
+	}
+	return fmt.Sprintf("Support bundle %s: %s", e.BundleName, e.Type)
+}
+
+// Config configures a single hook. It can be read from the "hooks" key of the
+// config file:
+//
+//	hooks:
+//	- type: slack
+//	  url: https://hooks.slack.com/services/...
+//	  events: [ready, failed]
+//	- type: exec
+//	  command: [/usr/local/bin/notify.sh]
+type Config struct {
+	Type    string            `json:"type" mapstructure:"type"`
+	URL     string            `json:"url" mapstructure:"url"`
+	Command []string          `json:"command" mapstructure:"command"`
+	Headers map[string]string `json:"headers" mapstructure:"headers"`
+	// Events limits the hook to the listed events. All events are sent if
+	// empty.
+	Events   []string      `json:"events" mapstructure:"events"`
+	Timeout  time.Duration `json:"timeout" mapstructure:"timeout"`
+	Insecure bool          `json:"insecure" mapstructure:"insecure"`
+}
+
+// Hook receives bundle lifecycle events.
+type Hook interface {
+	Fire(ctx context.Context, e *Event) error
+}
+
+// New returns the hook for a config.
+func New(c Config) (Hook, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	events := map[EventType]bool{}
+	for _, e := range c.Events {
+		if !isValidEvent(EventType(e)) {
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+		events[EventType(e)] = true
+	}
+
+	var h Hook
+	switch c.Type {
+	case TypeWebhook, TypeSlack:
+		if c.URL == "" {
+			return nil, fmt.Errorf("%s hook requires a URL", c.Type)
+		}
+		h = &webhook{
+			url:        c.URL,
+			headers:    c.Headers,
+			slack:      c.Type == TypeSlack,
+			httpClient: utils.NewHTTPClient(timeout, c.Insecure),
+		}
+	case TypeExec:
+		if len(c.Command) == 0 {
+			return nil, fmt.Errorf("exec hook requires a command")
+		}
+		h = &command{args: c.Command, timeout: timeout}
+	default:
+		return nil, fmt.Errorf("unknown hook type %q", c.Type)
+	}
+
+	if len(events) > 0 {
+		h = &filter{hook: h, events: events}
+	}
+	return h, nil
+}
+
+func isValidEvent(e EventType) bool {
+	for _, valid := range AllEvents {
+		if e == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier fires events to a set of hooks.
+type Notifier struct {
+	Hooks []Hook
+}
+
+// Notify fires e to every hook, even if some fail. The failures are returned
+// together, it's up to the caller to report them, they shouldn't interrupt
+// the bundle flow.
+func (n *Notifier) Notify(ctx context.Context, e *Event) error {
+	if n == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	var failures []string
+	for _, h := range n.Hooks {
+		if err := h.Fire(ctx, e); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+type filter struct {
+	hook   Hook
+	events map[EventType]bool
+}
+
+func (f *filter) Fire(ctx context.Context, e *Event) error {
+	if !f.events[e.Type] {
+		return nil
+	}
+	return f.hook.Fire(ctx, e)
+}
+
+type webhook struct {
+	url        string
+	headers    map[string]string
+	slack      bool
+	httpClient *http.Client
+}
+
+// slackPayload is understood by Slack-compatible incoming webhooks, e.g.,
+// Slack, Mattermost and Rocket.Chat.
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+func (w *webhook) Fire(ctx context.Context, e *Event) error {
+	var payload interface{} = e
+	if w.slack {
+		payload = slackPayload{Text: e.Message()}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status: %s. Body: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// command runs a local program with the JSON payload on stdin and the main
+// fields in SUPPORT_BUNDLE_* environment variables.
+type command struct {
+	args    []string
+	timeout time.Duration
+}
+
+func (c *command) Fire(ctx context.Context, e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"SUPPORT_BUNDLE_EVENT="+string(e.Type),
+		"SUPPORT_BUNDLE_CLUSTER_URL="+e.ClusterURL,
+		"SUPPORT_BUNDLE_NAME="+e.BundleName,
+		"SUPPORT_BUNDLE_PROGRESS="+strconv.Itoa(e.Progress),
+		"SUPPORT_BUNDLE_OUTPUT="+e.OutputPath,
+		"SUPPORT_BUNDLE_SHA256="+e.SHA256,
+		"SUPPORT_BUNDLE_ERROR="+e.Error,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s. Output: %s", strings.Join(c.args, " "), err, bytes.TrimSpace(out))
+	}
+	return nil
+}
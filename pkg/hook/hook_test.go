@@ -0,0 +1,46 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recorder struct {
+	events []EventType
+	err    error
+}
+
+func (r *recorder) Fire(ctx context.Context, e *Event) error {
+	r.events = append(r.events, e.Type)
+	return r.err
+}
+
+func TestNotify(t *testing.T) {
+	failing := &recorder{err: errors.New("connection refused")}
+	ok := &recorder{}
+	filtered := &recorder{}
+	n := &Notifier{Hooks: []Hook{
+		failing,
+		ok,
+		&filter{hook: filtered, events: map[EventType]bool{EventFailed: true}},
+	}}
+
+	e := &Event{Type: EventReady}
+	err := n.Notify(context.Background(), e)
+	if err == nil || err.Error() != "connection refused" {
+		t.Errorf("got error %v, want the failure of the hook", err)
+	}
+	// A failing hook doesn't keep the others from firing.
+	if len(failing.events) != 1 || len(ok.events) != 1 || len(filtered.events) != 0 {
+		t.Errorf("got events %v, %v and %v", failing.events, ok.events, filtered.events)
+	}
+	if e.Time.IsZero() {
+		t.Error("event has no time")
+	}
+
+	var none *Notifier
+	if err := none.Notify(context.Background(), e); err != nil {
+		t.Errorf("got error %v without a notifier", err)
+	}
+}
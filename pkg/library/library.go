@@ -0,0 +1,318 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+const (
+	IndexVersion = 1
+	idLength     = 12
+
+	lockRetryInterval = 100 * time.Millisecond
+	lockTimeout       = 10 * time.Second
+	// staleLockAge is how old a lock file can get before it is considered
+	// left behind by a crashed process.
+	staleLockAge = time.Minute
+)
+
+var ErrNotFound = errors.New("bundle not found in library")
+
+// Entry records a bundle in the library.
+type Entry struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	ClusterURL  string    `json:"clusterURL,omitempty"`
+	IssueURL    string    `json:"issueURL,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Tags        []string  `json:"tags,omitempty"`
+
+	// ServerVersion is the Harvester version of the cluster, if detected.
+	ServerVersion string `json:"serverVersion,omitempty"`
+	// Files lists other files belonging to the bundle, e.g., the parts and
+	// index of a split bundle. They are deleted along with Path.
+	Files []string `json:"files,omitempty"`
+}
+
+// HasTag reports whether the entry is tagged with tag.
+func (e *Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type index struct {
+	Version int      `json:"version"`
+	Bundles []*Entry `json:"bundles"`
+}
+
+// Library is a JSON index of downloaded bundles. Every change re-reads the
+// index under a lock file, so concurrent processes, e.g., a scheduled
+// collection and a manual download, don't lose each other's entries.
+type Library struct {
+	path string
+}
+
+// DefaultPath returns the default index path, $HOME/.support-bundle-utils/library.json.
+func DefaultPath() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".support-bundle-utils", "library.json"), nil
+}
+
+func New(path string) *Library {
+	return &Library{path: path}
+}
+
+func (l *Library) Path() string {
+	return l.path
+}
+
+// NewEntry computes the size and checksum of the bundle at path.
+func NewEntry(name, path string) (*Entry, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	sum, size, err := utils.SHA256File(abs)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), ".zip")
+	}
+	return &Entry{
+		ID:        sum[:idLength],
+		Name:      name,
+		Path:      abs,
+		Size:      size,
+		SHA256:    sum,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Add registers an entry. An existing entry with the same ID is replaced, but
+// keeps its tags.
+func (l *Library) Add(e *Entry) error {
+	return l.update(func(idx *index) error {
+		for i, old := range idx.Bundles {
+			if old.ID == e.ID {
+				e.Tags = mergeTags(old.Tags, e.Tags)
+				idx.Bundles[i] = e
+				return nil
+			}
+		}
+		idx.Bundles = append(idx.Bundles, e)
+		return nil
+	})
+}
+
+// List returns all entries, newest first.
+func (l *Library) List() ([]*Entry, error) {
+	idx, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(idx.Bundles, func(i, j int) bool {
+		return idx.Bundles[i].CreatedAt.After(idx.Bundles[j].CreatedAt)
+	})
+	return idx.Bundles, nil
+}
+
+// Get returns the entry matching ref, which is an ID, an unambiguous ID
+// prefix or a bundle name.
+func (l *Library) Get(ref string) (*Entry, error) {
+	idx, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	return find(idx, ref)
+}
+
+// Tag adds tags to an entry, or removes them if remove is set.
+func (l *Library) Tag(ref string, tags []string, remove bool) (*Entry, error) {
+	var entry *Entry
+	err := l.update(func(idx *index) error {
+		e, err := find(idx, ref)
+		if err != nil {
+			return err
+		}
+		if remove {
+			var kept []string
+			for _, t := range e.Tags {
+				if !contains(tags, t) {
+					kept = append(kept, t)
+				}
+			}
+			e.Tags = kept
+		} else {
+			e.Tags = mergeTags(e.Tags, tags)
+		}
+		entry = e
+		return nil
+	})
+	return entry, err
+}
+
+// Remove removes the entries for which match returns true and returns them.
+// Bundle files are removed as well if deleteFiles is set, once the index is
+// written, so a failure never leaves entries pointing to deleted files.
+func (l *Library) Remove(match func(*Entry) bool, deleteFiles bool) ([]*Entry, error) {
+	var removed []*Entry
+	err := l.update(func(idx *index) error {
+		var kept []*Entry
+		for _, e := range idx.Bundles {
+			if match(e) {
+				removed = append(removed, e)
+			} else {
+				kept = append(kept, e)
+			}
+		}
+		idx.Bundles = kept
+		return nil
+	})
+	if err != nil || !deleteFiles {
+		return removed, err
+	}
+
+	var failed []string
+	for _, e := range removed {
+		for _, path := range append([]string{e.Path}, e.Files...) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				failed = append(failed, err.Error())
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return removed, fmt.Errorf("fail to delete bundle files: %s", strings.Join(failed, "; "))
+	}
+	return removed, nil
+}
+
+func find(idx *index, ref string) (*Entry, error) {
+	var matches []*Entry
+	for _, e := range idx.Bundles {
+		if e.ID == ref || e.Name == ref {
+			return e, nil
+		}
+		if strings.HasPrefix(e.ID, ref) {
+			matches = append(matches, e)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, ErrNotFound
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%q matches %d bundles", ref, len(matches))
+}
+
+func (l *Library) read() (*index, error) {
+	data, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return &index{Version: IndexVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("malformed library index %s: %s", l.path, err)
+	}
+	if idx.Version != IndexVersion {
+		return nil, fmt.Errorf("unsupported library index version %d", idx.Version)
+	}
+	return &idx, nil
+}
+
+func (l *Library) update(fn func(*index) error) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	idx, err := l.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(idx); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func (l *Library) lock() (func(), error) {
+	lockPath := l.path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout waiting for library lock %s", lockPath)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func mergeTags(a, b []string) []string {
+	merged := append([]string{}, a...)
+	for _, t := range b {
+		if !contains(merged, t) {
+			merged = append(merged, t)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
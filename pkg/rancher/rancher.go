@@ -0,0 +1,114 @@
+package rancher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+const (
+	// ProviderHarvester is the provider of Harvester clusters imported into
+	// Rancher.
+	ProviderHarvester = "harvester"
+	providerLabel     = "provider.cattle.io"
+)
+
+// Cluster is a downstream cluster managed by Rancher.
+type Cluster struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	State    string            `json:"state"`
+	Provider string            `json:"provider"`
+	Driver   string            `json:"driver"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// IsHarvester reports whether the cluster is a Harvester cluster.
+func (c *Cluster) IsHarvester() bool {
+	return c.Provider == ProviderHarvester || c.Driver == ProviderHarvester || c.Labels[providerLabel] == ProviderHarvester
+}
+
+// Client talks to the Rancher API with an API token, e.g.,
+// token-abcde:secret.
+type Client struct {
+	URL   string
+	Token string
+
+	httpClient *http.Client
+}
+
+func NewClient(rancherURL, token string, insecure bool) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(rancherURL, "/"),
+		Token:      token,
+		httpClient: utils.NewHTTPClient(30*time.Second, insecure),
+	}
+}
+
+// ProxyURL returns the base URL that proxies requests to a cluster.
+func (c *Client) ProxyURL(clusterID string) string {
+	return c.URL + "/k8s/clusters/" + url.PathEscape(clusterID)
+}
+
+// Clusters lists the clusters the token has access to, sorted by name.
+func (c *Client) Clusters(ctx context.Context) ([]Cluster, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+"/v3/clusters?limit=-1", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s. Body: %s", resp.Status, body)
+	}
+
+	var collection struct {
+		Data []Cluster `json:"data"`
+	}
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return nil, fmt.Errorf("unexpected response from %s: %s", c.URL, err)
+	}
+	sort.Slice(collection.Data, func(i, j int) bool { return collection.Data[i].Name < collection.Data[j].Name })
+	return collection.Data, nil
+}
+
+// Resolve finds a Harvester cluster by ID or name.
+func (c *Client) Resolve(ctx context.Context, ref string) (*Cluster, error) {
+	clusters, err := c.Clusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Cluster
+	for _, cluster := range clusters {
+		if cluster.ID == ref {
+			return &cluster, nil
+		}
+		if cluster.Name == ref && cluster.IsHarvester() {
+			matches = append(matches, cluster)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no Harvester cluster %q in Rancher", ref)
+	case 1:
+		return &matches[0], nil
+	}
+	return nil, fmt.Errorf("%d Harvester clusters are named %q, use the cluster ID", len(matches), ref)
+}
@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+const contextName = "support-bundle-replay"
+
+// WriteKubeconfig writes a kubeconfig pointing at the server at serverURL.
+func (s *Server) WriteKubeconfig(path, serverURL string) error {
+	config := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Config",
+		"clusters": []interface{}{
+			map[string]interface{}{
+				"name": contextName,
+				"cluster": map[string]interface{}{
+					"server":                     serverURL,
+					"certificate-authority-data": base64.StdEncoding.EncodeToString(s.caPEM),
+				},
+			},
+		},
+		"users": []interface{}{
+			map[string]interface{}{
+				"name": contextName,
+				"user": map[string]interface{}{
+					"token": s.token,
+				},
+			},
+		},
+		"contexts": []interface{}{
+			map[string]interface{}{
+				"name": contextName,
+				"context": map[string]interface{}{
+					"cluster":   contextName,
+					"user":      contextName,
+					"namespace": "default",
+				},
+			},
+		},
+		"current-context": contextName,
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,320 @@
+package replay
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// resourceVersion is reported for every list. A bundle is a snapshot, so it
+// never changes.
+const resourceVersion = "1"
+
+// Server is a read-only Kubernetes API server serving the resources of a
+// bundle. It supports discovery, get and list with label and field selectors,
+// and table output, which is what kubectl get needs.
+type Server struct {
+	idx   *resources.Index
+	token string
+	caPEM []byte
+	cert  tls.Certificate
+}
+
+// New creates a server for the resources in idx with a self-signed
+// certificate for hosts and a random bearer token.
+func New(idx *resources.Index, hosts []string) (*Server, error) {
+	cert, caPEM, err := selfSignedCert(hosts)
+	if err != nil {
+		return nil, fmt.Errorf("fail to generate certificate: %s", err)
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Server{idx: idx, token: hex.EncodeToString(b), caPEM: caPEM, cert: cert}, nil
+}
+
+// Serve serves the API over HTTPS on l until it fails.
+func (s *Server) Serve(l net.Listener) error {
+	srv := &http.Server{
+		Handler:   s.Handler(),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{s.cert}},
+	}
+	return srv.ServeTLS(l, "", "")
+}
+
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+s.token)) != 1 {
+			writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "Unauthorized")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed,
+				"the server serves a support bundle and is read-only")
+			return
+		}
+		s.serveGet(w, r)
+	})
+}
+
+func (s *Server) serveGet(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/version":
+		writeJSON(w, http.StatusOK, map[string]string{
+			"major":      "1",
+			"minor":      "",
+			"gitVersion": "v0.0.0-support-bundle",
+			"platform":   "replay",
+		})
+	case r.URL.Path == "/healthz", r.URL.Path == "/readyz", r.URL.Path == "/livez":
+		w.Write([]byte("ok"))
+	case r.URL.Path == "/api":
+		writeJSON(w, http.StatusOK, &metav1.APIVersions{
+			TypeMeta: metav1.TypeMeta{Kind: "APIVersions"},
+			Versions: []string{"v1"},
+			ServerAddressByClientCIDRs: []metav1.ServerAddressByClientCIDR{
+				{ClientCIDR: "0.0.0.0/0", ServerAddress: r.Host},
+			},
+		})
+	case r.URL.Path == "/apis":
+		writeJSON(w, http.StatusOK, &metav1.APIGroupList{
+			TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"},
+			Groups:   s.groups(),
+		})
+	case segments[0] == "api" && len(segments) >= 2:
+		s.serveResources(w, r, schema.GroupVersion{Version: segments[1]}, segments[2:])
+	case segments[0] == "apis" && len(segments) == 2:
+		for _, g := range s.groups() {
+			if g.Name == segments[1] {
+				g.TypeMeta = metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"}
+				writeJSON(w, http.StatusOK, &g)
+				return
+			}
+		}
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+	case segments[0] == "apis" && len(segments) >= 3:
+		s.serveResources(w, r, schema.GroupVersion{Group: segments[1], Version: segments[2]}, segments[3:])
+	default:
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+	}
+}
+
+// groups returns the API groups in the bundle, except the core group.
+func (s *Server) groups() []metav1.APIGroup {
+	versions := map[string][]string{}
+	for _, t := range s.idx.Types() {
+		if t.Group == "" || contains(versions[t.Group], t.Version) {
+			continue
+		}
+		versions[t.Group] = append(versions[t.Group], t.Version)
+	}
+	var groups []metav1.APIGroup
+	for name, vs := range versions {
+		sort.Slice(vs, func(i, j int) bool { return version.CompareKubeAwareVersionStrings(vs[i], vs[j]) > 0 })
+		g := metav1.APIGroup{Name: name}
+		for _, v := range vs {
+			g.Versions = append(g.Versions, metav1.GroupVersionForDiscovery{GroupVersion: name + "/" + v, Version: v})
+		}
+		g.PreferredVersion = g.Versions[0]
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// serveResources serves the paths below a group version:
+//
+//	{resource}
+//	{resource}/{name}
+//	namespaces/{namespace}/{resource}
+//	namespaces/{namespace}/{resource}/{name}
+func (s *Server) serveResources(w http.ResponseWriter, r *http.Request, gv schema.GroupVersion, segments []string) {
+	var types []*resources.Type
+	for _, t := range s.idx.Types() {
+		if t.GroupVersion() == gv {
+			types = append(types, t)
+		}
+	}
+	if len(types) == 0 {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+		return
+	}
+	if len(segments) == 0 || segments[0] == "" {
+		s.serveResourceList(w, gv, types)
+		return
+	}
+
+	namespace := ""
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		namespace, segments = segments[1], segments[2:]
+	}
+	if len(segments) > 2 {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+		return
+	}
+	var t *resources.Type
+	for _, candidate := range types {
+		if candidate.Resource == segments[0] {
+			t = candidate
+		}
+	}
+	if t == nil {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "the server could not find the requested resource")
+		return
+	}
+	if r.URL.Query().Get("watch") == "true" || r.URL.Query().Get("watch") == "1" {
+		writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, "watch is not supported for a support bundle")
+		return
+	}
+
+	var objs []*unstructured.Unstructured
+	single := len(segments) == 2
+	if single {
+		obj := s.idx.Get(t, namespace, segments[1])
+		if obj == nil {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound,
+				fmt.Sprintf("%s %q not found", t.GroupResource(), segments[1]))
+			return
+		}
+		objs = append(objs, obj)
+	} else {
+		opts := resources.ListOptions{Namespace: namespace}
+		var err error
+		if selector := r.URL.Query().Get("labelSelector"); selector != "" {
+			if opts.Selector, err = labels.Parse(selector); err != nil {
+				writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+				return
+			}
+		}
+		if opts.Fields, err = resources.ParseFieldQueries(r.URL.Query().Get("fieldSelector")); err != nil {
+			writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		}
+		if objs, err = s.idx.List(t, opts); err != nil {
+			writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.serveTable(w, t, objs)
+		return
+	}
+	if single {
+		writeJSON(w, http.StatusOK, objs[0].Object)
+		return
+	}
+	items := make([]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, obj.Object)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"apiVersion": gv.String(),
+		"kind":       t.Kind + "List",
+		"metadata":   map[string]interface{}{"resourceVersion": resourceVersion},
+		"items":      items,
+	})
+}
+
+func (s *Server) serveResourceList(w http.ResponseWriter, gv schema.GroupVersion, types []*resources.Type) {
+	list := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: gv.String(),
+	}
+	for _, t := range types {
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:         t.Resource,
+			SingularName: strings.ToLower(t.Kind),
+			Namespaced:   t.Namespaced,
+			Kind:         t.Kind,
+			Verbs:        metav1.Verbs{"get", "list"},
+			ShortNames:   t.ShortNames,
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// serveTable serves objects as a meta.k8s.io/v1 Table, which kubectl asks for
+// to print them. kubectl adds the namespace column itself.
+func (s *Server) serveTable(w http.ResponseWriter, t *resources.Type, objs []*unstructured.Unstructured) {
+	view := s.idx.NewTable(t, objs, false, true)
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{Kind: "Table", APIVersion: "meta.k8s.io/v1"},
+		ListMeta: metav1.ListMeta{ResourceVersion: resourceVersion},
+		Rows:     []metav1.TableRow{},
+	}
+	for i, header := range view.Headers {
+		c := metav1.TableColumnDefinition{Name: header, Type: "string"}
+		if header == "NAME" {
+			c.Format = "name"
+		}
+		if view.Wide[i] {
+			c.Priority = 1
+		}
+		table.ColumnDefinitions = append(table.ColumnDefinitions, c)
+	}
+	for i, obj := range objs {
+		row := metav1.TableRow{}
+		for _, cell := range view.Rows[i] {
+			row.Cells = append(row.Cells, cell)
+		}
+		partial := &metav1.PartialObjectMetadata{
+			TypeMeta: metav1.TypeMeta{Kind: "PartialObjectMetadata", APIVersion: "meta.k8s.io/v1"},
+		}
+		partial.Name = obj.GetName()
+		partial.Namespace = obj.GetNamespace()
+		partial.Labels = obj.GetLabels()
+		partial.CreationTimestamp = obj.GetCreationTimestamp()
+		raw, err := json.Marshal(partial)
+		if err != nil {
+			writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+			return
+		}
+		row.Object = runtime.RawExtension{Raw: raw}
+		table.Rows = append(table.Rows, row)
+	}
+	writeJSON(w, http.StatusOK, table)
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	writeJSON(w, code, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,240 @@
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testVMs = `apiVersion: kubevirt.io/v1
+kind: VirtualMachineList
+items:
+- metadata:
+    name: vm1
+    namespace: default
+    labels:
+      app: web
+  status:
+    printableStatus: Running
+- metadata:
+    name: vm2
+    namespace: default
+    labels:
+      app: db
+  status:
+    printableStatus: Stopped
+- metadata:
+    name: vm3
+    namespace: prod
+    labels:
+      app: web
+  status:
+    printableStatus: Running
+`
+
+const testNodes = `apiVersion: v1
+kind: NodeList
+items:
+- metadata:
+    name: node1
+`
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range map[string]string{"virtualmachines.yaml": testVMs, "nodes.yaml": testNodes} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := resources.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(idx, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// get requests path with the token unless token is empty, and decodes the
+// JSON response into v.
+func get(t *testing.T, ts *httptest.Server, token, path, accept string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("%s: %s", path, err)
+	}
+	return resp.StatusCode
+}
+
+func TestDiscovery(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	var versions metav1.APIVersions
+	if code := get(t, ts, s.token, "/api", "", &versions); code != http.StatusOK || len(versions.Versions) != 1 || versions.Versions[0] != "v1" {
+		t.Errorf("/api: got %d %+v", code, versions)
+	}
+
+	var groups metav1.APIGroupList
+	if code := get(t, ts, s.token, "/apis", "", &groups); code != http.StatusOK || len(groups.Groups) != 1 || groups.Groups[0].Name != "kubevirt.io" {
+		t.Errorf("/apis: got %d %+v", code, groups)
+	}
+
+	var group metav1.APIGroup
+	code := get(t, ts, s.token, "/apis/kubevirt.io", "", &group)
+	if code != http.StatusOK || group.Kind != "APIGroup" || group.PreferredVersion.GroupVersion != "kubevirt.io/v1" {
+		t.Errorf("/apis/kubevirt.io: got %d %+v", code, group)
+	}
+	var status metav1.Status
+	if code := get(t, ts, s.token, "/apis/longhorn.io", "", &status); code != http.StatusNotFound || status.Reason != metav1.StatusReasonNotFound {
+		t.Errorf("/apis/longhorn.io: got %d %+v", code, status)
+	}
+
+	var resourceList metav1.APIResourceList
+	code = get(t, ts, s.token, "/apis/kubevirt.io/v1", "", &resourceList)
+	if code != http.StatusOK || len(resourceList.APIResources) != 1 {
+		t.Fatalf("/apis/kubevirt.io/v1: got %d %+v", code, resourceList)
+	}
+	vm := resourceList.APIResources[0]
+	if vm.Name != "virtualmachines" || vm.Kind != "VirtualMachine" || !vm.Namespaced || strings.Join(vm.ShortNames, ",") != "vm,vms" {
+		t.Errorf("got resource %+v", vm)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	s, ts := newTestServer(t)
+	for _, token := range []string{"", "wrong", s.token + "x"} {
+		var status metav1.Status
+		code := get(t, ts, token, "/api/v1/nodes", "", &status)
+		if code != http.StatusUnauthorized || status.Reason != metav1.StatusReasonUnauthorized {
+			t.Errorf("token %q: got %d %+v", token, code, status)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	s, ts := newTestServer(t)
+	tests := []struct {
+		path     string
+		wantCode int
+		want     string
+	}{
+		{"/apis/kubevirt.io/v1/virtualmachines", http.StatusOK, "default/vm1 default/vm2 prod/vm3"},
+		{"/apis/kubevirt.io/v1/namespaces/default/virtualmachines", http.StatusOK, "default/vm1 default/vm2"},
+		{"/apis/kubevirt.io/v1/namespaces/default/virtualmachines?labelSelector=app%3Dweb", http.StatusOK, "default/vm1"},
+		{"/apis/kubevirt.io/v1/virtualmachines?labelSelector=app%3Dweb&fieldSelector=metadata.namespace%21%3Ddefault", http.StatusOK, "prod/vm3"},
+		{"/apis/kubevirt.io/v1/namespaces/default/virtualmachines?fieldSelector=status.printableStatus%3DStopped", http.StatusOK, "default/vm2"},
+		{"/apis/kubevirt.io/v1/namespaces/default/virtualmachines?labelSelector=app+in+%28", http.StatusBadRequest, ""},
+		{"/apis/kubevirt.io/v1/namespaces/default/virtualmachines?fieldSelector=status", http.StatusBadRequest, ""},
+		{"/apis/kubevirt.io/v1/namespaces/default/virtualmachineinstances", http.StatusNotFound, ""},
+		{"/api/v1/nodes", http.StatusOK, "/node1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var list struct {
+				Kind     string                 `json:"kind"`
+				Metadata map[string]interface{} `json:"metadata"`
+				Items    []struct {
+					Metadata metav1.ObjectMeta `json:"metadata"`
+				} `json:"items"`
+			}
+			code := get(t, ts, s.token, tt.path, "", &list)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d, want %d", code, tt.wantCode)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			if !strings.HasSuffix(list.Kind, "List") || list.Metadata["resourceVersion"] != resourceVersion {
+				t.Errorf("got kind %q, metadata %v", list.Kind, list.Metadata)
+			}
+			var got []string
+			for _, item := range list.Items {
+				got = append(got, item.Metadata.Namespace+"/"+item.Metadata.Name)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	var obj map[string]interface{}
+	code := get(t, ts, s.token, "/apis/kubevirt.io/v1/namespaces/prod/virtualmachines/vm3", "", &obj)
+	if code != http.StatusOK || obj["kind"] != "VirtualMachine" {
+		t.Errorf("got %d %v", code, obj)
+	}
+
+	var status metav1.Status
+	code = get(t, ts, s.token, "/apis/kubevirt.io/v1/namespaces/default/virtualmachines/vm3", "", &status)
+	if code != http.StatusNotFound || !strings.Contains(status.Message, `"vm3" not found`) {
+		t.Errorf("got %d %+v", code, status)
+	}
+
+	code = get(t, ts, s.token, "/apis/kubevirt.io/v1/namespaces/default/virtualmachines?watch=true", "", &status)
+	if code != http.StatusMethodNotAllowed {
+		t.Errorf("watch: got %d %+v", code, status)
+	}
+}
+
+func TestTable(t *testing.T) {
+	s, ts := newTestServer(t)
+	accept := "application/json;as=Table;v=v1;g=meta.k8s.io,application/json"
+
+	var table metav1.Table
+	code := get(t, ts, s.token, "/apis/kubevirt.io/v1/namespaces/default/virtualmachines?labelSelector=app%3Dweb", accept, &table)
+	if code != http.StatusOK || table.Kind != "Table" {
+		t.Fatalf("got %d %+v", code, table)
+	}
+	if len(table.ColumnDefinitions) == 0 || table.ColumnDefinitions[0].Name != "NAME" || table.ColumnDefinitions[0].Format != "name" {
+		t.Errorf("got columns %+v", table.ColumnDefinitions)
+	}
+	if len(table.Rows) != 1 || table.Rows[0].Cells[0] != "vm1" {
+		t.Fatalf("got rows %+v", table.Rows)
+	}
+	var partial metav1.PartialObjectMetadata
+	if err := json.Unmarshal(table.Rows[0].Object.Raw, &partial); err != nil {
+		t.Fatal(err)
+	}
+	if partial.Kind != "PartialObjectMetadata" || partial.Namespace != "default" || partial.Name != "vm1" {
+		t.Errorf("got row object %+v", partial)
+	}
+
+	code = get(t, ts, s.token, "/apis/kubevirt.io/v1/namespaces/prod/virtualmachines/vm3", accept, &table)
+	if code != http.StatusOK || len(table.Rows) != 1 || table.Rows[0].Cells[0] != "vm3" {
+		t.Errorf("get as table: got %d %+v", code, table.Rows)
+	}
+}
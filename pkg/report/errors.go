@@ -0,0 +1,90 @@
+package report
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errorLine matches the error lines of the common log formats: logrus, JSON,
+// klog and plain level prefixes.
+var errorLine = regexp.MustCompile(`level=(?:error|fatal|panic)\b|"level":"(?:error|fatal|panic)"|(?:^|\s)[EF]\d{4} \d{2}:\d{2}:\d{2}|\b(?:ERROR|FATAL)\b|^panic: `)
+
+// LogErrorReport counts the error lines in the pod logs of a bundle.
+type LogErrorReport struct {
+	Total int `json:"total"`
+	// Sources are the logs with errors, most errors first.
+	Sources []LogErrorSource `json:"sources"`
+	// PerMinute counts the timestamped error lines by minute.
+	PerMinute map[time.Time]int `json:"-"`
+}
+
+// LogErrorSource counts the error lines of a log.
+type LogErrorSource struct {
+	// Name is the log path under logs/, e.g., namespace/pod/container.log.
+	Name  string    `json:"name"`
+	Count int       `json:"count"`
+	Last  time.Time `json:"last,omitempty"`
+	// Example is the last error line.
+	Example string `json:"example"`
+}
+
+// podLog returns the name of a pod log under logs/, or "" if name isn't one.
+// Node logs are left to the nodes report.
+func podLog(name string) string {
+	i := strings.Index("/"+name, "/logs/")
+	if i < 0 || nodeLog(name) != "" || !isTextLog(name) {
+		return ""
+	}
+	return name[i+len("logs/"):]
+}
+
+// LogErrors counts the error lines in the pod logs of a bundle. collectedAt
+// is used to complete klog timestamps without a year.
+func LogErrors(bundle string, collectedAt time.Time) (*LogErrorReport, error) {
+	report := &LogErrorReport{PerMinute: map[time.Time]int{}}
+	sources := map[string]*LogErrorSource{}
+
+	match := func(name string) bool {
+		return podLog(name) != ""
+	}
+	err := walkFiles(bundle, false, match, func(name string, r io.Reader) error {
+		return scanLines(r, func(line string) {
+			if !errorLine.MatchString(line) {
+				return
+			}
+			log := podLog(name)
+			source := sources[log]
+			if source == nil {
+				source = &LogErrorSource{Name: log}
+				sources[log] = source
+			}
+			report.Total++
+			source.Count++
+			source.Example = truncate(strings.TrimSpace(line), maxMessageSize)
+			if ts, ok := ParseTimestamp(line, collectedAt); ok {
+				report.PerMinute[ts.Truncate(time.Minute)]++
+				if ts.After(source.Last) {
+					source.Last = ts
+				}
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sources {
+		report.Sources = append(report.Sources, *s)
+	}
+	sort.Slice(report.Sources, func(i, j int) bool {
+		a, b := report.Sources[i], report.Sources[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	return report, nil
+}
@@ -0,0 +1,112 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxNestedSize bounds the size of nested archives, which are read in memory.
+const maxNestedSize = 512 * 1024 * 1024
+
+// walkFunc is called for every file of a bundle matched by a walk. name is
+// the slash separated path in the bundle. Files in nested archives are named
+// after the archive, e.g., nodes/node1.zip!/logs/dmesg.log.
+type walkFunc func(name string, r io.Reader) error
+
+// walkFiles calls fn for the files of a bundle zip or an extracted bundle
+// directory whose names match. Matching nested zip archives, e.g., node
+// archives, are walked too when nested is set.
+func walkFiles(bundle string, nested bool, match func(name string) bool, fn walkFunc) error {
+	info, err := os.Stat(bundle)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		zr, err := zip.OpenReader(bundle)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return walkZip(&zr.Reader, "", nested, match, fn)
+	}
+
+	return filepath.Walk(bundle, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(bundle, p)
+		name := filepath.ToSlash(rel)
+		isZip := strings.HasSuffix(strings.ToLower(name), ".zip")
+		if !match(name) {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if nested && isZip {
+			zr, err := zip.NewReader(f, info.Size())
+			if err != nil {
+				// not an archive after all
+				return nil
+			}
+			return walkZip(zr, name+"!/", nested, match, fn)
+		}
+		return fn(name, f)
+	})
+}
+
+func walkZip(zr *zip.Reader, prefix string, nested bool, match func(name string) bool, fn walkFunc) error {
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		name := prefix + f.Name
+		isZip := strings.HasSuffix(strings.ToLower(f.Name), ".zip")
+		if !match(name) {
+			continue
+		}
+		if nested && isZip {
+			if f.UncompressedSize64 > maxNestedSize {
+				continue
+			}
+			data, err := readZipFile(f)
+			if err != nil {
+				return err
+			}
+			nr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				continue
+			}
+			if err := walkZip(nr, name+"!/", nested, match, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
@@ -0,0 +1,30 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+)
+
+// Highlights runs the reports on a bundle and returns its findings as one
+// line each, errors first, e.g., for issue summaries. At most max findings
+// are returned, followed by a line counting the others.
+func Highlights(bundle string, max int) ([]string, error) {
+	idx, err := resources.Load(bundle)
+	if err != nil {
+		return nil, err
+	}
+	r, err := HTML(idx, bundle, HTMLOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for i, f := range r.Findings {
+		if i == max {
+			lines = append(lines, fmt.Sprintf("and %d more, see `report html`", len(r.Findings)-max))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s %s: %s", f.Severity, f.Area, f.Object, f.Message))
+	}
+	return lines, nil
+}
@@ -0,0 +1,66 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+const highlightsNodes = `apiVersion: v1
+kind: NodeList
+items:
+- metadata:
+    name: node1
+  status:
+    conditions:
+    - type: Ready
+      status: "False"
+- metadata:
+    name: node2
+  status:
+    conditions:
+    - type: Ready
+      status: "True"
+`
+
+const highlightsVMs = `apiVersion: kubevirt.io/v1
+kind: VirtualMachineList
+items:
+- metadata:
+    name: vm1
+    namespace: default
+  status:
+    printableStatus: Starting
+- metadata:
+    name: vm2
+    namespace: default
+  status:
+    printableStatus: CrashLoopBackOff
+`
+
+func TestHighlights(t *testing.T) {
+	bundle := writeBundle(t, map[string]string{
+		"yamls/cluster/v1/nodes.yaml":                                  highlightsNodes,
+		"yamls/namespaced/default/kubevirt.io/v1/virtualmachines.yaml": highlightsVMs,
+	})
+
+	got, err := Highlights(bundle, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"error: node node1: node is not ready",
+		"error: vm default/vm2: VM status is CrashLoopBackOff",
+		"warning: vm default/vm1: VM is Starting but has no instance",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got highlights\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	got, err = Highlights(bundle, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1] != "and 2 more, see `report html`" {
+		t.Errorf("got highlights %q", got)
+	}
+}
@@ -0,0 +1,353 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	kindSupportBundle    = schema.GroupKind{Group: "harvesterhci.io", Kind: "SupportBundle"}
+	kindHarvesterSetting = schema.GroupKind{Group: "harvesterhci.io", Kind: "Setting"}
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+
+	// topSources is the number of error sources and event reasons charted.
+	topSources = 10
+)
+
+// HTMLOptions tunes the HTML report.
+type HTMLOptions struct {
+	Title string
+	// IssueURL and Description override the ones recorded in the bundle.
+	IssueURL    string
+	Description string
+}
+
+// HTMLReport is a self-contained summary of a bundle for tickets and
+// escalations.
+type HTMLReport struct {
+	Title       string
+	Bundle      string
+	IssueURL    string
+	Description string
+	CollectedAt time.Time
+	GeneratedAt time.Time
+	Overview    Overview
+	Findings    []Finding
+	Nodes       []NodeHealth
+	VMs         []*VMReport
+	Longhorn    *LonghornReport
+	LogErrors   *LogErrorReport
+	// WarningEvents counts the warning events by minute of their last
+	// occurrence.
+	WarningEvents map[time.Time]int
+	// WarningReasons counts the warning events by reason.
+	WarningReasons map[string]int
+}
+
+// Overview counts the main objects of a cluster.
+type Overview struct {
+	KubernetesVersion string
+	HarvesterVersion  string
+	Nodes             int
+	ReadyNodes        int
+	VMs               int
+	RunningVMs        int
+	Pods              int
+	RunningPods       int
+	Volumes           int
+	HealthyVolumes    int
+	WarningEvents     int
+	LogErrors         int
+}
+
+// Finding is a problem found by one of the reports.
+type Finding struct {
+	Severity string
+	// Area is the report that found the problem, e.g., vm or longhorn.
+	Area    string
+	Object  string
+	Message string
+}
+
+// NodeHealth is the status of a node and the problems found in its logs.
+type NodeHealth struct {
+	Name    string
+	Ready   string
+	Roles   string
+	Version string
+	Logs    *NodeReport
+}
+
+// Count returns the number of times a finding was seen in the node logs.
+func (n NodeHealth) Count(f NodeFinding) int {
+	if n.Logs == nil || n.Logs.Findings[f] == nil {
+		return 0
+	}
+	return n.Logs.Findings[f].Count
+}
+
+// severeFindings are the node log findings reported as errors, the others
+// are warnings.
+var severeFindings = map[NodeFinding]bool{
+	FindingOOM:      true,
+	FindingPanic:    true,
+	FindingIOError:  true,
+	FindingReadOnly: true,
+}
+
+// HTML runs the VM, Longhorn, nodes and log error reports on a bundle and
+// combines them in a single report.
+func HTML(idx *resources.Index, bundle string, opts HTMLOptions) (*HTMLReport, error) {
+	r := &HTMLReport{
+		Title:          opts.Title,
+		Bundle:         filepath.Base(bundle),
+		CollectedAt:    idx.CollectedAt,
+		GeneratedAt:    time.Now(),
+		WarningEvents:  map[time.Time]int{},
+		WarningReasons: map[string]int{},
+	}
+	if r.Title == "" {
+		r.Title = "Support bundle " + strings.TrimSuffix(r.Bundle, ".zip")
+	}
+	r.IssueURL, r.Description = bundleIssue(idx, bundle)
+	if opts.IssueURL != "" {
+		r.IssueURL = opts.IssueURL
+	}
+	if opts.Description != "" {
+		r.Description = opts.Description
+	}
+
+	var err error
+	r.VMs = VMs(idx, VMOptions{})
+	if r.Longhorn, err = Longhorn(idx, bundle); err != nil {
+		return nil, err
+	}
+	nodeLogs, err := Nodes(bundle, idx.CollectedAt)
+	if err != nil {
+		return nil, err
+	}
+	if r.LogErrors, err = LogErrors(bundle, idx.CollectedAt); err != nil {
+		return nil, err
+	}
+	r.Nodes = nodeHealth(idx, nodeLogs)
+
+	o := &r.Overview
+	o.HarvesterVersion = str(harvesterSetting(idx, "server-version"), "value")
+	for _, n := range r.Nodes {
+		o.Nodes++
+		if n.Ready == "True" {
+			o.ReadyNodes++
+		}
+		if o.KubernetesVersion == "" {
+			o.KubernetesVersion = n.Version
+		}
+	}
+	for _, vm := range r.VMs {
+		o.VMs++
+		if runningStatuses[vm.Status] {
+			o.RunningVMs++
+		}
+	}
+	for _, pod := range idx.Objects(kindPod, "") {
+		o.Pods++
+		if phase := str(pod, "status", "phase"); phase == "Running" || phase == "Succeeded" {
+			o.RunningPods++
+		}
+	}
+	for _, v := range r.Longhorn.Volumes {
+		o.Volumes++
+		if v.Robustness == "healthy" {
+			o.HealthyVolumes++
+		}
+	}
+	for _, e := range idx.Objects(kindEvent, "") {
+		if str(e, "type") != "Warning" {
+			continue
+		}
+		count, _, _ := unstructured.NestedInt64(e.Object, "count")
+		if count < 1 {
+			count = 1
+		}
+		o.WarningEvents += int(count)
+		r.WarningEvents[eventTime(e).Truncate(time.Minute)] += int(count)
+		r.WarningReasons[str(e, "reason")] += int(count)
+	}
+	o.LogErrors = r.LogErrors.Total
+
+	r.Findings = findings(r)
+	return r, nil
+}
+
+// bundleIssue returns the issue URL and description recorded in the
+// SupportBundle resource of the bundle, or of the latest bundle if it can't
+// be told from the file name.
+func bundleIssue(idx *resources.Index, bundle string) (string, string) {
+	var latest *unstructured.Unstructured
+	for _, sb := range idx.Objects(kindSupportBundle, "") {
+		if strings.Contains(filepath.Base(bundle), sb.GetName()) {
+			latest = sb
+			break
+		}
+		if latest == nil || sb.GetCreationTimestamp().After(latest.GetCreationTimestamp().Time) {
+			latest = sb
+		}
+	}
+	return str(latest, "spec", "issueURL"), str(latest, "spec", "description")
+}
+
+func harvesterSetting(idx *resources.Index, name string) *unstructured.Unstructured {
+	for _, s := range idx.Objects(kindHarvesterSetting, "") {
+		if s.GetName() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// nodeHealth merges the nodes in idx with the nodes that have logs in the
+// bundle.
+func nodeHealth(idx *resources.Index, logs []*NodeReport) []NodeHealth {
+	byNode := map[string]*NodeReport{}
+	for _, l := range logs {
+		byNode[l.Name] = l
+	}
+	var nodes []NodeHealth
+	for _, n := range idx.Objects(kindNode, "") {
+		var roles []string
+		for label := range n.GetLabels() {
+			if strings.HasPrefix(label, "node-role.kubernetes.io/") {
+				roles = append(roles, strings.TrimPrefix(label, "node-role.kubernetes.io/"))
+			}
+		}
+		sort.Strings(roles)
+		nodes = append(nodes, NodeHealth{
+			Name:    n.GetName(),
+			Ready:   conditionStatus(n, "Ready"),
+			Roles:   strings.Join(roles, ","),
+			Version: str(n, "status", "nodeInfo", "kubeletVersion"),
+			Logs:    byNode[n.GetName()],
+		})
+		delete(byNode, n.GetName())
+	}
+	for _, l := range logs {
+		if byNode[l.Name] != nil {
+			nodes = append(nodes, NodeHealth{Name: l.Name, Logs: l})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+// findings collects the issues of the reports, errors first.
+func findings(r *HTMLReport) []Finding {
+	var result []Finding
+	for _, n := range r.Nodes {
+		if n.Ready != "" && n.Ready != "True" {
+			result = append(result, Finding{SeverityError, "node", n.Name, "node is not ready"})
+		}
+		if n.Logs == nil {
+			continue
+		}
+		for _, f := range NodeFindings {
+			stat := n.Logs.Findings[f]
+			if stat == nil || f == FindingReboot || f == FindingK3sRestart {
+				continue
+			}
+			severity := SeverityWarning
+			if severeFindings[f] {
+				severity = SeverityError
+			}
+			result = append(result, Finding{severity, "node", n.Name, fmt.Sprintf("%s x%d: %s", f, stat.Count, stat.Example)})
+		}
+	}
+	for _, vm := range r.VMs {
+		severity := SeverityWarning
+		if failedStatuses[vm.Status] {
+			severity = SeverityError
+		}
+		for _, issue := range vm.Issues {
+			result = append(result, Finding{severity, "vm", vm.Namespace + "/" + vm.Name, issue})
+		}
+	}
+	for _, v := range r.Longhorn.Volumes {
+		severity := SeverityWarning
+		if v.Robustness == "faulted" {
+			severity = SeverityError
+		}
+		for _, issue := range v.Issues {
+			result = append(result, Finding{severity, "longhorn", "volume " + v.Name, issue})
+		}
+	}
+	for _, n := range r.Longhorn.Nodes {
+		for _, issue := range n.Issues {
+			result = append(result, Finding{SeverityWarning, "longhorn", "node " + n.Name, issue})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Severity == SeverityError && result[j].Severity != SeverityError
+	})
+	return result
+}
+
+// Render writes the report as a single HTML page without external assets.
+func (r *HTMLReport) Render(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// NodeFindings lets the template range over the node log findings.
+func (r *HTMLReport) NodeFindings() []NodeFinding {
+	return NodeFindings
+}
+
+// ErrorChart charts the error log lines over time.
+func (r *HTMLReport) ErrorChart() template.HTML {
+	return timeChart(r.LogErrors.PerMinute, "#d73a49")
+}
+
+// EventChart charts the warning events over time.
+func (r *HTMLReport) EventChart() template.HTML {
+	return timeChart(r.WarningEvents, "#e36209")
+}
+
+// ErrorSourceChart charts the logs with the most error lines.
+func (r *HTMLReport) ErrorSourceChart() template.HTML {
+	var bars []bar
+	for _, s := range r.LogErrors.Sources {
+		if len(bars) == topSources {
+			break
+		}
+		bars = append(bars, bar{Label: strings.TrimSuffix(s.Name, ".log"), Value: s.Count})
+	}
+	return barChart(bars, "#d73a49")
+}
+
+// ReasonChart charts the most frequent warning event reasons.
+func (r *HTMLReport) ReasonChart() template.HTML {
+	var bars []bar
+	for reason, count := range r.WarningReasons {
+		bars = append(bars, bar{Label: reason, Value: count})
+	}
+	sort.Slice(bars, func(i, j int) bool {
+		if bars[i].Value != bars[j].Value {
+			return bars[i].Value > bars[j].Value
+		}
+		return bars[i].Label < bars[j].Label
+	})
+	if len(bars) > topSources {
+		bars = bars[:topSources]
+	}
+	return barChart(bars, "#e36209")
+}
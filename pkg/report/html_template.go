@@ -0,0 +1,116 @@
+package report
+
+import (
+	"html/template"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+// The report is a single page with inline styles and charts, so it can be
+// attached to a ticket and opened offline.
+const reportHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #24292e; }
+header { background: #24292e; color: #fff; padding: 12px 20px; }
+header h1 { font-size: 20px; margin: 0 0 4px 0; }
+header .meta { color: #d1d5da; font-size: 13px; }
+main { padding: 8px 20px 24px 20px; max-width: 1200px; }
+h2 { border-bottom: 1px solid #eaecef; padding-bottom: 4px; margin-top: 28px; }
+a { color: #0366d6; }
+.issue { background: #f6f8fa; padding: 8px 12px; margin-top: 12px; }
+.issue .description { white-space: pre-wrap; margin-top: 4px; }
+.cards { display: flex; flex-wrap: wrap; }
+.card { border: 1px solid #e1e4e8; border-radius: 4px; padding: 8px 14px; margin: 0 12px 12px 0; min-width: 120px; }
+.card .value { font-size: 22px; font-weight: 600; }
+.card .label { color: #586069; font-size: 12px; }
+.card.bad .value { color: #d73a49; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { text-align: left; padding: 4px 14px 4px 0; border-bottom: 1px solid #eaecef; vertical-align: top; }
+td.num { text-align: right; }
+td.zero { color: #959da5; }
+td.msg { font-family: SFMono-Regular, Consolas, Menlo, monospace; font-size: 12px; word-break: break-all; }
+.error { color: #d73a49; font-weight: 600; }
+.warning { color: #b08800; font-weight: 600; }
+.ok { color: #28a745; }
+.empty, .legend { color: #586069; font-size: 13px; }
+svg.chart { font-size: 11px; fill: #24292e; display: block; margin-top: 8px; }
+svg.chart .axis { stroke: #959da5; }
+.charts { display: flex; flex-wrap: wrap; }
+.charts > div { margin-right: 32px; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<div class="meta">{{.Bundle}}{{if not .CollectedAt.IsZero}} &middot; collected {{formatTime .CollectedAt}}{{end}} &middot; report generated {{formatTime .GeneratedAt}}</div>
+</header>
+<main>
+{{if or .IssueURL .Description}}<div class="issue">
+{{if .IssueURL}}<div>Issue: <a href="{{.IssueURL}}">{{.IssueURL}}</a></div>{{end}}
+{{if .Description}}<div class="description">{{.Description}}</div>{{end}}
+</div>{{end}}
+
+<h2>Cluster overview</h2>
+{{with .Overview}}<div class="cards">
+<div class="card"><div class="value">{{or .HarvesterVersion "-"}}</div><div class="label">Harvester version</div></div>
+<div class="card"><div class="value">{{or .KubernetesVersion "-"}}</div><div class="label">Kubernetes version</div></div>
+<div class="card{{if lt .ReadyNodes .Nodes}} bad{{end}}"><div class="value">{{.ReadyNodes}}/{{.Nodes}}</div><div class="label">nodes ready</div></div>
+<div class="card"><div class="value">{{.RunningVMs}}/{{.VMs}}</div><div class="label">VMs running</div></div>
+<div class="card{{if lt .RunningPods .Pods}} bad{{end}}"><div class="value">{{.RunningPods}}/{{.Pods}}</div><div class="label">pods running or completed</div></div>
+<div class="card{{if lt .HealthyVolumes .Volumes}} bad{{end}}"><div class="value">{{.HealthyVolumes}}/{{.Volumes}}</div><div class="label">volumes healthy</div></div>
+<div class="card"><div class="value">{{.WarningEvents}}</div><div class="label">warning events</div></div>
+<div class="card"><div class="value">{{.LogErrors}}</div><div class="label">error log lines</div></div>
+</div>{{end}}
+
+<h2>Findings</h2>
+{{if .Findings}}<table>
+<tr><th>Severity</th><th>Area</th><th>Object</th><th>Finding</th></tr>
+{{range .Findings}}<tr><td class="{{.Severity}}">{{.Severity}}</td><td>{{.Area}}</td><td>{{.Object}}</td><td class="msg">{{.Message}}</td></tr>
+{{end}}</table>
+{{else}}<p class="ok">No problems found.</p>{{end}}
+
+<h2>Error frequency</h2>
+<div class="charts">
+<div><h3>Error log lines</h3>{{.ErrorChart}}</div>
+<div><h3>Warning events</h3>{{.EventChart}}</div>
+<div><h3>Logs with the most errors</h3>{{.ErrorSourceChart}}</div>
+<div><h3>Most frequent warning reasons</h3>{{.ReasonChart}}</div>
+</div>
+
+<h2>Nodes</h2>
+{{if .Nodes}}<table>
+<tr><th>Node</th><th>Ready</th><th>Roles</th><th>Version</th>{{range $.NodeFindings}}<th>{{.}}</th>{{end}}</tr>
+{{range $n := .Nodes}}<tr><td>{{$n.Name}}</td><td class="{{if eq $n.Ready "True"}}ok{{else}}error{{end}}">{{or $n.Ready "-"}}</td><td>{{or $n.Roles "-"}}</td><td>{{or $n.Version "-"}}</td>
+{{range $.NodeFindings}}{{$c := $n.Count .}}<td class="num{{if not $c}} zero{{end}}">{{$c}}</td>{{end}}</tr>
+{{end}}</table>
+{{else}}<p class="empty">No nodes in the bundle.</p>{{end}}
+
+<h2>Virtual machines</h2>
+{{if .VMs}}<table>
+<tr><th>Namespace</th><th>Name</th><th>Status</th><th>Node</th><th>Volumes</th><th>Issues</th></tr>
+{{range .VMs}}<tr><td>{{.Namespace}}</td><td>{{.Name}}</td><td>{{or .Status "-"}}</td><td>{{or .Node "-"}}</td>
+<td>{{range $i, $v := .Volumes}}{{if $i}}<br>{{end}}{{$v.PVC}} {{or $v.Robustness "-"}}{{end}}</td>
+<td>{{range $i, $issue := .Issues}}{{if $i}}<br>{{end}}<span class="warning">{{$issue}}</span>{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p class="empty">No VMs in the bundle.</p>{{end}}
+
+<h2>Longhorn volumes</h2>
+{{if .Longhorn.Volumes}}<table>
+<tr><th>Volume</th><th>State</th><th>Robustness</th><th>Size</th><th>Replicas</th><th>Node</th><th>PVC</th><th>VM</th></tr>
+{{range .Longhorn.Volumes}}<tr><td>{{.Name}}</td><td>{{or .State "-"}}</td><td class="{{if eq .Robustness "healthy"}}ok{{else if eq .Robustness "faulted"}}error{{else}}warning{{end}}">{{or .Robustness "-"}}</td>
+<td>{{formatSize .Size}}</td><td>{{.HealthyReplicas}}/{{.DesiredReplicas}}</td><td>{{or .AttachedNode "-"}}</td><td>{{or .PVC "-"}}</td><td>{{or .VM "-"}}</td></tr>
+{{end}}</table>
+{{else}}<p class="empty">No Longhorn volumes in the bundle.</p>{{end}}
+</main>
+</body>
+</html>`
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"formatTime": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05 UTC") },
+	"formatSize": utils.FormatSize,
+}).Parse(reportHTML))
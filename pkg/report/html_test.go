@@ -0,0 +1,180 @@
+package report
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+)
+
+const htmlSettings = `apiVersion: harvesterhci.io/v1beta1
+kind: SettingList
+items:
+- metadata:
+    name: server-version
+  value: v1.0.0
+`
+
+const htmlSupportBundles = `apiVersion: harvesterhci.io/v1beta1
+kind: SupportBundleList
+items:
+- metadata:
+    name: bundle-x7k2q
+    namespace: harvester-system
+  spec:
+    issueURL: https://github.com/harvester/harvester/issues/1234
+    description: VM <vm1> doesn't start
+`
+
+const htmlEvents = `apiVersion: v1
+kind: EventList
+items:
+- metadata:
+    name: vm1.1
+    namespace: default
+  type: Warning
+  reason: FailedScheduling
+  count: 3
+  lastTimestamp: "2021-06-01T10:00:00Z"
+  involvedObject:
+    kind: Pod
+    name: virt-launcher-vm1-abcde
+- metadata:
+    name: vm1.2
+    namespace: default
+  type: Normal
+  reason: Scheduled
+  lastTimestamp: "2021-06-01T10:01:00Z"
+  involvedObject:
+    kind: Pod
+    name: virt-launcher-vm1-abcde
+`
+
+const htmlManagerLog = `time="2021-06-01T10:00:00Z" level=error msg="failed to sync vm1"
+time="2021-06-01T10:00:30Z" level=info msg="synced vm2"
+time="2021-06-01T10:01:00Z" level=error msg="failed to sync vm1"
+`
+
+const htmlControllerLog = `E0601 10:02:00.000000       1 controller.go:42] sync failed
+I0601 10:02:01.000000       1 controller.go:42] synced
+panic: runtime error: invalid memory address or nil pointer dereference
+`
+
+func TestLogErrors(t *testing.T) {
+	bundle := writeBundle(t, map[string]string{
+		"logs/harvester-system/harvester-6d8f9-x7k2q/apiserver.log":     htmlManagerLog,
+		"logs/kube-system/kube-controller-manager-node1/controller.log": htmlControllerLog,
+		// Node logs are left to the nodes report.
+		"nodes/node1/logs/messages": "Jun  1 10:00:00 node1 k3s[1]: level=error msg=failed\n",
+	})
+	report, err := LogErrors(bundle, time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 4 || len(report.Sources) != 2 {
+		t.Fatalf("got %d errors in %+v, want 4 in 2 logs", report.Total, report.Sources)
+	}
+	// Ties are sorted by name.
+	first, second := report.Sources[0], report.Sources[1]
+	if first.Name != "harvester-system/harvester-6d8f9-x7k2q/apiserver.log" || first.Count != 2 ||
+		!first.Last.Equal(time.Date(2021, 6, 1, 10, 1, 0, 0, time.UTC)) || !strings.Contains(first.Example, "10:01:00") {
+		t.Errorf("got source %+v", first)
+	}
+	if second.Name != "kube-system/kube-controller-manager-node1/controller.log" || second.Count != 2 ||
+		!second.Last.Equal(time.Date(2021, 6, 1, 10, 2, 0, 0, time.UTC)) || !strings.HasPrefix(second.Example, "panic:") {
+		t.Errorf("got source %+v", second)
+	}
+	want := map[time.Time]int{
+		time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC): 1,
+		time.Date(2021, 6, 1, 10, 1, 0, 0, time.UTC): 1,
+		time.Date(2021, 6, 1, 10, 2, 0, 0, time.UTC): 1,
+	}
+	if len(report.PerMinute) != len(want) {
+		t.Errorf("got per minute %v, want %v", report.PerMinute, want)
+	}
+	for minute, n := range want {
+		if report.PerMinute[minute] != n {
+			t.Errorf("got %d errors at %s, want %d", report.PerMinute[minute], minute, n)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	bundle := writeBundle(t, map[string]string{
+		"yamls/cluster/v1/nodes.yaml":                                                   highlightsNodes,
+		"yamls/cluster/harvesterhci.io/v1beta1/settings.yaml":                           htmlSettings,
+		"yamls/namespaced/harvester-system/harvesterhci.io/v1beta1/supportbundles.yaml": htmlSupportBundles,
+		"yamls/namespaced/default/kubevirt.io/v1/virtualmachines.yaml":                  highlightsVMs,
+		"yamls/namespaced/default/v1/events.yaml":                                       htmlEvents,
+		"logs/harvester-system/harvester-6d8f9-x7k2q/apiserver.log":                     htmlManagerLog,
+		"nodes/node2/logs/messages":                                                     "Jun  1 10:00:00 node2 kernel: EXT4-fs error (device sda1)\n",
+	})
+	idx, err := resources.Load(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := HTML(idx, bundle, HTMLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.IssueURL != "https://github.com/harvester/harvester/issues/1234" || r.Description != "VM <vm1> doesn't start" {
+		t.Errorf("got issue %q, %q", r.IssueURL, r.Description)
+	}
+	want := Overview{
+		HarvesterVersion: "v1.0.0",
+		Nodes:            2,
+		ReadyNodes:       1,
+		VMs:              2,
+		RunningVMs:       1,
+		WarningEvents:    3,
+		LogErrors:        2,
+	}
+	if r.Overview != want {
+		t.Errorf("got overview %+v, want %+v", r.Overview, want)
+	}
+	if r.WarningReasons["FailedScheduling"] != 3 || len(r.WarningReasons) != 1 {
+		t.Errorf("got warning reasons %v", r.WarningReasons)
+	}
+	var got []string
+	for _, f := range r.Findings {
+		got = append(got, f.Severity+": "+f.Area+" "+f.Object+": "+f.Message)
+	}
+	wantFindings := []string{
+		"error: node node1: node is not ready",
+		"error: node node2: io-error x1: Jun  1 10:00:00 node2 kernel: EXT4-fs error (device sda1)",
+		"error: vm default/vm2: VM status is CrashLoopBackOff",
+		"warning: vm default/vm1: VM is Starting but has no instance",
+	}
+	if strings.Join(got, "\n") != strings.Join(wantFindings, "\n") {
+		t.Errorf("got findings\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(wantFindings, "\n"))
+	}
+
+	r, err = HTML(idx, bundle, HTMLOptions{Title: "Escalation", Description: "overridden"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		"<h1>Escalation</h1>",
+		`<a href="https://github.com/harvester/harvester/issues/1234">`,
+		"overridden",
+		"VM status is CrashLoopBackOff",
+		`class="chart">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+	// The page is read offline, attached to tickets.
+	if external := regexp.MustCompile(`<(?:script|link|img)\b|src=|url\(`).FindString(page); external != "" {
+		t.Errorf("page loads an external asset: %s", external)
+	}
+}
@@ -0,0 +1,91 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+const (
+	// maxLineSize bounds the length of log lines. Scanning a file stops at a
+	// longer line.
+	maxLineSize = 1024 * 1024
+	// maxMessageSize bounds the length of log lines quoted in reports.
+	maxMessageSize = 300
+)
+
+var (
+	// time="2021-06-01T10:00:00Z" as written by logrus
+	logrusTime = regexp.MustCompile(`time="([^"]+)"`)
+	// a RFC 3339 timestamp at the start of a line, e.g., from containerd or
+	// kubectl logs --timestamps
+	rfc3339Prefix = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)`)
+	// "Oct 18 10:00:00" as written by syslog and journalctl, without a year
+	syslogPrefix = regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})`)
+	// "[Sat Oct 18 10:00:00 2021]" as written by dmesg -T
+	dmesgTime = regexp.MustCompile(`^\[([A-Z][a-z]{2} [A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} \d{4})\]`)
+	// "E1018 10:00:00.000000" as written by klog, without a year
+	klogPrefix = regexp.MustCompile(`^[IWEF](\d{4} \d{2}:\d{2}:\d{2})`)
+)
+
+// ParseTimestamp extracts the time a log line was written, if it has one.
+// Syslog and klog timestamps have no year, the year of ref is assumed unless
+// that puts the line after ref, e.g., a December line in a bundle collected in
+// January.
+func ParseTimestamp(line string, ref time.Time) (time.Time, bool) {
+	if m := rfc3339Prefix.FindStringSubmatch(line); m != nil {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05-0700", "2006-01-02 15:04:05Z07:00", "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, m[1]); err == nil {
+				return t, true
+			}
+		}
+	}
+	if m := logrusTime.FindStringSubmatch(line); m != nil {
+		if t, err := time.Parse(time.RFC3339Nano, m[1]); err == nil {
+			return t, true
+		}
+	}
+	if m := dmesgTime.FindStringSubmatch(line); m != nil {
+		if t, err := time.Parse("Mon Jan _2 15:04:05 2006", m[1]); err == nil {
+			return t, true
+		}
+	}
+	if m := syslogPrefix.FindStringSubmatch(line); m != nil {
+		return withYear("Jan _2 15:04:05", m[1], ref)
+	}
+	if m := klogPrefix.FindStringSubmatch(line); m != nil {
+		return withYear("0102 15:04:05", m[1], ref)
+	}
+	return time.Time{}, false
+}
+
+// withYear parses a timestamp without a year, see ParseTimestamp.
+func withYear(layout, value string, ref time.Time) (time.Time, bool) {
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+	// Going back a year at a time also finds the leap year of a Feb 29
+	// line, which doesn't parse in other years.
+	for year := ref.Year(); year > ref.Year()-4; year-- {
+		t, err := time.Parse(layout+" 2006", fmt.Sprintf("%s %d", value, year))
+		if err == nil && !t.After(ref.Add(24*time.Hour)) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// scanLines calls fn for every line of r.
+func scanLines(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return err
+	}
+	return nil
+}
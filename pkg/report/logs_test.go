@@ -0,0 +1,48 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	ref := time.Date(2021, 6, 2, 8, 0, 0, 0, time.UTC)
+	newYear := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		line string
+		ref  time.Time
+		want time.Time
+		ok   bool
+	}{
+		{"rfc3339", "2021-06-01T10:00:00.123456Z stderr F starting", ref, time.Date(2021, 6, 1, 10, 0, 0, 123456000, time.UTC), true},
+		{"rfc3339 offset", "2021-06-01T12:00:00+02:00 started", ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"offset without colon", "2021-06-01T12:00:00+0200 started", ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"space separated", "2021-06-01 10:00:00Z started", ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"without zone", "2021-06-01 10:00:00 started", ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"logrus", `level=error time="2021-06-01T10:00:00Z" msg="rebuild failed"`, ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"dmesg -T", "[Tue Jun  1 10:00:00 2021] Out of memory: Killed process 1234", ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"syslog", "Jun  1 10:00:00 node1 kernel: EXT4-fs error", ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		{"syslog two digit day", "May 31 23:59:59 node1 k3s[123]: starting", ref, time.Date(2021, 5, 31, 23, 59, 59, 0, time.UTC), true},
+		{"klog", "E0601 10:00:00.123456    1 controller.go:42] sync failed", ref, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), true},
+		// Lines without a year from December belong to the previous year in
+		// a bundle collected in January.
+		{"syslog year rollover", "Dec 31 23:00:00 node1 kernel: link is down", newYear, time.Date(2021, 12, 31, 23, 0, 0, 0, time.UTC), true},
+		{"klog year rollover", "I1231 23:00:00.000000    1 main.go:1] started", newYear, time.Date(2021, 12, 31, 23, 0, 0, 0, time.UTC), true},
+		// Clocks may be a little ahead of the collection time.
+		{"slightly after ref", "Jan  1 20:00:00 node1 kernel: link is down", newYear, time.Date(2022, 1, 1, 20, 0, 0, 0, time.UTC), true},
+		{"leap day", "Feb 29 10:00:00 node1 kernel: link is down", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 2, 29, 10, 0, 0, 0, time.UTC), true},
+		{"leap day in leap year", "Feb 29 10:00:00 node1 kernel: link is down", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 10, 0, 0, 0, time.UTC), true},
+		{"no timestamp", "Out of memory: Killed process 1234", ref, time.Time{}, false},
+		{"dmesg uptime", "[  123.456789] Out of memory: Killed process 1234", ref, time.Time{}, false},
+		{"invalid date", "Jun 31 10:00:00 node1 kernel: oops", ref, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTimestamp(tt.line, tt.ref)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("got %s, %t, want %s, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
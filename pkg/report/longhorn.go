@@ -0,0 +1,417 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	kindLonghornReplica     = schema.GroupKind{Group: "longhorn.io", Kind: "Replica"}
+	kindLonghornEngine      = schema.GroupKind{Group: "longhorn.io", Kind: "Engine"}
+	kindLonghornNode        = schema.GroupKind{Group: "longhorn.io", Kind: "Node"}
+	kindLonghornEngineImage = schema.GroupKind{Group: "longhorn.io", Kind: "EngineImage"}
+	kindLonghornSetting     = schema.GroupKind{Group: "longhorn.io", Kind: "Setting"}
+)
+
+// Longhorn defaults of the settings the analysis depends on.
+const (
+	defaultMinimalAvailablePercentage = 25
+	defaultOverProvisioningPercentage = 200
+)
+
+// LonghornReport is the health of the Longhorn volumes, replicas and disks in
+// a bundle.
+type LonghornReport struct {
+	DefaultEngineImage string            `json:"defaultEngineImage,omitempty"`
+	Volumes            []*LonghornVolume `json:"volumes"`
+	Nodes              []*LonghornNode   `json:"nodes"`
+}
+
+// LonghornVolume is the health of a Longhorn volume.
+type LonghornVolume struct {
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	Robustness string `json:"robustness"`
+	Size       int64  `json:"size"`
+	// AttachedNode is the node the volume is attached to.
+	AttachedNode    string `json:"attachedNode,omitempty"`
+	EngineImage     string `json:"engineImage,omitempty"`
+	DesiredReplicas int64  `json:"desiredReplicas"`
+	HealthyReplicas int    `json:"healthyReplicas"`
+	// PVC is the namespace/name of the PVC of the volume, if any.
+	PVC string `json:"pvc,omitempty"`
+	// VM is the namespace/name of the VM using the PVC, if any.
+	VM         string             `json:"vm,omitempty"`
+	Replicas   []*LonghornReplica `json:"replicas"`
+	Rebuilds   []LonghornRebuild  `json:"rebuilds,omitempty"`
+	LogRebuild LonghornLogSummary `json:"logRebuild"`
+	Issues     []string           `json:"issues,omitempty"`
+}
+
+// LonghornReplica is a replica of a volume.
+type LonghornReplica struct {
+	Name  string `json:"name"`
+	Node  string `json:"node"`
+	Disk  string `json:"disk,omitempty"`
+	State string `json:"state"`
+	// Mode is the replica mode in the engine: RW, WO while rebuilding or ERR.
+	Mode        string `json:"mode,omitempty"`
+	FailedAt    string `json:"failedAt,omitempty"`
+	EngineImage string `json:"engineImage,omitempty"`
+}
+
+// Healthy reports whether the replica serves reads and writes.
+func (r *LonghornReplica) Healthy() bool {
+	return r.FailedAt == "" && r.State == "running" && (r.Mode == "" || r.Mode == "RW")
+}
+
+// LonghornRebuild is a rebuild reported by the engine of a volume.
+type LonghornRebuild struct {
+	Replica  string `json:"replica"`
+	Progress int64  `json:"progress"`
+	State    string `json:"state,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// LonghornLogSummary summarizes the log lines about rebuilding a volume.
+type LonghornLogSummary struct {
+	Lines    int       `json:"lines"`
+	Failures int       `json:"failures"`
+	First    time.Time `json:"first,omitempty"`
+	Last     time.Time `json:"last,omitempty"`
+	// LastMessage is the last failure line, or the last line if nothing
+	// failed.
+	LastMessage string `json:"lastMessage,omitempty"`
+}
+
+// LonghornNode is the health of a Longhorn node and its disks.
+type LonghornNode struct {
+	Name        string          `json:"name"`
+	Ready       string          `json:"ready"`
+	Schedulable string          `json:"schedulable"`
+	Disks       []*LonghornDisk `json:"disks"`
+	Issues      []string        `json:"issues,omitempty"`
+}
+
+// LonghornDisk is the usage of a disk of a Longhorn node.
+type LonghornDisk struct {
+	ID          string `json:"id"`
+	Path        string `json:"path"`
+	Available   int64  `json:"available"`
+	Maximum     int64  `json:"maximum"`
+	Reserved    int64  `json:"reserved"`
+	Scheduled   int64  `json:"scheduled"`
+	Schedulable string `json:"schedulable"`
+	Replicas    int    `json:"replicas"`
+}
+
+// Longhorn analyzes the Longhorn resources in idx and the Longhorn logs in
+// the bundle.
+func Longhorn(idx *resources.Index, bundle string) (*LonghornReport, error) {
+	settings := longhornSettings(idx)
+	report := &LonghornReport{DefaultEngineImage: settings["default-engine-image"]}
+
+	pvcVMs := map[string]string{}
+	for _, vm := range idx.Objects(kindVM, "") {
+		for _, v := range vmVolumes(vm) {
+			pvcVMs[vm.GetNamespace()+"/"+v.PVC] = vm.GetNamespace() + "/" + vm.GetName()
+		}
+	}
+
+	engines := map[string]*unstructured.Unstructured{}
+	for _, e := range idx.Objects(kindLonghornEngine, longhornNamespace) {
+		// A volume has one engine, except during a migration.
+		volume := str(e, "spec", "volumeName")
+		if _, ok := engines[volume]; !ok || str(e, "status", "currentState") == "running" {
+			engines[volume] = e
+		}
+	}
+	replicas := map[string][]*LonghornReplica{}
+	diskReplicas := map[string]int{}
+	for _, r := range idx.Objects(kindLonghornReplica, longhornNamespace) {
+		replica := &LonghornReplica{
+			Name:        r.GetName(),
+			Node:        str(r, "spec", "nodeID"),
+			Disk:        str(r, "spec", "diskID"),
+			State:       str(r, "status", "currentState"),
+			FailedAt:    str(r, "spec", "failedAt"),
+			EngineImage: firstNonEmpty(str(r, "status", "currentImage"), str(r, "spec", "engineImage"), str(r, "spec", "image")),
+		}
+		volume := str(r, "spec", "volumeName")
+		replicas[volume] = append(replicas[volume], replica)
+		diskReplicas[replica.Node+"/"+replica.Disk]++
+	}
+
+	logs, err := longhornLogs(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range idx.Objects(kindLonghornVolume, longhornNamespace) {
+		volume := &LonghornVolume{
+			Name:         v.GetName(),
+			State:        str(v, "status", "state"),
+			Robustness:   str(v, "status", "robustness"),
+			AttachedNode: str(v, "status", "currentNodeID"),
+			EngineImage:  firstNonEmpty(str(v, "status", "currentImage"), str(v, "spec", "engineImage"), str(v, "spec", "image")),
+			Replicas:     replicas[v.GetName()],
+			LogRebuild:   logs[v.GetName()],
+		}
+		volume.Size, _ = strconv.ParseInt(str(v, "spec", "size"), 10, 64)
+		volume.DesiredReplicas, _, _ = unstructured.NestedInt64(v.Object, "spec", "numberOfReplicas")
+		if ns, name := str(v, "status", "kubernetesStatus", "namespace"), str(v, "status", "kubernetesStatus", "pvcName"); name != "" {
+			volume.PVC = ns + "/" + name
+			volume.VM = pvcVMs[volume.PVC]
+		}
+
+		if e := engines[v.GetName()]; e != nil {
+			modes, _, _ := unstructured.NestedStringMap(e.Object, "status", "replicaModeMap")
+			for _, r := range volume.Replicas {
+				r.Mode = modes[r.Name]
+			}
+			volume.Rebuilds = engineRebuilds(e)
+			if img := firstNonEmpty(str(e, "status", "currentImage"), str(e, "spec", "engineImage"), str(e, "spec", "image")); img != "" && volume.EngineImage != "" && img != volume.EngineImage {
+				volume.Issues = append(volume.Issues, fmt.Sprintf("engine runs image %s but the volume uses %s", img, volume.EngineImage))
+			}
+		}
+		sort.Slice(volume.Replicas, func(i, j int) bool { return volume.Replicas[i].Name < volume.Replicas[j].Name })
+		volume.Issues = append(volume.Issues, volumeIssues(volume, report.DefaultEngineImage)...)
+		report.Volumes = append(report.Volumes, volume)
+	}
+	sort.Slice(report.Volumes, func(i, j int) bool { return report.Volumes[i].Name < report.Volumes[j].Name })
+
+	minimalAvailable := settingInt(settings, "storage-minimal-available-percentage", defaultMinimalAvailablePercentage)
+	overProvisioning := settingInt(settings, "storage-over-provisioning-percentage", defaultOverProvisioningPercentage)
+	for _, n := range idx.Objects(kindLonghornNode, longhornNamespace) {
+		report.Nodes = append(report.Nodes, longhornNode(n, diskReplicas, minimalAvailable, overProvisioning))
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Name < report.Nodes[j].Name })
+	return report, nil
+}
+
+func volumeIssues(v *LonghornVolume, defaultImage string) []string {
+	var issues []string
+	switch v.Robustness {
+	case "degraded", "faulted":
+		issues = append(issues, "volume is "+v.Robustness)
+	case "unknown":
+		if v.State == "attached" {
+			issues = append(issues, "volume robustness is unknown while attached")
+		}
+	}
+
+	nodes := map[string]int{}
+	for _, r := range v.Replicas {
+		if r.Healthy() {
+			v.HealthyReplicas++
+			nodes[r.Node]++
+		}
+		switch {
+		case r.FailedAt != "":
+			issues = append(issues, fmt.Sprintf("replica %s on %s failed at %s", r.Name, r.Node, r.FailedAt))
+		case r.Mode == "ERR" || r.State == "error":
+			issues = append(issues, fmt.Sprintf("replica %s on %s is in error", r.Name, r.Node))
+		}
+		if r.EngineImage != "" && v.EngineImage != "" && r.EngineImage != v.EngineImage {
+			issues = append(issues, fmt.Sprintf("replica %s runs image %s but the volume uses %s", r.Name, r.EngineImage, v.EngineImage))
+		}
+	}
+	if v.State == "attached" && v.DesiredReplicas > 0 && int64(v.HealthyReplicas) < v.DesiredReplicas {
+		issues = append(issues, fmt.Sprintf("%d of %d replicas are healthy", v.HealthyReplicas, v.DesiredReplicas))
+	}
+	for node, n := range nodes {
+		if n > 1 {
+			issues = append(issues, fmt.Sprintf("%d healthy replicas are on node %s", n, node))
+		}
+	}
+	for _, r := range v.Rebuilds {
+		if r.Error != "" {
+			issues = append(issues, fmt.Sprintf("rebuilding %s failed: %s", r.Replica, r.Error))
+		}
+	}
+	if defaultImage != "" && v.EngineImage != "" && v.EngineImage != defaultImage {
+		issues = append(issues, fmt.Sprintf("volume uses engine image %s, not the default %s", v.EngineImage, defaultImage))
+	}
+	if v.LogRebuild.Failures > 0 {
+		issues = append(issues, fmt.Sprintf("%d rebuild failure(s) in the logs", v.LogRebuild.Failures))
+	}
+	return issues
+}
+
+// engineRebuilds returns the rebuilds in progress or failed in an engine.
+func engineRebuilds(e *unstructured.Unstructured) []LonghornRebuild {
+	statuses, _, _ := unstructured.NestedMap(e.Object, "status", "rebuildStatus")
+	var rebuilds []LonghornRebuild
+	for addr, s := range statuses {
+		m, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rebuilding, _ := m["isRebuilding"].(bool)
+		errMsg, _ := m["error"].(string)
+		if !rebuilding && errMsg == "" {
+			continue
+		}
+		r := LonghornRebuild{Replica: addr, Error: errMsg}
+		r.Progress, _, _ = unstructured.NestedInt64(m, "progress")
+		r.State, _ = m["state"].(string)
+		rebuilds = append(rebuilds, r)
+	}
+	sort.Slice(rebuilds, func(i, j int) bool { return rebuilds[i].Replica < rebuilds[j].Replica })
+	return rebuilds
+}
+
+func longhornNode(n *unstructured.Unstructured, diskReplicas map[string]int, minimalAvailable, overProvisioning int64) *LonghornNode {
+	node := &LonghornNode{
+		Name:        n.GetName(),
+		Ready:       conditionStatus(n, "Ready"),
+		Schedulable: conditionStatus(n, "Schedulable"),
+	}
+	if node.Ready != "" && node.Ready != "True" {
+		node.Issues = append(node.Issues, "node is not ready")
+	}
+
+	specs, _, _ := unstructured.NestedMap(n.Object, "spec", "disks")
+	statuses, _, _ := unstructured.NestedMap(n.Object, "status", "diskStatus")
+	for id := range specs {
+		disk := &LonghornDisk{ID: id}
+		spec, _ := specs[id].(map[string]interface{})
+		disk.Path, _ = spec["path"].(string)
+		disk.Reserved, _, _ = unstructured.NestedInt64(spec, "storageReserved")
+		if status, ok := statuses[id].(map[string]interface{}); ok {
+			disk.Available, _, _ = unstructured.NestedInt64(status, "storageAvailable")
+			disk.Maximum, _, _ = unstructured.NestedInt64(status, "storageMaximum")
+			disk.Scheduled, _, _ = unstructured.NestedInt64(status, "storageScheduled")
+			disk.Schedulable = conditionStatus(&unstructured.Unstructured{Object: map[string]interface{}{"status": status}}, "Schedulable")
+			// Replicas refer to disks by UUID, the disks are keyed by name.
+			if uuid, _ := status["diskUUID"].(string); uuid != "" {
+				disk.Replicas = diskReplicas[node.Name+"/"+uuid]
+			} else {
+				scheduled, _, _ := unstructured.NestedMap(status, "scheduledReplica")
+				disk.Replicas = len(scheduled)
+			}
+		}
+
+		if disk.Schedulable == "False" {
+			node.Issues = append(node.Issues, fmt.Sprintf("disk %s is not schedulable", disk.Path))
+		}
+		if disk.Maximum > 0 {
+			if disk.Available*100 < disk.Maximum*minimalAvailable {
+				node.Issues = append(node.Issues, fmt.Sprintf("disk %s has %d%% available, below the minimal %d%%",
+					disk.Path, disk.Available*100/disk.Maximum, minimalAvailable))
+			}
+			if disk.Scheduled*100 > (disk.Maximum-disk.Reserved)*overProvisioning {
+				node.Issues = append(node.Issues, fmt.Sprintf("disk %s is over-provisioned beyond %d%%", disk.Path, overProvisioning))
+			}
+		}
+		node.Disks = append(node.Disks, disk)
+	}
+	sort.Slice(node.Disks, func(i, j int) bool { return node.Disks[i].Path < node.Disks[j].Path })
+	return node
+}
+
+func longhornSettings(idx *resources.Index) map[string]string {
+	settings := map[string]string{}
+	for _, s := range idx.Objects(kindLonghornSetting, longhornNamespace) {
+		settings[s.GetName()] = str(s, "value")
+	}
+	if settings["default-engine-image"] == "" {
+		for _, ei := range idx.Objects(kindLonghornEngineImage, longhornNamespace) {
+			if d, _, _ := unstructured.NestedBool(ei.Object, "status", "isDefault"); d {
+				settings["default-engine-image"] = str(ei, "spec", "image")
+			}
+		}
+	}
+	return settings
+}
+
+func settingInt(settings map[string]string, name string, def int64) int64 {
+	if v, err := strconv.ParseInt(settings[name], 10, 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var (
+	// Longhorn volumes created for PVCs are named after the PV.
+	pvVolumeName = regexp.MustCompile(`pvc-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	// volume=name or volume "name" in logs of other volumes
+	volumeField = regexp.MustCompile(`[vV]olume[=: "]+([a-z0-9][a-z0-9.-]*[a-z0-9])`)
+	rebuildLine = regexp.MustCompile(`(?i)rebuil`)
+	failureLine = regexp.MustCompile(`(?i)fail|error`)
+)
+
+// isLonghornLog matches the logs of the Longhorn manager and instance manager
+// pods, e.g., logs/longhorn-system/longhorn-manager-x7d2k/longhorn-manager.log.
+func isLonghornLog(name string) bool {
+	return strings.Contains(name, "longhorn-system/") && strings.HasSuffix(name, ".log") &&
+		(strings.Contains(name, "longhorn-manager") || strings.Contains(name, "instance-manager"))
+}
+
+// longhornLogs summarizes the rebuild log lines per volume.
+func longhornLogs(bundle string) (map[string]LonghornLogSummary, error) {
+	summaries := map[string]LonghornLogSummary{}
+	err := walkFiles(bundle, false, isLonghornLog, func(name string, r io.Reader) error {
+		return scanLines(r, func(line string) {
+			if !rebuildLine.MatchString(line) {
+				return
+			}
+			volumes := pvVolumeName.FindAllString(line, -1)
+			for _, m := range volumeField.FindAllStringSubmatch(line, -1) {
+				volumes = append(volumes, m[1])
+			}
+			failed := failureLine.MatchString(line)
+			ts, hasTime := ParseTimestamp(line, time.Time{})
+			seen := map[string]bool{}
+			for _, v := range volumes {
+				if seen[v] {
+					continue
+				}
+				seen[v] = true
+				s := summaries[v]
+				s.Lines++
+				if failed {
+					s.Failures++
+				}
+				if hasTime {
+					if s.First.IsZero() || ts.Before(s.First) {
+						s.First = ts
+					}
+					if ts.After(s.Last) {
+						s.Last = ts
+					}
+				}
+				if failed || s.Failures == 0 {
+					s.LastMessage = truncate(strings.TrimSpace(line), maxMessageSize)
+				}
+				summaries[v] = s
+			}
+		})
+	})
+	return summaries, err
+}
@@ -0,0 +1,239 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+)
+
+const longhornDir = "yamls/namespaced/longhorn-system/longhorn.io/v1beta1/"
+
+const longhornSettingsYAML = `apiVersion: longhorn.io/v1beta1
+kind: SettingList
+items:
+- metadata:
+    name: storage-over-provisioning-percentage
+    namespace: longhorn-system
+  value: "100"
+- metadata:
+    name: default-engine-image
+    namespace: longhorn-system
+  value: longhornio/longhorn-engine:v1.1.2
+`
+
+const longhornVolumesYAML = `apiVersion: longhorn.io/v1beta1
+kind: VolumeList
+items:
+- metadata:
+    name: vol-a
+    namespace: longhorn-system
+  spec:
+    numberOfReplicas: 3
+    size: "10737418240"
+    engineImage: longhornio/longhorn-engine:v1.1.2
+  status:
+    state: attached
+    robustness: degraded
+    currentNodeID: node1
+    kubernetesStatus:
+      namespace: default
+      pvcName: disk-a
+- metadata:
+    name: vol-b
+    namespace: longhorn-system
+  spec:
+    numberOfReplicas: 1
+    engineImage: longhornio/longhorn-engine:v1.1.2
+  status:
+    state: detached
+    robustness: unknown
+`
+
+// lhReplica returns a replica of a volume on a disk, identified by its UUID.
+func lhReplica(name, volume, node, disk, state, failedAt string) string {
+	return "- metadata:\n    name: " + name + "\n    namespace: longhorn-system\n" +
+		"  spec:\n    volumeName: " + volume + "\n    nodeID: " + node + "\n    diskID: " + disk + "\n    failedAt: '" + failedAt + "'\n" +
+		"  status:\n    currentState: " + state + "\n"
+}
+
+var longhornReplicasYAML = "apiVersion: longhorn.io/v1beta1\nkind: ReplicaList\nitems:\n" +
+	lhReplica("vol-a-r-1", "vol-a", "node1", "uuid-1", "running", "") +
+	lhReplica("vol-a-r-2", "vol-a", "node1", "uuid-1", "running", "") +
+	lhReplica("vol-a-r-3", "vol-a", "node2", "uuid-2", "stopped", "2021-06-01T10:05:00Z") +
+	lhReplica("vol-b-r-1", "vol-b", "node2", "uuid-2", "stopped", "")
+
+const longhornEnginesYAML = `apiVersion: longhorn.io/v1beta1
+kind: EngineList
+items:
+- metadata:
+    name: vol-a-e-1
+    namespace: longhorn-system
+  spec:
+    volumeName: vol-a
+  status:
+    currentState: running
+    replicaModeMap:
+      vol-a-r-1: RW
+      vol-a-r-2: RW
+    rebuildStatus:
+      tcp://10.52.1.7:10000:
+        isRebuilding: false
+        error: connection refused
+`
+
+// The disks of node1 and node2 have UUIDs, the replicas of disk-3 of node2
+// are only known from its scheduled replicas.
+const longhornNodesYAML = `apiVersion: longhorn.io/v1beta1
+kind: NodeList
+items:
+- metadata:
+    name: node1
+    namespace: longhorn-system
+  spec:
+    disks:
+      disk-1:
+        path: /var/lib/longhorn
+  status:
+    conditions:
+    - type: Ready
+      status: "True"
+    diskStatus:
+      disk-1:
+        diskUUID: uuid-1
+        storageMaximum: 100
+        storageAvailable: 10
+        storageScheduled: 50
+        conditions:
+        - type: Schedulable
+          status: "True"
+- metadata:
+    name: node2
+    namespace: longhorn-system
+  spec:
+    disks:
+      disk-2:
+        path: /mnt/disk2
+        storageReserved: 20
+      disk-3:
+        path: /mnt/disk3
+  status:
+    conditions:
+    - type: Ready
+      status: "False"
+    diskStatus:
+      disk-2:
+        diskUUID: uuid-2
+        storageMaximum: 100
+        storageAvailable: 80
+        storageScheduled: 100
+        conditions:
+        - type: Schedulable
+          status: "False"
+      disk-3:
+        storageMaximum: 100
+        storageAvailable: 100
+        scheduledReplica:
+          vol-c-r-1: 10
+          vol-d-r-1: 10
+          vol-e-r-1: 10
+        conditions:
+        - type: Schedulable
+          status: "True"
+`
+
+const longhornManagerLog = `time="2021-06-01T10:00:00Z" level=info msg="Rebuilding replica vol-a-r-3" volume=vol-a
+time="2021-06-01T10:05:00Z" level=error msg="Failed to rebuild replica vol-a-r-3: connection refused" volume=vol-a
+time="2021-06-01T10:06:00Z" level=info msg="Detached volume" volume=vol-b
+`
+
+func TestLonghorn(t *testing.T) {
+	bundle := writeBundle(t, map[string]string{
+		longhornDir + "settings.yaml":                                      longhornSettingsYAML,
+		longhornDir + "volumes.yaml":                                       longhornVolumesYAML,
+		longhornDir + "replicas.yaml":                                      longhornReplicasYAML,
+		longhornDir + "engines.yaml":                                       longhornEnginesYAML,
+		longhornDir + "nodes.yaml":                                         longhornNodesYAML,
+		"logs/longhorn-system/longhorn-manager-x7d2k/longhorn-manager.log": longhornManagerLog,
+	})
+	idx, err := resources.Load(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Longhorn(idx, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DefaultEngineImage != "longhornio/longhorn-engine:v1.1.2" {
+		t.Errorf("got default engine image %q", report.DefaultEngineImage)
+	}
+
+	t.Run("volumes", func(t *testing.T) {
+		if len(report.Volumes) != 2 {
+			t.Fatalf("got %d volumes, want 2", len(report.Volumes))
+		}
+		a, b := report.Volumes[0], report.Volumes[1]
+		want := []string{
+			"volume is degraded",
+			"replica vol-a-r-3 on node2 failed at 2021-06-01T10:05:00Z",
+			"2 of 3 replicas are healthy",
+			"2 healthy replicas are on node node1",
+			"rebuilding tcp://10.52.1.7:10000 failed: connection refused",
+			"1 rebuild failure(s) in the logs",
+		}
+		if strings.Join(a.Issues, "\n") != strings.Join(want, "\n") {
+			t.Errorf("got issues\n%s\nwant\n%s", strings.Join(a.Issues, "\n"), strings.Join(want, "\n"))
+		}
+		if a.Size != 10737418240 || a.HealthyReplicas != 2 || a.PVC != "default/disk-a" || len(a.Replicas) != 3 || a.Replicas[0].Mode != "RW" {
+			t.Errorf("got volume %+v", a)
+		}
+		logs := a.LogRebuild
+		if logs.Lines != 2 || logs.Failures != 1 ||
+			!logs.First.Equal(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)) || !logs.Last.Equal(time.Date(2021, 6, 1, 10, 5, 0, 0, time.UTC)) ||
+			!strings.Contains(logs.LastMessage, "Failed to rebuild") {
+			t.Errorf("got log summary %+v", logs)
+		}
+		// A detached volume doesn't need healthy replicas.
+		if b.Name != "vol-b" || len(b.Issues) != 0 || b.LogRebuild.Lines != 0 {
+			t.Errorf("got volume %+v", b)
+		}
+	})
+
+	t.Run("nodes", func(t *testing.T) {
+		if len(report.Nodes) != 2 {
+			t.Fatalf("got %d nodes, want 2", len(report.Nodes))
+		}
+		tests := []struct {
+			node     string
+			replicas map[string]int
+			issues   []string
+		}{
+			{"node1", map[string]int{"/var/lib/longhorn": 2}, []string{
+				"disk /var/lib/longhorn has 10% available, below the minimal 25%",
+			}},
+			{"node2", map[string]int{"/mnt/disk2": 2, "/mnt/disk3": 3}, []string{
+				"node is not ready",
+				"disk /mnt/disk2 is not schedulable",
+				"disk /mnt/disk2 is over-provisioned beyond 100%",
+			}},
+		}
+		for i, tt := range tests {
+			n := report.Nodes[i]
+			if n.Name != tt.node {
+				t.Fatalf("got node %s, want %s", n.Name, tt.node)
+			}
+			if len(n.Disks) != len(tt.replicas) {
+				t.Errorf("%s: got %d disks, want %d", n.Name, len(n.Disks), len(tt.replicas))
+			}
+			for _, d := range n.Disks {
+				if d.Replicas != tt.replicas[d.Path] {
+					t.Errorf("%s: got %d replicas on %s, want %d", n.Name, d.Replicas, d.Path, tt.replicas[d.Path])
+				}
+			}
+			if strings.Join(n.Issues, "\n") != strings.Join(tt.issues, "\n") {
+				t.Errorf("%s: got issues\n%s\nwant\n%s", n.Name, strings.Join(n.Issues, "\n"), strings.Join(tt.issues, "\n"))
+			}
+		}
+	})
+}
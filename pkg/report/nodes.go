@@ -0,0 +1,220 @@
+package report
+
+import (
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeFinding is a kind of problem searched for in node logs.
+type NodeFinding string
+
+const (
+	FindingOOM        NodeFinding = "oom"
+	FindingPanic      NodeFinding = "panic"
+	FindingIOError    NodeFinding = "io-error"
+	FindingLinkFlap   NodeFinding = "link-flap"
+	FindingReadOnly   NodeFinding = "read-only"
+	FindingClockJump  NodeFinding = "clock-jump"
+	FindingReboot     NodeFinding = "reboot"
+	FindingK3sRestart NodeFinding = "k3s-restart"
+)
+
+// NodeFindings lists the findings in report order.
+var NodeFindings = []NodeFinding{
+	FindingOOM, FindingPanic, FindingIOError, FindingLinkFlap,
+	FindingReadOnly, FindingClockJump, FindingReboot, FindingK3sRestart,
+}
+
+var nodePatterns = map[NodeFinding]*regexp.Regexp{
+	FindingOOM:        regexp.MustCompile(`(?i)out of memory: kill|oom-kill:|invoked oom-killer|memory cgroup out of memory`),
+	FindingPanic:      regexp.MustCompile(`(?i)kernel panic|\boops:|kernel bug at|bug: unable to handle|general protection fault`),
+	FindingIOError:    regexp.MustCompile(`(?i)\bi/o error|blk_update_request: .*error|critical medium error|ext4-fs error|xfs .*(?:metadata i/o error|corruption)|nvme.*(?:timeout|resetting controller)|ata\d+.*(?:failed command|hard resetting link)`),
+	FindingLinkFlap:   regexp.MustCompile(`(?i)link is down|nic link is down|carrier lost|link down`),
+	FindingReadOnly:   regexp.MustCompile(`(?i)remounting filesystem read-only|re-?mounted read-only|remount-ro`),
+	FindingClockJump:  regexp.MustCompile(`(?i)time has been changed|system clock wrong|backward time jump|clock (?:jumped|stepped)|step time server|time reset [+-]`),
+	FindingReboot:     regexp.MustCompile(`^-- Reboot --|\bLinux version \d|Booting Linux on physical CPU`),
+	FindingK3sRestart: regexp.MustCompile(`(?i)starting k3s v|started lightweight kubernetes|k3s(?:-agent)?\.service: scheduled restart job|starting rke2 v|rke2-(?:server|agent)\.service: scheduled restart job`),
+}
+
+// NodeReport summarizes the problems found in the logs of a node.
+type NodeReport struct {
+	Name string `json:"name"`
+	// Files is the number of log files read.
+	Files    int                              `json:"files"`
+	Findings map[NodeFinding]*NodeFindingStat `json:"findings"`
+}
+
+// NodeFindingStat counts the occurrences of a finding.
+type NodeFindingStat struct {
+	Count int       `json:"count"`
+	First time.Time `json:"first,omitempty"`
+	Last  time.Time `json:"last,omitempty"`
+	// Example is the last matching line.
+	Example string `json:"example"`
+}
+
+func (s *NodeFindingStat) add(line string, ts time.Time, hasTime bool) {
+	s.Count++
+	s.Example = truncate(strings.TrimSpace(line), maxMessageSize)
+	if hasTime {
+		s.addTime(ts)
+	}
+}
+
+func (s *NodeFindingStat) merge(other *NodeFindingStat) {
+	s.Count += other.Count
+	s.Example = other.Example
+	if !other.First.IsZero() {
+		s.addTime(other.First)
+		s.addTime(other.Last)
+	}
+}
+
+func (s *NodeFindingStat) addTime(ts time.Time) {
+	if s.First.IsZero() || ts.Before(s.First) {
+		s.First = ts
+	}
+	if ts.After(s.Last) {
+		s.Last = ts
+	}
+}
+
+// Problems returns the number of findings other than reboots and k3s
+// restarts, which are often planned, e.g., during upgrades.
+func (r *NodeReport) Problems() int {
+	n := 0
+	for f, stat := range r.Findings {
+		if f != FindingReboot && f != FindingK3sRestart {
+			n += stat.Count
+		}
+	}
+	return n
+}
+
+// nodeLog returns the node a file belongs to, e.g., node1 for
+// nodes/node1.zip!/logs/dmesg.log, or "" if it isn't a node log.
+func nodeLog(name string) string {
+	i := strings.Index("/"+name, "/nodes/")
+	if i < 0 {
+		return ""
+	}
+	rest := name[i+len("nodes/"):]
+	node := rest
+	if j := strings.IndexAny(rest, "/!"); j >= 0 {
+		node = rest[:j]
+	}
+	return strings.TrimSuffix(node, ".zip")
+}
+
+// isTextLog skips compressed and binary journal files.
+func isTextLog(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".gz", ".xz", ".bz2", ".tar", ".journal", ".zst":
+		return false
+	}
+	return true
+}
+
+// isDmesg reports whether name is the dmesg output of a node.
+func isDmesg(name string) bool {
+	base := path.Base(name)
+	return base == "dmesg.log" || base == "dmesg"
+}
+
+// isSyslog reports whether name is a syslog file of a node, which also has
+// the kernel messages, e.g., messages or messages-20210301.
+func isSyslog(name string) bool {
+	base := path.Base(name)
+	for _, prefix := range []string{"messages", "syslog", "kern.log"} {
+		if strings.HasPrefix(base, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Nodes scans the logs collected from every node, e.g., dmesg, messages and
+// console logs, for OOM kills, kernel panics and oopses, disk I/O errors, NIC
+// link flaps, read-only remounts, clock jumps, reboots and k3s restarts.
+// collectedAt is used to complete syslog timestamps without a year.
+func Nodes(bundle string, collectedAt time.Time) ([]*NodeReport, error) {
+	nodes := map[string]*NodeReport{}
+	// The same line is often in several logs, e.g., console and messages, so
+	// timestamped lines are only counted once.
+	seen := map[string]bool{}
+	// dmesg has uptime stamps, which can't be matched against the times in
+	// syslog. Its findings are kept apart and only counted for nodes
+	// without a syslog file, which has the same kernel messages.
+	dmesg := map[string]map[NodeFinding]*NodeFindingStat{}
+	hasSyslog := map[string]bool{}
+
+	match := func(name string) bool {
+		return nodeLog(name) != "" && isTextLog(name)
+	}
+	err := walkFiles(bundle, true, match, func(name string, r io.Reader) error {
+		node := nodeLog(name)
+		report, ok := nodes[node]
+		if !ok {
+			report = &NodeReport{Name: node, Findings: map[NodeFinding]*NodeFindingStat{}}
+			nodes[node] = report
+		}
+		report.Files++
+		findings, source := report.Findings, ""
+		if isDmesg(name) {
+			source = "dmesg"
+			if dmesg[node] == nil {
+				dmesg[node] = map[NodeFinding]*NodeFindingStat{}
+			}
+			findings = dmesg[node]
+		} else if isSyslog(name) {
+			hasSyslog[node] = true
+		}
+		return scanLines(r, func(line string) {
+			for _, finding := range NodeFindings {
+				if !nodePatterns[finding].MatchString(line) {
+					continue
+				}
+				ts, hasTime := ParseTimestamp(line, collectedAt)
+				if hasTime {
+					key := source + "|" + node + "|" + string(finding) + "|" + ts.UTC().Format(time.RFC3339)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+				stat := findings[finding]
+				if stat == nil {
+					stat = &NodeFindingStat{}
+					findings[finding] = stat
+				}
+				stat.add(line, ts, hasTime)
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for node, findings := range dmesg {
+		if hasSyslog[node] {
+			continue
+		}
+		report := nodes[node]
+		for finding, stat := range findings {
+			if report.Findings[finding] == nil {
+				report.Findings[finding] = &NodeFindingStat{}
+			}
+			report.Findings[finding].merge(stat)
+		}
+	}
+
+	var reports []*NodeReport
+	for _, r := range nodes {
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+	return reports, nil
+}
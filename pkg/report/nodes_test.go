@@ -0,0 +1,114 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+)
+
+// zipFiles returns an archive of files, e.g., to nest a node bundle.
+func zipFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestNodes(t *testing.T) {
+	bundle := writeBundle(t, map[string]string{
+		// The OOM kill is in both the console log and messages, with
+		// timestamps in different formats.
+		"nodes/node1/logs/console.log": "2021-06-01T10:00:00Z node1 kernel: Out of memory: Killed process 1234 (qemu-system-x86)\n" +
+			"2021-06-01T10:05:00Z node1 kernel: ixgbe 0000:01:00.0 eth0: NIC Link is Down\n",
+		"nodes/node1/logs/messages": "Jun  1 10:00:00 node1 kernel: Out of memory: Killed process 1234 (qemu-system-x86)\n" +
+			"Jun  1 10:10:00 node1 k3s[1432]: time=\"2021-06-01T10:10:00Z\" level=info msg=\"Starting k3s v1.20.4+k3s1\"\n",
+		// messages has the kernel messages already.
+		"nodes/node1/logs/dmesg.log": "[   12.345678] Out of memory: Killed process 99 (qemu-system-x86)\n",
+		// node2 only has dmesg, in a nested bundle with a compressed log
+		// which isn't read.
+		"nodes/node2.zip": zipFiles(t, map[string]string{
+			"logs/dmesg.log": "[    0.000000] Linux version 5.3.18-24.37-default (geeko@buildhost)\n" +
+				"[  100.000000] EXT4-fs error (device sda1): ext4_find_entry:1455: inode #2: comm ls: reading directory lblock 0\n" +
+				"[  200.000000] blk_update_request: I/O error, dev sda, sector 1234 op 0x0:(READ)\n" +
+				"[  200.000000] blk_update_request: I/O error, dev sda, sector 1234 op 0x0:(READ)\n",
+			"logs/messages.gz": "Jun  1 10:00:00 node2 kernel: Out of memory: Killed process 1\n",
+		}),
+		"logs/default/virt-launcher-vm1-abcde/compute.log": "Out of memory: Killed process 1\n",
+	})
+	reports, err := Nodes(bundle, time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].Name != "node1" || reports[1].Name != "node2" {
+		t.Fatalf("got reports %+v", reports)
+	}
+
+	oom := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		node     string
+		files    int
+		counts   map[NodeFinding]int
+		first    time.Time
+		problems int
+	}{
+		{"node1", 3, map[NodeFinding]int{FindingOOM: 1, FindingLinkFlap: 1, FindingK3sRestart: 1}, oom, 2},
+		// Lines without a timestamp are all counted.
+		{"node2", 1, map[NodeFinding]int{FindingReboot: 1, FindingIOError: 3}, time.Time{}, 3},
+	}
+	for i, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			r := reports[i]
+			if r.Files != tt.files {
+				t.Errorf("got %d files, want %d", r.Files, tt.files)
+			}
+			if len(r.Findings) != len(tt.counts) {
+				t.Errorf("got %d findings, want %d", len(r.Findings), len(tt.counts))
+			}
+			for finding, want := range tt.counts {
+				if stat := r.Findings[finding]; stat == nil || stat.Count != want {
+					t.Errorf("got %s %+v, want %d", finding, stat, want)
+				}
+			}
+			if stat := r.Findings[FindingOOM]; tt.first.IsZero() != (stat == nil) {
+				t.Errorf("got %s %+v", FindingOOM, stat)
+			} else if stat != nil && (!stat.First.Equal(tt.first) || !stat.Last.Equal(tt.first)) {
+				t.Errorf("got %s from %s to %s, want %s", FindingOOM, stat.First, stat.Last, tt.first)
+			}
+			if n := r.Problems(); n != tt.problems {
+				t.Errorf("got %d problems, want %d", n, tt.problems)
+			}
+		})
+	}
+}
+
+func TestNodeLog(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"nodes/node1.zip!/logs/dmesg.log", "node1"},
+		{"nodes/node1.zip", "node1"},
+		{"nodes/node1/logs/messages", "node1"},
+		{"bundle/nodes/node2/console.log", "node2"},
+		{"logs/default/pod/nodes.log", ""},
+		{"yamls/cluster/v1/nodes.yaml", ""},
+	}
+	for _, tt := range tests {
+		if got := nodeLog(tt.name); got != tt.want {
+			t.Errorf("nodeLog(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package report
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	kindVM             = schema.GroupKind{Group: "kubevirt.io", Kind: "VirtualMachine"}
+	kindVMI            = schema.GroupKind{Group: "kubevirt.io", Kind: "VirtualMachineInstance"}
+	kindPod            = schema.GroupKind{Kind: "Pod"}
+	kindPVC            = schema.GroupKind{Kind: "PersistentVolumeClaim"}
+	kindNode           = schema.GroupKind{Kind: "Node"}
+	kindEvent          = schema.GroupKind{Kind: "Event"}
+	kindLonghornVolume = schema.GroupKind{Group: "longhorn.io", Kind: "Volume"}
+)
+
+// Event is a Kubernetes event related to an object in a report.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Reason  string    `json:"reason"`
+	Object  string    `json:"object"`
+	Message string    `json:"message"`
+	Count   int64     `json:"count,omitempty"`
+}
+
+// str returns the string at a path in obj, or "" if there's none.
+func str(obj *unstructured.Unstructured, fields ...string) string {
+	if obj == nil {
+		return ""
+	}
+	s, _, _ := unstructured.NestedFieldNoCopy(obj.Object, fields...)
+	switch v := s.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
+
+// conditionStatus returns the status of a condition in status.conditions.
+func conditionStatus(obj *unstructured.Unstructured, condType string) string {
+	if obj == nil {
+		return ""
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if ok && m["type"] == condType {
+			s, _ := m["status"].(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// byName indexes objects by namespace and name.
+func byName(objs []*unstructured.Unstructured) map[string]*unstructured.Unstructured {
+	m := map[string]*unstructured.Unstructured{}
+	for _, obj := range objs {
+		m[obj.GetNamespace()+"/"+obj.GetName()] = obj
+	}
+	return m
+}
+
+// eventIndex looks up the events of objects by namespace, kind and name.
+type eventIndex map[string][]Event
+
+func newEventIndex(idx *resources.Index) eventIndex {
+	events := eventIndex{}
+	for _, obj := range idx.Objects(kindEvent, "") {
+		kind := str(obj, "involvedObject", "kind")
+		name := str(obj, "involvedObject", "name")
+		e := Event{
+			Time:    eventTime(obj),
+			Type:    str(obj, "type"),
+			Reason:  str(obj, "reason"),
+			Object:  kind + "/" + name,
+			Message: strings.TrimSpace(str(obj, "message")),
+		}
+		e.Count, _, _ = unstructured.NestedInt64(obj.Object, "count")
+		key := eventKey(obj.GetNamespace(), kind, name)
+		events[key] = append(events[key], e)
+	}
+	return events
+}
+
+func eventKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
+
+// recent returns the latest n events of the given objects, newest first.
+func (ei eventIndex) recent(n int, namespace string, objects ...[2]string) []Event {
+	var result []Event
+	for _, o := range objects {
+		result = append(result, ei[eventKey(namespace, o[0], o[1])]...)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.After(result[j].Time) })
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+func eventTime(obj *unstructured.Unstructured) time.Time {
+	for _, field := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+		if t, err := time.Parse(time.RFC3339, str(obj, field)); err == nil {
+			return t
+		}
+	}
+	return obj.GetCreationTimestamp().Time
+}
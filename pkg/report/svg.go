@@ -0,0 +1,165 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth  = 720
+	chartHeight = 180
+	// chartMargin leaves room for the axis labels of time charts.
+	chartMargin = 40
+	// maxBuckets bounds the number of bars of time charts.
+	maxBuckets = 60
+	// maxChartSpan bounds the period of time charts, so a few lines with a
+	// wrong clock don't squash the rest.
+	maxChartSpan = 14 * 24 * time.Hour
+
+	barHeight     = 22
+	barLabelWidth = 300
+	maxLabelSize  = 45
+)
+
+// bucketSizes are the candidate durations of the bars of time charts.
+var bucketSizes = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// bar is a labeled value of a bar chart.
+type bar struct {
+	Label string
+	Value int
+}
+
+// timeChart renders counts by time as an inline SVG histogram.
+func timeChart(counts map[time.Time]int, color string) template.HTML {
+	var times []time.Time
+	for t := range counts {
+		if !t.IsZero() {
+			times = append(times, t)
+		}
+	}
+	if len(times) == 0 {
+		return `<p class="empty">No timestamped entries.</p>`
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	last := times[len(times)-1]
+	first := times[0]
+	hidden := 0
+	if last.Sub(first) > maxChartSpan {
+		first = last.Add(-maxChartSpan)
+		for _, t := range times {
+			if t.Before(first) {
+				hidden += counts[t]
+			}
+		}
+	}
+
+	step := bucketSizes[len(bucketSizes)-1]
+	for _, s := range bucketSizes {
+		if last.Sub(first)/s < maxBuckets {
+			step = s
+			break
+		}
+	}
+	start := first.Truncate(step)
+	buckets := make([]int, int(last.Sub(start)/step)+1)
+	peak := 0
+	for _, t := range times {
+		if t.Before(start) {
+			continue
+		}
+		i := int(t.Sub(start) / step)
+		buckets[i] += counts[t]
+		if buckets[i] > peak {
+			peak = buckets[i]
+		}
+	}
+
+	layout := "01-02 15:04"
+	if step >= 24*time.Hour {
+		layout = "2006-01-02"
+	}
+	plotWidth := float64(chartWidth - chartMargin)
+	plotHeight := float64(chartHeight - chartMargin/2)
+	width := plotWidth / float64(len(buckets))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" class="chart">`, chartWidth, chartHeight+4, chartWidth, chartHeight+4)
+	fmt.Fprintf(&b, `<line x1="%d" y1="0" x2="%d" y2="%g" class="axis"/>`, chartMargin, chartMargin, plotHeight)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%g" x2="%d" y2="%g" class="axis"/>`, chartMargin, plotHeight, chartWidth, plotHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="12" text-anchor="end">%d</text>`, chartMargin-4, peak)
+	fmt.Fprintf(&b, `<text x="%d" y="%g" text-anchor="end">0</text>`, chartMargin-4, plotHeight)
+	for i, count := range buckets {
+		if count == 0 {
+			continue
+		}
+		h := plotHeight * float64(count) / float64(peak)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %d</title></rect>`,
+			float64(chartMargin)+float64(i)*width+0.5, plotHeight-h, maxFloat(width-1, 1), h, color,
+			start.Add(time.Duration(i)*step).UTC().Format(layout), count)
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, chartMargin, chartHeight, start.UTC().Format(layout))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartWidth, chartHeight, last.UTC().Format(layout))
+	b.WriteString(`</svg>`)
+	fmt.Fprintf(&b, `<p class="legend">%s per bar, UTC.`, formatStep(step))
+	if hidden > 0 {
+		fmt.Fprintf(&b, ` %d earlier entries are not shown.`, hidden)
+	}
+	b.WriteString(`</p>`)
+	return template.HTML(b.String())
+}
+
+// barChart renders labeled values as an inline SVG horizontal bar chart.
+func barChart(bars []bar, color string) template.HTML {
+	if len(bars) == 0 {
+		return `<p class="empty">None.</p>`
+	}
+	peak := 0
+	for _, b := range bars {
+		if b.Value > peak {
+			peak = b.Value
+		}
+	}
+	plotWidth := float64(chartWidth - barLabelWidth - chartMargin)
+	height := len(bars) * barHeight
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" class="chart">`, chartWidth, height, chartWidth, height)
+	for i, bar := range bars {
+		y := i * barHeight
+		label := bar.Label
+		if len(label) > maxLabelSize {
+			label = "..." + label[len(label)-maxLabelSize+3:]
+		}
+		w := maxFloat(plotWidth*float64(bar.Value)/float64(peak), 1)
+		fmt.Fprintf(&b, `<g><title>%s: %d</title>`, template.HTMLEscapeString(bar.Label), bar.Value)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, barLabelWidth-6, y+15, template.HTMLEscapeString(label))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="%s"/>`, barLabelWidth, y+3, w, barHeight-6, color)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%d</text></g>`, float64(barLabelWidth)+w+4, y+15, bar.Value)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func formatStep(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%d day(s)", d/(24*time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%d hour(s)", d/time.Hour)
+	}
+	return fmt.Sprintf("%d minute(s)", d/time.Minute)
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,235 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const longhornNamespace = "longhorn-system"
+
+// VMReport is the health of a virtual machine and the objects it depends on.
+type VMReport struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Status is the printable status of the VM, e.g., Running or Stopped.
+	Status string `json:"status"`
+	// Phase is the phase of the VM instance, if there is one.
+	Phase string `json:"phase,omitempty"`
+	Node  string `json:"node,omitempty"`
+	// NodeReady is the Ready condition of the node.
+	NodeReady string     `json:"nodeReady,omitempty"`
+	Pod       string     `json:"pod,omitempty"`
+	PodPhase  string     `json:"podPhase,omitempty"`
+	Volumes   []VMVolume `json:"volumes,omitempty"`
+	Events    []Event    `json:"events,omitempty"`
+	// Issues are inconsistencies and failures found for the VM.
+	Issues []string `json:"issues,omitempty"`
+}
+
+// VMVolume is a volume of a virtual machine.
+type VMVolume struct {
+	Name       string `json:"name"`
+	PVC        string `json:"pvc"`
+	PVCPhase   string `json:"pvcPhase,omitempty"`
+	Volume     string `json:"volume,omitempty"`
+	State      string `json:"state,omitempty"`
+	Robustness string `json:"robustness,omitempty"`
+	// AttachedNode is the node the Longhorn volume is attached to.
+	AttachedNode string `json:"attachedNode,omitempty"`
+}
+
+// VMOptions tunes the VM report.
+type VMOptions struct {
+	// Events is the number of recent events reported per VM.
+	Events int
+}
+
+// VMs correlates the VMs, VM instances, launcher pods, PVCs and Longhorn
+// volumes in a bundle.
+func VMs(idx *resources.Index, opts VMOptions) []*VMReport {
+	vmis := byName(idx.Objects(kindVMI, ""))
+	pvcs := byName(idx.Objects(kindPVC, ""))
+	volumes := byName(idx.Objects(kindLonghornVolume, longhornNamespace))
+	nodes := byName(idx.Objects(kindNode, ""))
+	events := newEventIndex(idx)
+
+	// launcher pods by the VM they run
+	pods := map[string]*unstructured.Unstructured{}
+	for _, pod := range idx.Objects(kindPod, "") {
+		vm := pod.GetLabels()["vm.kubevirt.io/name"]
+		if vm == "" {
+			continue
+		}
+		key := pod.GetNamespace() + "/" + vm
+		// Prefer the running pod if an old one is left behind.
+		if old, ok := pods[key]; !ok || str(old, "status", "phase") != "Running" {
+			pods[key] = pod
+		}
+	}
+
+	var reports []*VMReport
+	for _, vm := range idx.Objects(kindVM, "") {
+		key := vm.GetNamespace() + "/" + vm.GetName()
+		r := &VMReport{
+			Namespace: vm.GetNamespace(),
+			Name:      vm.GetName(),
+			Status:    str(vm, "status", "printableStatus"),
+		}
+		vmi := vmis[key]
+		if vmi != nil {
+			r.Phase = str(vmi, "status", "phase")
+			r.Node = str(vmi, "status", "nodeName")
+		}
+		if node := nodes["/"+r.Node]; node != nil {
+			r.NodeReady = conditionStatus(node, "Ready")
+		}
+		pod := pods[key]
+		if pod != nil {
+			r.Pod = pod.GetName()
+			r.PodPhase = str(pod, "status", "phase")
+		}
+
+		for _, v := range vmVolumes(vm) {
+			claim := pvcs[r.Namespace+"/"+v.PVC]
+			if claim == nil {
+				r.Issues = append(r.Issues, fmt.Sprintf("PVC %s of volume %s not found", v.PVC, v.Name))
+				r.Volumes = append(r.Volumes, v)
+				continue
+			}
+			v.PVCPhase = str(claim, "status", "phase")
+			v.Volume = str(claim, "spec", "volumeName")
+			if lhv := volumes[longhornNamespace+"/"+v.Volume]; lhv != nil {
+				v.State = str(lhv, "status", "state")
+				v.Robustness = str(lhv, "status", "robustness")
+				v.AttachedNode = str(lhv, "status", "currentNodeID")
+			}
+			r.Volumes = append(r.Volumes, v)
+		}
+
+		r.Issues = append(r.Issues, vmIssues(r, vm, vmi, pod)...)
+		if opts.Events > 0 {
+			objects := [][2]string{{"VirtualMachine", r.Name}, {"VirtualMachineInstance", r.Name}}
+			if r.Pod != "" {
+				objects = append(objects, [2]string{"Pod", r.Pod})
+			}
+			r.Events = events.recent(opts.Events, r.Namespace, objects...)
+		}
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Namespace != reports[j].Namespace {
+			return reports[i].Namespace < reports[j].Namespace
+		}
+		return reports[i].Name < reports[j].Name
+	})
+	return reports
+}
+
+// vmVolumes returns the PVC backed volumes in the VM template.
+func vmVolumes(vm *unstructured.Unstructured) []VMVolume {
+	var result []VMVolume
+	volumes, _, _ := unstructured.NestedSlice(vm.Object, "spec", "template", "spec", "volumes")
+	for _, v := range volumes {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		claim, _, _ := unstructured.NestedString(m, "persistentVolumeClaim", "claimName")
+		if claim == "" {
+			// The PVC of a DataVolume has the same name.
+			claim, _, _ = unstructured.NestedString(m, "dataVolume", "name")
+		}
+		if claim != "" {
+			result = append(result, VMVolume{Name: name, PVC: claim})
+		}
+	}
+	return result
+}
+
+// runningStatuses are the printable statuses of VMs expected to have a
+// running instance.
+var runningStatuses = map[string]bool{
+	"Running":   true,
+	"Starting":  true,
+	"Migrating": true,
+}
+
+// failedStatuses are the printable statuses of VMs that failed to start or
+// run.
+var failedStatuses = map[string]bool{
+	"CrashLoopBackOff":        true,
+	"ErrorUnschedulable":      true,
+	"ErrImagePull":            true,
+	"ImagePullBackOff":        true,
+	"ErrorPvcNotFound":        true,
+	"ErrorDataVolumeNotFound": true,
+	"DataVolumeError":         true,
+	"Unknown":                 true,
+}
+
+func vmIssues(r *VMReport, vm, vmi, pod *unstructured.Unstructured) []string {
+	var issues []string
+	if failedStatuses[r.Status] {
+		issues = append(issues, "VM status is "+r.Status)
+	}
+	if msg := conditionMessage(vm, "Failure"); msg != "" {
+		issues = append(issues, "VM failure: "+msg)
+	}
+	if runningStatuses[r.Status] && vmi == nil {
+		issues = append(issues, "VM is "+r.Status+" but has no instance")
+	}
+	if r.Status == "Stopped" && vmi != nil && r.Phase == "Running" {
+		issues = append(issues, "VM is Stopped but its instance is Running")
+	}
+	if vmi != nil && r.Phase == "Running" {
+		if r.NodeReady != "" && r.NodeReady != "True" {
+			issues = append(issues, fmt.Sprintf("instance runs on node %s which is not Ready (%s)", r.Node, r.NodeReady))
+		}
+		if pod == nil {
+			issues = append(issues, "instance is Running but has no launcher pod")
+		} else if r.PodPhase != "Running" {
+			issues = append(issues, "instance is Running but launcher pod "+r.Pod+" is "+r.PodPhase)
+		} else if node := str(pod, "spec", "nodeName"); node != "" && node != r.Node {
+			issues = append(issues, fmt.Sprintf("instance is on node %s but launcher pod is on %s", r.Node, node))
+		}
+	}
+	if r.Phase == "Failed" {
+		issues = append(issues, "instance phase is Failed")
+	}
+	for _, v := range r.Volumes {
+		if v.PVCPhase != "" && v.PVCPhase != "Bound" {
+			issues = append(issues, fmt.Sprintf("PVC %s is %s", v.PVC, v.PVCPhase))
+		}
+		switch v.Robustness {
+		case "degraded", "faulted", "unknown":
+			issues = append(issues, fmt.Sprintf("volume %s is %s", v.Volume, v.Robustness))
+		}
+		if r.Phase == "Running" && v.AttachedNode != "" && r.Node != "" && v.AttachedNode != r.Node {
+			issues = append(issues, fmt.Sprintf("volume %s is attached to %s but instance runs on %s", v.Volume, v.AttachedNode, r.Node))
+		}
+		if r.Phase == "Running" && v.State != "" && v.State != "attached" {
+			issues = append(issues, fmt.Sprintf("volume %s is %s while instance is Running", v.Volume, v.State))
+		}
+	}
+	return issues
+}
+
+// conditionMessage returns the message of a true condition in status.conditions.
+func conditionMessage(obj *unstructured.Unstructured, condType string) string {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if ok && m["type"] == condType && m["status"] == "True" {
+			msg, _ := m["message"].(string)
+			if msg == "" {
+				msg, _ = m["reason"].(string)
+			}
+			return msg
+		}
+	}
+	return ""
+}
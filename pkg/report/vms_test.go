@@ -0,0 +1,180 @@
+package report
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bk201/support-bundle-utils/pkg/resources"
+)
+
+const vmsNodes = `apiVersion: v1
+kind: NodeList
+items:
+- metadata:
+    name: node1
+  status:
+    conditions:
+    - type: Ready
+      status: "True"
+- metadata:
+    name: node2
+  status:
+    conditions:
+    - type: Ready
+      status: Unknown
+`
+
+// vm returns a VM with a PVC backed volume per claim.
+func vm(name, status string, claims ...string) string {
+	var b strings.Builder
+	b.WriteString("- metadata:\n    name: " + name + "\n    namespace: default\n")
+	b.WriteString("  spec:\n    template:\n      spec:\n        volumes:\n")
+	b.WriteString("        - name: cloudinit\n          cloudInitNoCloud: {}\n")
+	for _, claim := range claims {
+		b.WriteString("        - name: disk-" + claim + "\n          persistentVolumeClaim:\n            claimName: " + claim + "\n")
+	}
+	b.WriteString("  status:\n    printableStatus: " + status + "\n")
+	return b.String()
+}
+
+var vmsVMs = "apiVersion: kubevirt.io/v1\nkind: VirtualMachineList\nitems:\n" +
+	vm("healthy", "Running", "healthy-disk") +
+	vm("crashing", "CrashLoopBackOff") +
+	vm("starting", "Starting") +
+	vm("stopped", "Stopped") +
+	vm("not-ready-node", "Running") +
+	vm("no-pod", "Running") +
+	vm("pod-pending", "Running") +
+	vm("pod-elsewhere", "Running") +
+	vm("failed", "Running") +
+	vm("volumes", "Running", "missing", "pending", "degraded", "detached") +
+	`- metadata:
+    name: failure
+    namespace: default
+  status:
+    printableStatus: Stopped
+    conditions:
+    - type: Failure
+      status: "True"
+      reason: FailedCreate
+      message: 'admission webhook denied the request'
+`
+
+// vmi returns a VM instance in a phase on a node.
+func vmi(name, phase, node string) string {
+	return "- metadata:\n    name: " + name + "\n    namespace: default\n" +
+		"  status:\n    phase: " + phase + "\n    nodeName: " + node + "\n"
+}
+
+var vmsVMIs = "apiVersion: kubevirt.io/v1\nkind: VirtualMachineInstanceList\nitems:\n" +
+	vmi("healthy", "Running", "node1") +
+	vmi("stopped", "Running", "node1") +
+	vmi("not-ready-node", "Running", "node2") +
+	vmi("no-pod", "Running", "node1") +
+	vmi("pod-pending", "Running", "node1") +
+	vmi("pod-elsewhere", "Running", "node1") +
+	vmi("failed", "Failed", "node1") +
+	vmi("volumes", "Running", "node1")
+
+// launcher returns the virt-launcher pod of a VM in a phase on a node.
+func launcher(vm, phase, node string) string {
+	return "- metadata:\n    name: virt-launcher-" + vm + "-abcde\n    namespace: default\n" +
+		"    labels:\n      vm.kubevirt.io/name: " + vm + "\n" +
+		"  spec:\n    nodeName: " + node + "\n  status:\n    phase: " + phase + "\n"
+}
+
+var vmsPods = "apiVersion: v1\nkind: PodList\nitems:\n" +
+	launcher("healthy", "Running", "node1") +
+	launcher("stopped", "Running", "node1") +
+	launcher("not-ready-node", "Running", "node2") +
+	launcher("pod-pending", "Pending", "node1") +
+	launcher("pod-elsewhere", "Running", "node2") +
+	launcher("volumes", "Running", "node1")
+
+// pvc returns a claim in a phase bound to a volume.
+func pvc(name, phase string) string {
+	return "- metadata:\n    name: " + name + "\n    namespace: default\n" +
+		"  spec:\n    volumeName: pvc-" + name + "\n  status:\n    phase: " + phase + "\n"
+}
+
+var vmsPVCs = "apiVersion: v1\nkind: PersistentVolumeClaimList\nitems:\n" +
+	pvc("healthy-disk", "Bound") +
+	pvc("pending", "Pending") +
+	pvc("degraded", "Bound") +
+	pvc("detached", "Bound")
+
+// lhVolume returns a Longhorn volume.
+func lhVolume(name, state, robustness, node string) string {
+	return "- metadata:\n    name: " + name + "\n    namespace: longhorn-system\n" +
+		"  status:\n    state: " + state + "\n    robustness: " + robustness + "\n    currentNodeID: '" + node + "'\n"
+}
+
+var vmsLonghornVolumes = "apiVersion: longhorn.io/v1beta1\nkind: VolumeList\nitems:\n" +
+	lhVolume("pvc-healthy-disk", "attached", "healthy", "node1") +
+	lhVolume("pvc-degraded", "attached", "degraded", "node2") +
+	lhVolume("pvc-detached", "detached", "unknown", "")
+
+func TestVMs(t *testing.T) {
+	bundle := writeBundle(t, map[string]string{
+		"yamls/cluster/v1/nodes.yaml":                                          vmsNodes,
+		"yamls/namespaced/default/kubevirt.io/v1/virtualmachines.yaml":         vmsVMs,
+		"yamls/namespaced/default/kubevirt.io/v1/virtualmachineinstances.yaml": vmsVMIs,
+		"yamls/namespaced/default/v1/pods.yaml":                                vmsPods,
+		"yamls/namespaced/default/v1/persistentvolumeclaims.yaml":              vmsPVCs,
+		"yamls/namespaced/longhorn-system/longhorn.io/v1beta1/volumes.yaml":    vmsLonghornVolumes,
+	})
+	idx, err := resources.Load(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := map[string]*VMReport{}
+	for _, r := range VMs(idx, VMOptions{}) {
+		reports[r.Name] = r
+	}
+
+	tests := []struct {
+		vm     string
+		issues []string
+	}{
+		{"healthy", nil},
+		{"crashing", []string{"VM status is CrashLoopBackOff"}},
+		{"starting", []string{"VM is Starting but has no instance"}},
+		{"stopped", []string{"VM is Stopped but its instance is Running"}},
+		{"not-ready-node", []string{"instance runs on node node2 which is not Ready (Unknown)"}},
+		{"no-pod", []string{"instance is Running but has no launcher pod"}},
+		{"pod-pending", []string{"instance is Running but launcher pod virt-launcher-pod-pending-abcde is Pending"}},
+		{"pod-elsewhere", []string{"instance is on node node1 but launcher pod is on node2"}},
+		{"failed", []string{"instance phase is Failed"}},
+		{"failure", []string{"VM failure: admission webhook denied the request"}},
+		{"volumes", []string{
+			"PVC missing of volume disk-missing not found",
+			"PVC pending is Pending",
+			"volume pvc-degraded is degraded",
+			"volume pvc-degraded is attached to node2 but instance runs on node1",
+			"volume pvc-detached is unknown",
+			"volume pvc-detached is detached while instance is Running",
+		}},
+	}
+	if len(reports) != len(tests) {
+		t.Errorf("got %d VMs, want %d", len(reports), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.vm, func(t *testing.T) {
+			r := reports[tt.vm]
+			if r == nil {
+				t.Fatal("VM not reported")
+			}
+			if strings.Join(r.Issues, "\n") != strings.Join(tt.issues, "\n") {
+				t.Errorf("got issues\n%s\nwant\n%s", strings.Join(r.Issues, "\n"), strings.Join(tt.issues, "\n"))
+			}
+		})
+	}
+
+	healthy := reports["healthy"]
+	if healthy.Node != "node1" || healthy.NodeReady != "True" || healthy.Pod != "virt-launcher-healthy-abcde" || len(healthy.Volumes) != 1 {
+		t.Errorf("got report %+v", healthy)
+	}
+	if v := healthy.Volumes[0]; v.Volume != "pvc-healthy-disk" || v.Robustness != "healthy" || v.AttachedNode != "node1" {
+		t.Errorf("got volume %+v", v)
+	}
+}
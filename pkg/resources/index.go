@@ -0,0 +1,341 @@
+package resources
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Index holds the Kubernetes objects found in the YAML files of a bundle,
+// indexed by type, namespace and name.
+type Index struct {
+	// CollectedAt is the time the bundle was collected, estimated from the
+	// newest file in it. Ages are reported relative to it.
+	CollectedAt time.Time
+	// Errors records the files that could not be parsed.
+	Errors []error
+
+	types   map[schema.GroupVersionKind]*Type
+	objects map[schema.GroupVersionKind]map[string]*unstructured.Unstructured
+}
+
+// Type describes a kind of objects found in a bundle.
+type Type struct {
+	schema.GroupVersionKind
+	// Resource is the plural resource name, e.g., virtualmachines.
+	Resource   string
+	Namespaced bool
+	ShortNames []string
+	Count      int
+}
+
+// GroupResource returns the resource name qualified with the group, e.g.,
+// virtualmachines.kubevirt.io.
+func (t *Type) GroupResource() string {
+	if t.Group == "" {
+		return t.Resource
+	}
+	return t.Resource + "." + t.Group
+}
+
+func newIndex() *Index {
+	return &Index{
+		types:   map[schema.GroupVersionKind]*Type{},
+		objects: map[schema.GroupVersionKind]map[string]*unstructured.Unstructured{},
+	}
+}
+
+// Load indexes a bundle zip file or a directory holding an extracted bundle.
+// Archives nested in the bundle, e.g., node logs, are not read.
+func Load(p string) (*Index, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	idx := newIndex()
+	if info.IsDir() {
+		err = idx.loadDir(p)
+	} else {
+		err = idx.loadZip(p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(idx.types) == 0 {
+		return nil, fmt.Errorf("no Kubernetes resources found in %s", p)
+	}
+	return idx, nil
+}
+
+func (idx *Index) loadZip(p string) error {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !isYAML(f.Name) {
+			continue
+		}
+		if f.Modified.After(idx.CollectedAt) {
+			idx.CollectedAt = f.Modified
+		}
+		rc, err := f.Open()
+		if err != nil {
+			idx.Errors = append(idx.Errors, fmt.Errorf("%s: %s", f.Name, err))
+			continue
+		}
+		idx.loadFile(f.Name, rc)
+		rc.Close()
+	}
+	return nil
+}
+
+func (idx *Index) loadDir(root string) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// An unreadable directory is skipped, like unreadable files.
+			idx.Errors = append(idx.Errors, fmt.Errorf("%s: %s", p, err))
+			return nil
+		}
+		if info.IsDir() || !isYAML(p) {
+			return nil
+		}
+		if info.ModTime().After(idx.CollectedAt) {
+			idx.CollectedAt = info.ModTime()
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			idx.Errors = append(idx.Errors, fmt.Errorf("%s: %s", p, err))
+			return nil
+		}
+		defer f.Close()
+		rel, _ := filepath.Rel(root, p)
+		idx.loadFile(filepath.ToSlash(rel), f)
+		return nil
+	})
+}
+
+func isYAML(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// loadFile adds the objects in a YAML file, which may hold several documents
+// and lists. Documents that aren't Kubernetes objects are ignored.
+func (idx *Index) loadFile(name string, r io.Reader) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			idx.Errors = append(idx.Errors, fmt.Errorf("%s: %s", name, err))
+			return
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		data, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			idx.Errors = append(idx.Errors, fmt.Errorf("%s: %s", name, err))
+			return
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(data); err != nil {
+			// not a Kubernetes object
+			continue
+		}
+		resource := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		if !obj.IsList() {
+			idx.add(obj, resource)
+			continue
+		}
+
+		// Items of typed lists may come without apiVersion and kind.
+		items, _, _ := unstructured.NestedSlice(obj.Object, "items")
+		itemKind := strings.TrimSuffix(obj.GetKind(), "List")
+		for _, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			o := &unstructured.Unstructured{Object: m}
+			if o.GetAPIVersion() == "" {
+				o.SetAPIVersion(obj.GetAPIVersion())
+			}
+			if o.GetKind() == "" && itemKind != "" {
+				o.SetKind(itemKind)
+			}
+			if o.GetKind() != "" {
+				idx.add(o, resource)
+			}
+		}
+	}
+}
+
+// add indexes an object. fileResource is the base name of the file it comes
+// from, which is the plural resource name in bundles.
+func (idx *Index) add(obj *unstructured.Unstructured, fileResource string) {
+	if obj.GetName() == "" {
+		return
+	}
+	gvk := obj.GroupVersionKind()
+	t, ok := idx.types[gvk]
+	if !ok {
+		t = newType(gvk, fileResource)
+		idx.types[gvk] = t
+		idx.objects[gvk] = map[string]*unstructured.Unstructured{}
+	}
+	key := objectKey(obj.GetNamespace(), obj.GetName())
+	if _, ok := idx.objects[gvk][key]; ok {
+		return
+	}
+	idx.objects[gvk][key] = obj
+	t.Count++
+	if obj.GetNamespace() != "" {
+		t.Namespaced = true
+	}
+}
+
+func objectKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// Types returns the types in the bundle sorted by group and resource.
+func (idx *Index) Types() []*Type {
+	var types []*Type
+	for _, t := range idx.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Group != types[j].Group {
+			return types[i].Group < types[j].Group
+		}
+		if types[i].Resource != types[j].Resource {
+			return types[i].Resource < types[j].Resource
+		}
+		return types[i].Version < types[j].Version
+	})
+	return types
+}
+
+// ResolveType finds the types matching a resource name as accepted by
+// kubectl: plural, singular, kind or short name, optionally qualified with
+// the group, e.g., vm, virtualmachines or virtualmachines.kubevirt.io.
+func (idx *Index) ResolveType(name string) ([]*Type, error) {
+	name = strings.ToLower(name)
+	var matched []*Type
+	for _, t := range idx.Types() {
+		if t.matches(name) {
+			matched = append(matched, t)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("the bundle doesn't have resource type %q", name)
+	}
+	return matched, nil
+}
+
+func (t *Type) matches(name string) bool {
+	resource, group := name, ""
+	if i := strings.Index(name, "."); i >= 0 {
+		resource, group = name[:i], name[i+1:]
+		if group != t.Group && !strings.HasPrefix(t.Group, group+".") {
+			return false
+		}
+	}
+	if resource == t.Resource || resource == strings.ToLower(t.Kind) {
+		return true
+	}
+	for _, s := range t.ShortNames {
+		if resource == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ListOptions selects objects of a type. Empty fields match everything.
+type ListOptions struct {
+	Namespace string
+	Selector  labels.Selector
+	Fields    []*FieldQuery
+}
+
+// List returns the objects of a type matching opts, sorted by namespace and
+// name.
+func (idx *Index) List(t *Type, opts ListOptions) ([]*unstructured.Unstructured, error) {
+	var result []*unstructured.Unstructured
+	for _, obj := range idx.objects[t.GroupVersionKind] {
+		if opts.Namespace != "" && obj.GetNamespace() != opts.Namespace {
+			continue
+		}
+		if opts.Selector != nil && !opts.Selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		matched := true
+		for _, q := range opts.Fields {
+			ok, err := q.Matches(obj)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, obj)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].GetNamespace() != result[j].GetNamespace() {
+			return result[i].GetNamespace() < result[j].GetNamespace()
+		}
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result, nil
+}
+
+// Get returns an object of a type, or nil if it isn't in the bundle.
+func (idx *Index) Get(t *Type, namespace, name string) *unstructured.Unstructured {
+	return idx.objects[t.GroupVersionKind][objectKey(namespace, name)]
+}
+
+// Objects returns all objects of a kind in a namespace, or in all namespaces
+// if namespace is empty, regardless of the version they were stored with.
+// Objects stored with several versions are returned once.
+func (idx *Index) Objects(gk schema.GroupKind, namespace string) []*unstructured.Unstructured {
+	var result []*unstructured.Unstructured
+	seen := map[string]bool{}
+	for _, t := range idx.Types() {
+		if t.GroupKind() != gk {
+			continue
+		}
+		objs, _ := idx.List(t, ListOptions{Namespace: namespace})
+		for _, obj := range objs {
+			key := objectKey(obj.GetNamespace(), obj.GetName())
+			if !seen[key] {
+				seen[key] = true
+				result = append(result, obj)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,217 @@
+package resources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const testVMs = `apiVersion: kubevirt.io/v1
+kind: VirtualMachineList
+items:
+- metadata:
+    name: vm1
+    namespace: default
+    labels:
+      app: web
+  status:
+    printableStatus: Running
+- metadata:
+    name: vm2
+    namespace: prod
+    labels:
+      app: db
+  status:
+    printableStatus: Stopped
+`
+
+const testPods = `apiVersion: v1
+kind: PodList
+items:
+- metadata:
+    name: virt-launcher-vm1
+    namespace: default
+  spec:
+    containers:
+    - name: compute
+    - name: guest-console-log
+  status:
+    phase: Running
+`
+
+// Longhorn has a Node kind of its own.
+const testLonghornNodes = `apiVersion: longhorn.io/v1beta1
+kind: Node
+metadata:
+  name: node1
+  namespace: longhorn-system
+`
+
+const testNodes = `apiVersion: v1
+kind: Node
+metadata:
+  name: node1
+`
+
+func writeTestBundle(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "resources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	files := map[string]string{
+		"yamls/namespaced/kubevirt.io/v1/virtualmachines.yaml": testVMs,
+		"yamls/namespaced/default/v1/pods.yaml":                testPods,
+		"yamls/namespaced/longhorn.io/v1beta1/nodes.yaml":      testLonghornNodes,
+		"yamls/cluster/v1/nodes.yaml":                          testNodes,
+		"yamls/cluster/v1/broken.yaml":                         "apiVersion: v1\nkind: [",
+		"logs/pod.log":                                         "not yaml",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestResolveType(t *testing.T) {
+	idx, err := Load(writeTestBundle(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Errors) != 1 || !strings.Contains(idx.Errors[0].Error(), "broken.yaml") {
+		t.Errorf("got errors %v, want broken.yaml", idx.Errors)
+	}
+
+	tests := []struct {
+		name    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "virtualmachines", want: []string{"virtualmachines.kubevirt.io"}},
+		{name: "virtualmachine", want: []string{"virtualmachines.kubevirt.io"}},
+		{name: "VirtualMachine", want: []string{"virtualmachines.kubevirt.io"}},
+		{name: "vm", want: []string{"virtualmachines.kubevirt.io"}},
+		{name: "vms", want: []string{"virtualmachines.kubevirt.io"}},
+		{name: "po", want: []string{"pods"}},
+		{name: "vm.kubevirt.io", want: []string{"virtualmachines.kubevirt.io"}},
+		// A group prefix is enough, like kubectl.
+		{name: "virtualmachines.kubevirt", want: []string{"virtualmachines.kubevirt.io"}},
+		{name: "nodes", want: []string{"nodes", "nodes.longhorn.io"}},
+		{name: "nodes.longhorn.io", want: []string{"nodes.longhorn.io"}},
+		{name: "no", want: []string{"nodes"}},
+		{name: "lhn", want: []string{"nodes.longhorn.io"}},
+		{name: "vm.cdi.kubevirt.io", wantErr: true},
+		{name: "virtualmachines.io", wantErr: true},
+		{name: "services", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types, err := idx.ResolveType(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			var got []string
+			for _, typ := range types {
+				got = append(got, typ.GroupResource())
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	idx, err := Load(writeTestBundle(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, err := idx.ResolveType("vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmType := types[0]
+	if !vmType.Namespaced || vmType.Count != 2 {
+		t.Errorf("got type %+v", vmType)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		selector  string
+		fields    string
+		want      string
+	}{
+		{name: "all", want: "default/vm1 prod/vm2"},
+		{name: "namespace", namespace: "prod", want: "prod/vm2"},
+		{name: "selector", selector: "app=web", want: "default/vm1"},
+		{name: "set selector", selector: "app in (web,db)", want: "default/vm1 prod/vm2"},
+		{name: "field", fields: "status.printableStatus!=Running", want: "prod/vm2"},
+		{name: "fields", fields: "metadata.namespace=default,status.printableStatus==Running", want: "default/vm1"},
+		{name: "no match", namespace: "prod", selector: "app=web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ListOptions{Namespace: tt.namespace}
+			if tt.selector != "" {
+				if opts.Selector, err = labels.Parse(tt.selector); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if opts.Fields, err = ParseFieldQueries(tt.fields); err != nil {
+				t.Fatal(err)
+			}
+			objs, err := idx.List(vmType, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, obj := range objs {
+				got = append(got, obj.GetNamespace()+"/"+obj.GetName())
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDirUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions don't apply to root")
+	}
+	dir := writeTestBundle(t)
+	locked := filepath.Join(dir, "yamls", "cluster")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	idx, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.ResolveType("vm"); err != nil {
+		t.Error(err)
+	}
+	found := false
+	for _, err := range idx.Errors {
+		found = found || strings.Contains(err.Error(), locked)
+	}
+	if !found {
+		t.Errorf("got errors %v, want %s", idx.Errors, locked)
+	}
+}
@@ -0,0 +1,114 @@
+package resources
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// FieldQuery matches a field of objects against a value, e.g.,
+// status.printableStatus!=Running. The field is a JSONPath expression as
+// used by kubectl, with or without the surrounding braces and leading dot.
+type FieldQuery struct {
+	Path  string
+	Value string
+	Not   bool
+
+	jp *jsonpath.JSONPath
+}
+
+// ParseFieldQuery parses "path=value", "path==value" or "path!=value".
+func ParseFieldQuery(s string) (*FieldQuery, error) {
+	q := &FieldQuery{}
+	var i, n int
+	if i = strings.Index(s, "!="); i >= 0 {
+		q.Not, n = true, 2
+	} else if i = strings.Index(s, "=="); i >= 0 {
+		n = 2
+	} else if i = strings.Index(s, "="); i >= 0 {
+		n = 1
+	} else {
+		return nil, fmt.Errorf("invalid field query %q, expect path=value or path!=value", s)
+	}
+	q.Path, q.Value = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+n:])
+
+	jp, err := ParseJSONPath(q.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field query %q: %s", s, err)
+	}
+	q.jp = jp
+	return q, nil
+}
+
+// ParseFieldQueries parses a comma separated list of field queries.
+func ParseFieldQueries(s string) ([]*FieldQuery, error) {
+	var queries []*FieldQuery
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		q, err := ParseFieldQuery(part)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
+
+// Matches reports whether any value the path selects in obj equals the query
+// value, or for != queries, whether none does. Missing fields are empty.
+func (q *FieldQuery) Matches(obj *unstructured.Unstructured) (bool, error) {
+	values, err := evaluate(q.jp, obj)
+	if err != nil {
+		return false, err
+	}
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	found := false
+	for _, v := range values {
+		if v == q.Value {
+			found = true
+			break
+		}
+	}
+	return found != q.Not, nil
+}
+
+// ParseJSONPath parses a kubectl JSONPath template. Plain paths like
+// status.phase are wrapped as {.status.phase}.
+func ParseJSONPath(expr string) (*jsonpath.JSONPath, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.Contains(expr, "{") {
+		expr = "{." + strings.TrimPrefix(expr, ".") + "}"
+	}
+	jp := jsonpath.New("query").AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return nil, err
+	}
+	return jp, nil
+}
+
+// evaluate returns the values a JSONPath selects in obj as strings.
+func evaluate(jp *jsonpath.JSONPath, obj *unstructured.Unstructured) ([]string, error) {
+	results, err := jp.FindResults(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, result := range results {
+		for _, v := range result {
+			var buf bytes.Buffer
+			if err := jp.PrintResults(&buf, []reflect.Value{v}); err != nil {
+				return nil, err
+			}
+			values = append(values, buf.String())
+		}
+	}
+	return values, nil
+}
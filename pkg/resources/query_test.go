@@ -0,0 +1,88 @@
+package resources
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseFieldQuery(t *testing.T) {
+	tests := []struct {
+		in      string
+		path    string
+		value   string
+		not     bool
+		wantErr bool
+	}{
+		{in: "status.phase=Running", path: "status.phase", value: "Running"},
+		{in: "status.phase==Running", path: "status.phase", value: "Running"},
+		{in: "status.phase!=Running", path: "status.phase", value: "Running", not: true},
+		{in: " status.phase != Running ", path: "status.phase", value: "Running", not: true},
+		{in: ".status.phase=", path: ".status.phase", value: ""},
+		{in: "{.metadata.labels.app}=web", path: "{.metadata.labels.app}", value: "web"},
+		// Only the first operator splits, the value may hold more.
+		{in: "metadata.annotations.note=a=b", path: "metadata.annotations.note", value: "a=b"},
+		{in: "status.phase", wantErr: true},
+		{in: "status.phase[=x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			q, err := ParseFieldQuery(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if q.Path != tt.path || q.Value != tt.value || q.Not != tt.not {
+				t.Errorf("got %q %q not=%t, want %q %q not=%t", q.Path, q.Value, q.Not, tt.path, tt.value, tt.not)
+			}
+		})
+	}
+}
+
+func TestFieldQueryMatches(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "virt-launcher-vm1"},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "compute"},
+				map[string]interface{}{"name": "guest-console-log"},
+			},
+		},
+		"status": map[string]interface{}{"phase": "Running", "ready": true},
+	}}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"status.phase=Running", true},
+		{"status.phase==Running", true},
+		{"status.phase!=Running", false},
+		{"status.phase=Pending", false},
+		{"status.phase!=Pending", true},
+		{"status.ready=true", true},
+		// Missing fields are empty.
+		{"status.reason=", true},
+		{"status.reason!=", false},
+		// Any selected value matches, != requires that none does.
+		{"spec.containers[*].name=compute", true},
+		{"spec.containers[*].name!=compute", false},
+		{"spec.containers[*].name!=sidecar", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseFieldQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := q.Matches(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Column is a table column showing the values a JSONPath selects.
+type Column struct {
+	Name     string
+	JSONPath string
+	// Wide columns are only shown in wide output.
+	Wide bool
+
+	jp *jsonpath.JSONPath
+}
+
+// kindColumns are the columns shown for kinds besides NAME and AGE, close to
+// what kubectl prints for them.
+var kindColumns = map[schema.GroupKind][]Column{
+	{Kind: "Pod"}: {
+		{Name: "STATUS", JSONPath: "{.status.phase}"},
+		{Name: "RESTARTS", JSONPath: "{.status.containerStatuses[*].restartCount}"},
+		{Name: "IP", JSONPath: "{.status.podIP}", Wide: true},
+		{Name: "NODE", JSONPath: "{.spec.nodeName}", Wide: true},
+	},
+	{Kind: "Node"}: {
+		{Name: "READY", JSONPath: `{.status.conditions[?(@.type=="Ready")].status}`},
+		{Name: "VERSION", JSONPath: "{.status.nodeInfo.kubeletVersion}"},
+		{Name: "INTERNAL-IP", JSONPath: `{.status.addresses[?(@.type=="InternalIP")].address}`, Wide: true},
+		{Name: "OS-IMAGE", JSONPath: "{.status.nodeInfo.osImage}", Wide: true},
+	},
+	{Kind: "PersistentVolumeClaim"}: {
+		{Name: "STATUS", JSONPath: "{.status.phase}"},
+		{Name: "VOLUME", JSONPath: "{.spec.volumeName}"},
+		{Name: "CAPACITY", JSONPath: "{.status.capacity.storage}"},
+		{Name: "STORAGECLASS", JSONPath: "{.spec.storageClassName}", Wide: true},
+	},
+	{Kind: "Event"}: {
+		{Name: "TYPE", JSONPath: "{.type}"},
+		{Name: "REASON", JSONPath: "{.reason}"},
+		{Name: "OBJECT", JSONPath: "{.involvedObject.kind}/{.involvedObject.name}"},
+		{Name: "MESSAGE", JSONPath: "{.message}"},
+	},
+	{Group: "apps", Kind: "Deployment"}: {
+		{Name: "READY", JSONPath: "{.status.readyReplicas}/{.status.replicas}"},
+	},
+	{Group: "apps", Kind: "DaemonSet"}: {
+		{Name: "DESIRED", JSONPath: "{.status.desiredNumberScheduled}"},
+		{Name: "READY", JSONPath: "{.status.numberReady}"},
+	},
+	{Group: "apps", Kind: "StatefulSet"}: {
+		{Name: "READY", JSONPath: "{.status.readyReplicas}/{.status.replicas}"},
+	},
+	{Group: "kubevirt.io", Kind: "VirtualMachine"}: {
+		{Name: "STATUS", JSONPath: "{.status.printableStatus}"},
+		{Name: "READY", JSONPath: "{.status.ready}"},
+	},
+	{Group: "kubevirt.io", Kind: "VirtualMachineInstance"}: {
+		{Name: "PHASE", JSONPath: "{.status.phase}"},
+		{Name: "IP", JSONPath: "{.status.interfaces[0].ipAddress}"},
+		{Name: "NODENAME", JSONPath: "{.status.nodeName}"},
+	},
+	{Group: "longhorn.io", Kind: "Volume"}: {
+		{Name: "STATE", JSONPath: "{.status.state}"},
+		{Name: "ROBUSTNESS", JSONPath: "{.status.robustness}"},
+		{Name: "SIZE", JSONPath: "{.spec.size}"},
+		{Name: "NODE", JSONPath: "{.status.currentNodeID}"},
+	},
+	{Group: "longhorn.io", Kind: "Replica"}: {
+		{Name: "STATE", JSONPath: "{.status.currentState}"},
+		{Name: "NODE", JSONPath: "{.spec.nodeID}"},
+		{Name: "DISK", JSONPath: "{.spec.diskID}", Wide: true},
+	},
+}
+
+// ParseColumns parses kubectl style custom columns, e.g.,
+// NAME:.metadata.name,STATUS:.status.phase.
+func ParseColumns(spec string) ([]Column, error) {
+	var columns []Column
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid custom column %q, expect NAME:JSONPATH", part)
+		}
+		c := Column{Name: kv[0], JSONPath: kv[1]}
+		if err := c.parse(); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+func (c *Column) parse() error {
+	if c.jp != nil {
+		return nil
+	}
+	jp, err := ParseJSONPath(c.JSONPath)
+	if err != nil {
+		return fmt.Errorf("invalid column %s: %s", c.Name, err)
+	}
+	c.jp = jp
+	return nil
+}
+
+// Value returns the column value of obj, joining multiple values with commas.
+func (c *Column) Value(obj *unstructured.Unstructured) string {
+	if err := c.parse(); err != nil {
+		return "<error>"
+	}
+	// Templates with several expressions, e.g., {.a}/{.b}, are printed as a
+	// whole.
+	if strings.Count(c.JSONPath, "{") > 1 {
+		var b strings.Builder
+		if err := c.jp.Execute(&b, obj.Object); err != nil {
+			return "<error>"
+		}
+		return b.String()
+	}
+	values, err := evaluate(c.jp, obj)
+	if err != nil {
+		return "<error>"
+	}
+	if len(values) == 0 {
+		return "<none>"
+	}
+	return strings.Join(values, ",")
+}
+
+// Table is a tabular view of objects.
+type Table struct {
+	Headers []string
+	// Wide marks the headers of columns only shown in wide output.
+	Wide []bool
+	Rows [][]string
+}
+
+// NewTable builds the default table of a type: the namespace when
+// withNamespace is set, the name, the columns of the kind and the age of the
+// objects relative to the bundle collection time.
+func (idx *Index) NewTable(t *Type, objs []*unstructured.Unstructured, withNamespace, wide bool) *Table {
+	columns := []Column{}
+	for _, c := range kindColumns[t.GroupKind()] {
+		if !c.Wide || wide {
+			columns = append(columns, c)
+		}
+	}
+	table := &Table{}
+	if withNamespace {
+		table.addHeader("NAMESPACE", false)
+	}
+	table.addHeader("NAME", false)
+	for _, c := range columns {
+		table.addHeader(c.Name, c.Wide)
+	}
+	table.addHeader("AGE", false)
+
+	for _, obj := range objs {
+		var row []string
+		if withNamespace {
+			row = append(row, obj.GetNamespace())
+		}
+		row = append(row, obj.GetName())
+		for i := range columns {
+			row = append(row, columns[i].Value(obj))
+		}
+		row = append(row, idx.Age(obj))
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// NewCustomTable builds a table of custom columns.
+func NewCustomTable(columns []Column, objs []*unstructured.Unstructured) *Table {
+	table := &Table{}
+	for _, c := range columns {
+		table.addHeader(c.Name, false)
+	}
+	for _, obj := range objs {
+		var row []string
+		for i := range columns {
+			row = append(row, columns[i].Value(obj))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+func (t *Table) addHeader(name string, wide bool) {
+	t.Headers = append(t.Headers, name)
+	t.Wide = append(t.Wide, wide)
+}
+
+// Age returns the age of obj at the time the bundle was collected.
+func (idx *Index) Age(obj *unstructured.Unstructured) string {
+	created := obj.GetCreationTimestamp()
+	if created.IsZero() {
+		return "<unknown>"
+	}
+	at := idx.CollectedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return duration.HumanDuration(at.Sub(created.Time))
+}
@@ -0,0 +1,71 @@
+package resources
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// shortNames are the short names of the kinds commonly found in Harvester
+// bundles, as registered by their API servers.
+var shortNames = map[schema.GroupKind][]string{
+	{Kind: "ConfigMap"}:                             {"cm"},
+	{Kind: "Endpoints"}:                             {"ep"},
+	{Kind: "Event"}:                                 {"ev"},
+	{Kind: "Namespace"}:                             {"ns"},
+	{Kind: "Node"}:                                  {"no"},
+	{Kind: "PersistentVolume"}:                      {"pv"},
+	{Kind: "PersistentVolumeClaim"}:                 {"pvc"},
+	{Kind: "Pod"}:                                   {"po"},
+	{Kind: "ReplicationController"}:                 {"rc"},
+	{Kind: "Service"}:                               {"svc"},
+	{Kind: "ServiceAccount"}:                        {"sa"},
+	{Group: "apps", Kind: "DaemonSet"}:              {"ds"},
+	{Group: "apps", Kind: "Deployment"}:             {"deploy"},
+	{Group: "apps", Kind: "ReplicaSet"}:             {"rs"},
+	{Group: "apps", Kind: "StatefulSet"}:            {"sts"},
+	{Group: "batch", Kind: "CronJob"}:               {"cj"},
+	{Group: "networking.k8s.io", Kind: "Ingress"}:   {"ing"},
+	{Group: "storage.k8s.io", Kind: "StorageClass"}: {"sc"},
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}: {"crd", "crds"},
+	{Group: "kubevirt.io", Kind: "VirtualMachine"}:                    {"vm", "vms"},
+	{Group: "kubevirt.io", Kind: "VirtualMachineInstance"}:            {"vmi", "vmis"},
+	{Group: "kubevirt.io", Kind: "VirtualMachineInstanceMigration"}:   {"vmim", "vmims"},
+	{Group: "cdi.kubevirt.io", Kind: "DataVolume"}:                    {"dv", "dvs"},
+	{Group: "longhorn.io", Kind: "Volume"}:                            {"lhv"},
+	{Group: "longhorn.io", Kind: "Replica"}:                           {"lhr"},
+	{Group: "longhorn.io", Kind: "Engine"}:                            {"lhe"},
+	{Group: "longhorn.io", Kind: "Node"}:                              {"lhn"},
+	{Group: "harvesterhci.io", Kind: "VirtualMachineImage"}:           {"vmimage", "vmimages"},
+	{Group: "harvesterhci.io", Kind: "VirtualMachineBackup"}:          {"vmbackup", "vmbackups"},
+}
+
+func newType(gvk schema.GroupVersionKind, fileResource string) *Type {
+	return &Type{
+		GroupVersionKind: gvk,
+		Resource:         pluralize(gvk.Kind, fileResource),
+		ShortNames:       shortNames[gvk.GroupKind()],
+	}
+}
+
+// pluralize returns the resource name of a kind. Bundles store objects in
+// files named after the resource, so the file name is used if it looks like
+// one. Otherwise the name is guessed the way CRDs are usually named.
+func pluralize(kind, fileResource string) string {
+	singular := strings.ToLower(kind)
+	fileResource = strings.ToLower(fileResource)
+	if singular == "endpoints" {
+		return singular
+	}
+	if fileResource != "" && fileResource != singular && strings.HasPrefix(fileResource, strings.TrimSuffix(singular, "y")) {
+		return fileResource
+	}
+	switch {
+	case strings.HasSuffix(singular, "s"), strings.HasSuffix(singular, "x"),
+		strings.HasSuffix(singular, "ch"), strings.HasSuffix(singular, "sh"):
+		return singular + "es"
+	case len(singular) > 1 && strings.HasSuffix(singular, "y") && !strings.ContainsAny(singular[len(singular)-2:len(singular)-1], "aeiou"):
+		return strings.TrimSuffix(singular, "y") + "ies"
+	}
+	return singular + "s"
+}
@@ -0,0 +1,31 @@
+package resources
+
+import "testing"
+
+func TestPluralize(t *testing.T) {
+	tests := []struct {
+		kind         string
+		fileResource string
+		want         string
+	}{
+		{"VirtualMachine", "virtualmachines", "virtualmachines"},
+		{"Endpoints", "endpoints", "endpoints"},
+		{"Endpoints", "", "endpoints"},
+		{"NetworkPolicy", "networkpolicies", "networkpolicies"},
+		// The file name is not a resource name, the plural is guessed.
+		{"VirtualMachine", "resources", "virtualmachines"},
+		{"VirtualMachine", "virtualmachine", "virtualmachines"},
+		{"Ingress", "", "ingresses"},
+		{"Box", "", "boxes"},
+		{"Patch", "", "patches"},
+		{"Mesh", "", "meshes"},
+		{"Policy", "", "policies"},
+		{"Gateway", "", "gateways"},
+		{"Y", "", "ys"},
+	}
+	for _, tt := range tests {
+		if got := pluralize(tt.kind, tt.fileResource); got != tt.want {
+			t.Errorf("pluralize(%q, %q) = %q, want %q", tt.kind, tt.fileResource, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package schedule
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retention limits the bundles kept in the output directory. Zero values
+// disable the corresponding limit.
+type Retention struct {
+	// Keep is the number of most recent bundles to keep.
+	Keep int
+	// MaxAge removes bundles older than this.
+	MaxAge time.Duration
+	// MaxBytes removes the oldest bundles until the total size fits.
+	MaxBytes int64
+}
+
+// bundleFiles groups the files that belong to one scheduled bundle, e.g., the
+// archive itself and its encrypted or split variants.
+type bundleFiles struct {
+	stem  string
+	time  time.Time
+	paths []string
+	size  int64
+}
+
+// Enforce removes bundles named ${prefix}-${timestamp}* in dir that exceed the
+// retention limits and returns the removed paths.
+func (r Retention) Enforce(dir, prefix string, now time.Time) ([]string, error) {
+	bundles, err := listBundles(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	// newest first
+	sort.Slice(bundles, func(i, j int) bool { return bundles[i].time.After(bundles[j].time) })
+
+	var total int64
+	var removed []string
+	for i, b := range bundles {
+		expired := (r.Keep > 0 && i >= r.Keep) ||
+			(r.MaxAge > 0 && now.Sub(b.time) > r.MaxAge) ||
+			(r.MaxBytes > 0 && total+b.size > r.MaxBytes && i > 0)
+		if !expired {
+			total += b.size
+			continue
+		}
+		for _, p := range b.paths {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+			removed = append(removed, p)
+		}
+	}
+	return removed, nil
+}
+
+func listBundles(dir, prefix string) ([]*bundleFiles, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byStem := map[string]*bundleFiles{}
+	var bundles []*bundleFiles
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		stem, t, ok := parseName(info.Name(), prefix)
+		if !ok {
+			continue
+		}
+		b, found := byStem[stem]
+		if !found {
+			b = &bundleFiles{stem: stem, time: t}
+			byStem[stem] = b
+			bundles = append(bundles, b)
+		}
+		b.paths = append(b.paths, filepath.Join(dir, info.Name()))
+		b.size += info.Size()
+	}
+	return bundles, nil
+}
+
+// parseName extracts the stem and timestamp from names like
+// "supportbundle-20210102T150405Z.zip.enc".
+func parseName(name, prefix string) (string, time.Time, bool) {
+	if !strings.HasPrefix(name, prefix+"-") {
+		return "", time.Time{}, false
+	}
+	rest := strings.TrimPrefix(name, prefix+"-")
+	if len(rest) < len(TimestampFormat) {
+		return "", time.Time{}, false
+	}
+	t, err := time.Parse(TimestampFormat, rest[:len(TimestampFormat)])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return prefix + "-" + rest[:len(TimestampFormat)], t, true
+}
@@ -0,0 +1,104 @@
+package schedule
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnforce(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	stamp := func(age time.Duration) string {
+		return "sb-" + now.Add(-age).Format(TimestampFormat)
+	}
+	// The files of every bundle, newest first, with their size.
+	files := map[string]int{
+		stamp(1*time.Hour) + ".zip":            100,
+		stamp(2*time.Hour) + ".zip.enc":        100,
+		stamp(3*time.Hour) + ".zip":            100,
+		stamp(3*time.Hour) + ".zip.index.json": 10,
+		stamp(3*time.Hour) + ".zip.part001":    100,
+		stamp(48*time.Hour) + ".zip":           100,
+		// not scheduled bundles
+		"other-" + now.Format(TimestampFormat) + ".zip": 100,
+		"sb-latest.zip": 100,
+	}
+	tests := []struct {
+		name      string
+		retention Retention
+		removed   []string
+	}{
+		{"unlimited", Retention{}, nil},
+		{"keep", Retention{Keep: 2}, []string{
+			stamp(3*time.Hour) + ".zip",
+			stamp(3*time.Hour) + ".zip.index.json",
+			stamp(3*time.Hour) + ".zip.part001",
+			stamp(48*time.Hour) + ".zip",
+		}},
+		{"max age", Retention{MaxAge: 24 * time.Hour}, []string{
+			stamp(48*time.Hour) + ".zip",
+		}},
+		// The split bundle takes 210 bytes and doesn't fit after the first two.
+		{"max bytes", Retention{MaxBytes: 350}, []string{
+			stamp(3*time.Hour) + ".zip",
+			stamp(3*time.Hour) + ".zip.index.json",
+			stamp(3*time.Hour) + ".zip.part001",
+		}},
+		// The newest bundle is kept even if it alone exceeds the limit.
+		{"max bytes below one bundle", Retention{MaxBytes: 50}, []string{
+			stamp(2*time.Hour) + ".zip.enc",
+			stamp(3*time.Hour) + ".zip",
+			stamp(3*time.Hour) + ".zip.index.json",
+			stamp(3*time.Hour) + ".zip.part001",
+			stamp(48*time.Hour) + ".zip",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "retention")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, size := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			removed, err := tt.retention.Enforce(dir, "sb", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range removed {
+				got = append(got, filepath.Base(p))
+			}
+			sort.Strings(got)
+			want := append([]string(nil), tt.removed...)
+			sort.Strings(want)
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("removed %v, want %v", got, want)
+			}
+			for name := range files {
+				_, err := os.Stat(filepath.Join(dir, name))
+				if gone := os.IsNotExist(err); gone != contains(want, name) {
+					t.Errorf("%s exists: %t", name, !gone)
+				}
+			}
+		})
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
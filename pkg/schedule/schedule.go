@@ -0,0 +1,228 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/library"
+	"github.com/robfig/cron/v3"
+)
+
+// TimestampFormat is used in the names of scheduled bundles.
+const TimestampFormat = "20060102T150405Z"
+
+// Job collects a bundle into output and returns the path it was saved to,
+// which may differ from output, e.g., when the bundle is encrypted.
+type Job func(ctx context.Context, output string) (string, error)
+
+// Status is the state of the scheduler reported by the status endpoint.
+type Status struct {
+	Schedule            string     `json:"schedule"`
+	Running             bool       `json:"running"`
+	Runs                int        `json:"runs"`
+	Failures            int        `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastRun             *RunStatus `json:"lastRun,omitempty"`
+	LastSuccess         *RunStatus `json:"lastSuccess,omitempty"`
+	NextRun             time.Time  `json:"nextRun"`
+}
+
+type RunStatus struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Success bool      `json:"success"`
+	Output  string    `json:"output,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+}
+
+// Scheduler runs a Job on a cron schedule and applies the retention policy
+// after every run. Runs never overlap; a run that is due while the previous
+// one is still going is skipped.
+type Scheduler struct {
+	Spec      string
+	OutputDir string
+	Prefix    string
+	Retention Retention
+	// MaxFailures is the number of consecutive failures after which the
+	// health endpoint reports unhealthy. Zero means never.
+	MaxFailures int
+	Job         Job
+	// Library, if set, forgets the bundles removed by the retention policy.
+	Library *library.Library
+
+	cron    *cron.Cron
+	entryID cron.EntryID
+	ctx     context.Context
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	stopped bool
+	status  Status
+}
+
+// Start schedules the job. The context is passed to every run; cancelling it
+// interrupts the current run.
+func (s *Scheduler) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.OutputDir, 0755); err != nil {
+		return err
+	}
+	s.ctx = ctx
+	s.status.Schedule = s.Spec
+	s.cron = cron.New()
+	id, err := s.cron.AddFunc(s.Spec, s.RunOnce)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %s", s.Spec, err)
+	}
+	s.entryID = id
+	s.cron.Start()
+	log.Printf("scheduled support bundle collection %q, next run at %s", s.Spec, s.nextRun().Format(time.RFC3339))
+	return nil
+}
+
+// Stop stops scheduling new runs and waits for the current one to finish.
+// Runs aren't started anymore afterwards.
+func (s *Scheduler) Stop() {
+	if s.cron != nil {
+		<-s.cron.Stop().Done()
+	}
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// RunOnce collects a bundle immediately.
+func (s *Scheduler) RunOnce() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	if s.status.Running {
+		s.mu.Unlock()
+		log.Printf("skip run: the previous run is still in progress")
+		return
+	}
+	s.status.Running = true
+	// Added under the lock, so Stop either waits for the run or the run
+	// doesn't start.
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	run := &RunStatus{Start: time.Now().UTC()}
+	output := filepath.Join(s.OutputDir, fmt.Sprintf("%s-%s.zip", s.Prefix, run.Start.Format(TimestampFormat)))
+	log.Printf("collecting support bundle to %s", output)
+
+	saved, err := s.Job(s.ctx, output)
+	run.End = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("fail to collect support bundle: %s", err)
+	} else {
+		run.Success = true
+		run.Output = saved
+		log.Printf("support bundle is saved to %s in %s", saved, run.End.Sub(run.Start).Round(time.Second))
+	}
+
+	removed, err := s.Retention.Enforce(s.OutputDir, s.Prefix, run.End)
+	if err != nil {
+		log.Printf("fail to enforce retention: %s", err)
+	}
+	for _, p := range removed {
+		log.Printf("removed %s", p)
+	}
+	run.Removed = removed
+	if err := s.forget(removed); err != nil {
+		log.Printf("fail to remove bundles from the library: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Running = false
+	s.status.Runs++
+	s.status.LastRun = run
+	if run.Success {
+		s.status.LastSuccess = run
+		s.status.ConsecutiveFailures = 0
+	} else {
+		s.status.Failures++
+		s.status.ConsecutiveFailures++
+	}
+}
+
+// forget removes the library entries of the bundles whose files are removed.
+func (s *Scheduler) forget(removed []string) error {
+	if s.Library == nil || len(removed) == 0 {
+		return nil
+	}
+	paths := map[string]bool{}
+	for _, p := range removed {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		paths[p] = true
+	}
+	entries, err := s.Library.Remove(func(e *library.Entry) bool {
+		for _, p := range append([]string{e.Path}, e.Files...) {
+			if paths[p] {
+				return true
+			}
+		}
+		return false
+	}, false)
+	for _, e := range entries {
+		log.Printf("removed bundle %s from the library", e.ID)
+	}
+	return err
+}
+
+func (s *Scheduler) nextRun() time.Time {
+	if s.cron == nil {
+		return time.Time{}
+	}
+	return s.cron.Entry(s.entryID).Next
+}
+
+// Status returns a snapshot of the scheduler state.
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.NextRun = s.nextRun()
+	return status
+}
+
+// Healthy reports whether the number of consecutive failures is within
+// MaxFailures.
+func (s *Scheduler) Healthy() bool {
+	status := s.Status()
+	return s.MaxFailures <= 0 || status.ConsecutiveFailures < s.MaxFailures
+}
+
+// Handler serves /healthz and /status.
+func (s *Scheduler) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.Healthy() {
+			http.Error(w, "too many consecutive failures", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s.Status())
+	})
+	return mux
+}
@@ -0,0 +1,150 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/library"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// writeJob saves a bundle to the output of every run and registers it.
+func writeJob(lib *library.Library) Job {
+	return func(ctx context.Context, output string) (string, error) {
+		if err := ioutil.WriteFile(output, []byte(output), 0644); err != nil {
+			return "", err
+		}
+		e, err := library.NewEntry("", output)
+		if err != nil {
+			return "", err
+		}
+		return output, lib.Add(e)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	dir := tempDir(t)
+	lib := library.New(filepath.Join(dir, "library.json"))
+
+	// A bundle of an earlier run, registered in the library.
+	old := filepath.Join(dir, "sb-"+time.Now().Add(-time.Hour).UTC().Format(TimestampFormat)+".zip")
+	if _, err := writeJob(lib)(context.Background(), old); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Scheduler{OutputDir: dir, Prefix: "sb", Retention: Retention{Keep: 1}, Job: writeJob(lib), Library: lib}
+	s.RunOnce()
+
+	status := s.Status()
+	if status.Runs != 1 || status.Failures != 0 || status.Running || status.LastSuccess == nil {
+		t.Fatalf("got status %+v", status)
+	}
+	if len(status.LastRun.Removed) != 1 || status.LastRun.Removed[0] != old {
+		t.Errorf("removed %v, want %s", status.LastRun.Removed, old)
+	}
+	if _, err := os.Stat(status.LastRun.Output); err != nil {
+		t.Error(err)
+	}
+	entries, err := lib.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != status.LastRun.Output {
+		t.Errorf("library lists %d bundle(s), want only %s", len(entries), status.LastRun.Output)
+	}
+}
+
+func TestRunOnceFailures(t *testing.T) {
+	s := &Scheduler{
+		OutputDir:   tempDir(t),
+		Prefix:      "sb",
+		MaxFailures: 2,
+		Job: func(ctx context.Context, output string) (string, error) {
+			return "", errors.New("cluster unreachable")
+		},
+	}
+	handler := s.Handler()
+	healthz := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return w.Code
+	}
+
+	s.RunOnce()
+	if code := healthz(); code != http.StatusOK {
+		t.Errorf("got status %d after a failure", code)
+	}
+	s.RunOnce()
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d after %d failures", code, s.MaxFailures)
+	}
+	status := s.Status()
+	if status.Failures != 2 || status.ConsecutiveFailures != 2 || status.LastRun.Error != "cluster unreachable" {
+		t.Errorf("got status %+v", status)
+	}
+}
+
+func TestStop(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runs := 0
+	s := &Scheduler{
+		OutputDir: tempDir(t),
+		Prefix:    "sb",
+		Job: func(ctx context.Context, output string) (string, error) {
+			runs++
+			close(started)
+			<-release
+			return output, nil
+		},
+	}
+	go s.RunOnce()
+	<-started
+
+	// Runs don't overlap.
+	s.RunOnce()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned during a run")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop didn't return after the run")
+	}
+
+	// Runs don't start once stopped.
+	s.RunOnce()
+	if runs != 1 || s.Status().Runs != 1 {
+		t.Errorf("got %d runs, want 1", runs)
+	}
+}
@@ -0,0 +1,266 @@
+package scope
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/report"
+)
+
+const (
+	// maxNestedSize bounds the size of nested archives, which are filtered in
+	// memory. Bigger ones are copied as they are.
+	maxNestedSize = 512 * 1024 * 1024
+	// maxLineSize bounds the length of log lines. Longer lines are kept.
+	maxLineSize = 1024 * 1024
+)
+
+// Scope narrows a bundle down to some namespaces, nodes and a time window.
+// Zero fields don't narrow anything.
+type Scope struct {
+	Namespaces []string
+	Nodes      []string
+	// Since and Until bound the time of log lines.
+	Since time.Time
+	Until time.Time
+	// ExcludeVMLogs leaves out the logs of virt-launcher pods, which run the
+	// VMs.
+	ExcludeVMLogs bool
+}
+
+// IsZero reports whether the scope is the whole bundle.
+func (s Scope) IsZero() bool {
+	return len(s.Namespaces) == 0 && len(s.Nodes) == 0 && s.Since.IsZero() && s.Until.IsZero() && !s.ExcludeVMLogs
+}
+
+// Spec returns the scope as fields of a bundle request, named like the
+// fields of the SupportBundle resource.
+func (s Scope) Spec() map[string]interface{} {
+	spec := map[string]interface{}{}
+	if len(s.Namespaces) > 0 {
+		spec["namespaces"] = toInterfaces(s.Namespaces)
+	}
+	if len(s.Nodes) > 0 {
+		spec["nodes"] = toInterfaces(s.Nodes)
+	}
+	if !s.Since.IsZero() {
+		spec["since"] = s.Since.UTC().Format(time.RFC3339)
+	}
+	if !s.Until.IsZero() {
+		spec["until"] = s.Until.UTC().Format(time.RFC3339)
+	}
+	if s.ExcludeVMLogs {
+		spec["excludeVMLogs"] = true
+	}
+	return spec
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
+// Stats counts what Filter left out.
+type Stats struct {
+	Files        int
+	RemovedFiles int
+	RemovedLines int
+}
+
+// Filter rewrites the bundle zip at path without the resources, logs and log
+// lines outside the scope. It's the fallback for servers that can't generate
+// scoped bundles. Cluster-scoped resources are kept, and lines without a
+// timestamp follow the last timestamped line.
+func Filter(bundle string, s Scope) (*Stats, error) {
+	zr, err := zip.OpenReader(bundle)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	f, err := ioutil.TempFile(filepath.Dir(bundle), "."+filepath.Base(bundle)+".*.part")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stats := &Stats{}
+	if err := s.filterZip(&zr.Reader, "", f, stats); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return stats, os.Rename(f.Name(), bundle)
+}
+
+// filterZip writes the files of zr in the scope to w. Files of nested
+// archives are named after the archive, e.g., nodes/node1.zip/logs/dmesg.log,
+// so prefix is the path of the archive.
+func (s Scope) filterZip(zr *zip.Reader, prefix string, w io.Writer, stats *Stats) error {
+	zw := zip.NewWriter(w)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		stats.Files++
+		if !s.keep(prefix + f.Name) {
+			stats.RemovedFiles++
+			continue
+		}
+		header := &zip.FileHeader{Name: f.Name, Method: f.Method, Comment: f.Comment, Modified: f.Modified}
+		header.SetMode(f.Mode())
+		out, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := s.filterFile(f, prefix+f.Name, out, stats); err != nil {
+			return fmt.Errorf("%s: %s", prefix+f.Name, err)
+		}
+	}
+	// The comment has the Harvester version of the bundle.
+	if err := zw.SetComment(zr.Comment); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (s Scope) filterFile(f *zip.File, name string, w io.Writer, stats *Stats) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	timed := !s.Since.IsZero() || !s.Until.IsZero()
+	switch {
+	case timed && strings.HasSuffix(name, ".zip") && f.UncompressedSize64 <= maxNestedSize:
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		nested, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			_, err = w.Write(data)
+			return err
+		}
+		return s.filterZip(nested, name+"/", w, stats)
+	case timed && isLog(name):
+		return s.filterLines(rc, w, stats)
+	}
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// filterLines copies the lines of r within the time window.
+func (s Scope) filterLines(r io.Reader, w io.Writer, stats *Stats) error {
+	ref := s.Until
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+	br := bufio.NewReaderSize(r, maxLineSize)
+	keep := true
+	long := false
+	for {
+		line, err := br.ReadSlice('\n')
+		if long || err == bufio.ErrBufferFull {
+			// A long line is copied as is, up to its end.
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+			long = err == bufio.ErrBufferFull
+			if long {
+				continue
+			}
+		} else if len(line) > 0 {
+			if ts, ok := report.ParseTimestamp(string(line), ref); ok {
+				keep = (s.Since.IsZero() || !ts.Before(s.Since)) && (s.Until.IsZero() || !ts.After(s.Until))
+			}
+			if keep {
+				if _, err := w.Write(line); err != nil {
+					return err
+				}
+			} else {
+				stats.RemovedLines++
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// keep reports whether a file of the bundle is in the scope.
+func (s Scope) keep(name string) bool {
+	if ns := segmentAfter(name, "/yamls/namespaced/"); ns != "" && !matches(s.Namespaces, ns) {
+		return false
+	}
+	if ns := segmentAfter(name, "/logs/"); ns != "" && segmentAfter(name, "/nodes/") == "" {
+		if !matches(s.Namespaces, ns) {
+			return false
+		}
+		pod := segmentAfter(name, "/logs/"+ns+"/")
+		if s.ExcludeVMLogs && strings.HasPrefix(pod, "virt-launcher-") {
+			return false
+		}
+	}
+	if node := strings.TrimSuffix(segmentAfter(name, "/nodes/"), ".zip"); node != "" && !matches(s.Nodes, node) {
+		return false
+	}
+	return true
+}
+
+// segmentAfter returns the path segment following dir in name, or "" if
+// name isn't under dir.
+func segmentAfter(name string, dir string) string {
+	i := strings.Index("/"+name, dir)
+	if i < 0 {
+		return ""
+	}
+	rest := ("/" + name)[i+len(dir):]
+	if j := strings.Index(rest, "/"); j >= 0 {
+		return rest[:j]
+	}
+	return rest
+}
+
+// matches reports whether value is one of values, or values is empty.
+func matches(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isLog reports whether a file of the bundle is a plain-text log.
+func isLog(name string) bool {
+	if segmentAfter(name, "/logs/") == "" && segmentAfter(name, "/nodes/") == "" {
+		return false
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip", ".gz", ".xz", ".bz2", ".tar", ".journal", ".zst", ".yaml", ".json":
+		return false
+	}
+	return true
+}
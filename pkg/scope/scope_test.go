@@ -0,0 +1,173 @@
+package scope
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipFile is a file of a test archive.
+type zipFile struct {
+	name    string
+	content string
+}
+
+func zipData(t *testing.T, comment string, files ...zipFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+	}
+	if err := zw.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readZip returns the files of an archive by name, and its comment.
+func readZip(t *testing.T, data []byte) (map[string]string, string) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files, zr.Comment
+}
+
+func names(files map[string]string) []string {
+	var result []string
+	for name := range files {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestFilter(t *testing.T) {
+	node1 := zipData(t, "",
+		zipFile{"logs/messages", "Jun  1 09:00:00 node1 kernel: before\n" +
+			"Jun  1 10:15:00 node1 kernel: within\n" +
+			"Jun  1 11:30:00 node1 kernel: after\n"},
+		zipFile{"logs/dmesg.log", "[    1.000000] no timestamp\n"},
+	)
+	bundle := zipData(t, "Harvester version: v1.0.3",
+		zipFile{"bundle/yamls/cluster/v1/nodes.yaml", "nodes"},
+		zipFile{"bundle/yamls/namespaced/default/v1/pods.yaml", "default pods"},
+		zipFile{"bundle/yamls/namespaced/kube-system/v1/pods.yaml", "kube-system pods"},
+		zipFile{"bundle/logs/default/virt-launcher-vm1-abcde/compute.log", "2021-06-01T10:30:00Z vm log\n"},
+		zipFile{"bundle/logs/default/app-1/app.log", "2021-06-01T09:00:00Z before\n" +
+			"2021-06-01T10:30:00Z within\n" +
+			"\tcontinued\n" +
+			"2021-06-01T12:00:00Z after\n" +
+			"\tcontinued after\n"},
+		zipFile{"bundle/logs/kube-system/coredns-1/coredns.log", "2021-06-01T10:30:00Z dns\n"},
+		zipFile{"bundle/nodes/node1.zip", string(node1)},
+		zipFile{"bundle/nodes/node2.zip", string(zipData(t, "", zipFile{"logs/messages", "node2\n"}))},
+	)
+
+	dir, err := ioutil.TempDir("", "scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bundle.zip")
+	if err := ioutil.WriteFile(path, bundle, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Scope{
+		Namespaces:    []string{"default"},
+		Nodes:         []string{"node1"},
+		Since:         time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+		Until:         time.Date(2021, 6, 1, 11, 0, 0, 0, time.UTC),
+		ExcludeVMLogs: true,
+	}
+	stats, err := Filter(path, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (Stats{Files: 10, RemovedFiles: 4, RemovedLines: 5}) {
+		t.Errorf("got stats %+v", *stats)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, comment := readZip(t, data)
+	if comment != "Harvester version: v1.0.3" {
+		t.Errorf("got comment %q", comment)
+	}
+	want := []string{
+		"bundle/logs/default/app-1/app.log",
+		"bundle/nodes/node1.zip",
+		"bundle/yamls/cluster/v1/nodes.yaml",
+		"bundle/yamls/namespaced/default/v1/pods.yaml",
+	}
+	if got := names(files); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got files\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// Lines without a timestamp follow the last timestamped line.
+	if got := files["bundle/logs/default/app-1/app.log"]; got != "2021-06-01T10:30:00Z within\n\tcontinued\n" {
+		t.Errorf("got app.log %q", got)
+	}
+
+	nested, _ := readZip(t, []byte(files["bundle/nodes/node1.zip"]))
+	if got := nested["logs/messages"]; got != "Jun  1 10:15:00 node1 kernel: within\n" {
+		t.Errorf("got messages %q", got)
+	}
+	if got := nested["logs/dmesg.log"]; got != "[    1.000000] no timestamp\n" {
+		t.Errorf("got dmesg.log %q", got)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+		want  bool
+	}{
+		{"bundle/yamls/namespaced/default/v1/pods.yaml", Scope{Namespaces: []string{"default"}}, true},
+		{"bundle/yamls/namespaced/cattle-system/v1/pods.yaml", Scope{Namespaces: []string{"default"}}, false},
+		{"bundle/yamls/cluster/v1/nodes.yaml", Scope{Namespaces: []string{"default"}}, true},
+		{"bundle/logs/cattle-system/rancher-1/rancher.log", Scope{Namespaces: []string{"default"}}, false},
+		{"bundle/logs/default/virt-launcher-vm1-abcde/compute.log", Scope{ExcludeVMLogs: true}, false},
+		{"bundle/logs/default/virt-launcher-vm1-abcde/compute.log", Scope{Namespaces: []string{"default"}}, true},
+		{"bundle/nodes/node2.zip", Scope{Nodes: []string{"node1"}}, false},
+		{"bundle/nodes/node1/logs/messages", Scope{Nodes: []string{"node1"}}, true},
+		// Node logs aren't pod logs of a namespace.
+		{"bundle/nodes/node1.zip/logs/dmesg.log", Scope{Namespaces: []string{"default"}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.scope.keep(tt.name); got != tt.want {
+			t.Errorf("keep(%q) with %+v = %t, want %t", tt.name, tt.scope, got, tt.want)
+		}
+	}
+}
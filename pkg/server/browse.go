@@ -0,0 +1,367 @@
+package server
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+// sniffSize is the number of bytes inspected to tell text from binary files.
+const sniffSize = 8192
+
+type listItem struct {
+	Name     string
+	Href     string
+	IsDir    bool
+	IsZip    bool
+	Size     string
+	Modified string
+}
+
+type crumb struct {
+	Name string
+	Href string
+}
+
+type line struct {
+	Number int
+	HTML   template.HTML
+	Match  bool
+}
+
+type page struct {
+	Title  string
+	Crumbs []crumb
+
+	// directory listing
+	Items []listItem
+
+	// file view
+	Size        string
+	Binary      bool
+	Lines       []line
+	Truncated   bool
+	Query       string
+	OnlyMatches bool
+	Matches     int
+	RawHref     string
+	Download    string
+}
+
+func (s *Server) browse(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(r.URL.Path, browsePrefix)
+	segments := strings.Split(rel, archiveSeparator)
+
+	p, ok := s.fsPath(segments[0])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(segments) == 1 {
+		if info.IsDir() {
+			if rel != "" && !strings.HasSuffix(rel, "/") {
+				http.Redirect(w, r, browseHref(rel+"/"), http.StatusFound)
+				return
+			}
+			s.listDir(w, r, rel, p)
+			return
+		}
+		s.serveFile(w, r, rel, info.Size(), func() (io.ReadCloser, error) { return os.Open(p) })
+		return
+	}
+
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("fail to open archive: %s", err), http.StatusUnprocessableEntity)
+		return
+	}
+	defer zr.Close()
+
+	archive := &zr.Reader
+	for _, name := range segments[1 : len(segments)-1] {
+		if archive, err = s.openNested(archive, name); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	name := segments[len(segments)-1]
+	if name == "" || strings.HasSuffix(name, "/") {
+		s.listArchive(w, r, rel, archive, name)
+		return
+	}
+	f := findFile(archive, name)
+	if f == nil {
+		if hasDir(archive, name+"/") {
+			http.Redirect(w, r, browseHref(rel+"/"), http.StatusFound)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	s.serveFile(w, r, rel, int64(f.UncompressedSize64), f.Open)
+}
+
+// openNested loads a zip archive stored in another one in memory.
+func (s *Server) openNested(archive *zip.Reader, name string) (*zip.Reader, error) {
+	f := findFile(archive, name)
+	if f == nil {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	if int64(f.UncompressedSize64) > s.MaxNestedSize {
+		return nil, fmt.Errorf("%s is too large to browse (%s), download it instead", name, utils.FormatSize(int64(f.UncompressedSize64)))
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	nested, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("fail to open archive %s: %s", name, err)
+	}
+	return nested, nil
+}
+
+func findFile(archive *zip.Reader, name string) *zip.File {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func hasDir(archive *zip.Reader, prefix string) bool {
+	for _, f := range archive.File {
+		if strings.HasPrefix(f.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) listDir(w http.ResponseWriter, r *http.Request, rel, p string) {
+	infos, err := ioutil.ReadDir(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var items []listItem
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		items = append(items, newListItem(rel, info.Name(), info.IsDir(), info.Size(), info.ModTime()))
+	}
+	s.render(w, listTemplate, &page{Title: titleOf(rel), Crumbs: crumbs(rel), Items: sortItems(items)})
+}
+
+// listArchive lists the immediate children of prefix in an archive. Zip files
+// don't always contain entries for directories, so they are derived from the
+// file names.
+func (s *Server) listArchive(w http.ResponseWriter, r *http.Request, rel string, archive *zip.Reader, prefix string) {
+	seen := map[string]bool{}
+	var items []listItem
+	for _, f := range archive.File {
+		if !strings.HasPrefix(f.Name, prefix) || f.Name == prefix {
+			continue
+		}
+		child := strings.TrimPrefix(f.Name, prefix)
+		isDir := false
+		if i := strings.Index(child, "/"); i >= 0 {
+			child, isDir = child[:i], true
+		}
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		items = append(items, newListItem(rel, child, isDir, int64(f.UncompressedSize64), f.Modified))
+	}
+	if len(items) == 0 && prefix != "" {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, listTemplate, &page{Title: titleOf(rel), Crumbs: crumbs(rel), Items: sortItems(items)})
+}
+
+func newListItem(rel, name string, isDir bool, size int64, modified time.Time) listItem {
+	item := listItem{
+		Name:  name,
+		IsDir: isDir,
+		IsZip: !isDir && strings.HasSuffix(strings.ToLower(name), ".zip"),
+	}
+	switch {
+	case isDir:
+		item.Href = browseHref(rel + name + "/")
+	case item.IsZip:
+		item.Href = browseHref(rel + name + archiveSeparator)
+	default:
+		item.Href = browseHref(rel + name)
+	}
+	if !isDir {
+		item.Size = utils.FormatSize(size)
+	}
+	if !modified.IsZero() {
+		item.Modified = modified.Local().Format("2006-01-02 15:04:05")
+	}
+	return item
+}
+
+func sortItems(items []listItem) []listItem {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].IsDir != items[j].IsDir {
+			return items[i].IsDir
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, rel string, size int64, open func() (io.ReadCloser, error)) {
+	rc, err := open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	name := path.Base(rel)
+	query := r.URL.Query()
+	// Plain zip links without the archive separator download the bundle,
+	// like the same path without the browse prefix does.
+	isPlainZip := !strings.Contains(rel, archiveSeparator) && strings.HasSuffix(strings.ToLower(name), ".zip")
+	if query.Get("download") != "" || isPlainZip {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		w.Header().Set("Content-Length", fmt.Sprint(size))
+		io.Copy(w, rc)
+		return
+	}
+	if query.Get("raw") != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.Copy(w, rc)
+		return
+	}
+
+	br := bufio.NewReaderSize(rc, sniffSize)
+	head, _ := br.Peek(sniffSize)
+	p := &page{
+		Title:    titleOf(rel),
+		Crumbs:   crumbs(rel),
+		Size:     utils.FormatSize(size),
+		Binary:   bytes.IndexByte(head, 0) >= 0,
+		RawHref:  browseHref(rel) + "?raw=1",
+		Download: browseHref(rel) + "?download=1",
+	}
+	if !p.Binary {
+		p.Query = query.Get("q")
+		p.OnlyMatches = query.Get("only") != "" && p.Query != ""
+		if err := s.readLines(br, highlighterFor(name), p); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.render(w, fileTemplate, p)
+}
+
+func (s *Server) readLines(r *bufio.Reader, hl highlighter, p *page) error {
+	needle := strings.ToLower(p.Query)
+	for n := 1; ; n++ {
+		text, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if text == "" && err == io.EOF {
+			return nil
+		}
+		text = strings.TrimRight(text, "\r\n")
+
+		l := line{Number: n}
+		if needle != "" && strings.Contains(strings.ToLower(text), needle) {
+			l.Match = true
+			p.Matches++
+			l.HTML = markMatches(text, needle)
+		} else if !p.OnlyMatches {
+			l.HTML = hl(text)
+		}
+		if l.Match || !p.OnlyMatches {
+			if len(p.Lines) >= s.MaxViewLines {
+				p.Truncated = true
+				return nil
+			}
+			p.Lines = append(p.Lines, l)
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (s *Server) render(w http.ResponseWriter, t *template.Template, p *page) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+func browseHref(rel string) string {
+	u := url.URL{Path: browsePrefix + rel}
+	return u.EscapedPath()
+}
+
+func titleOf(rel string) string {
+	if rel == "" {
+		return "/"
+	}
+	return strings.Replace(rel, archiveSeparator, "/", -1)
+}
+
+// crumbs splits a browse path into links to each parent directory or archive.
+func crumbs(rel string) []crumb {
+	result := []crumb{{Name: "bundles", Href: browseHref("")}}
+	tokens := strings.Split(strings.TrimSuffix(rel, "/"), "/")
+	acc := ""
+	for i, token := range tokens {
+		if token == "" {
+			continue
+		}
+		acc += token
+		c := crumb{Name: strings.TrimSuffix(token, "!")}
+		if i < len(tokens)-1 || strings.HasSuffix(rel, "/") {
+			c.Href = browseHref(acc + "/")
+		}
+		result = append(result, c)
+		acc += "/"
+	}
+	// the current location is not a link
+	result[len(result)-1].Href = ""
+	return result
+}
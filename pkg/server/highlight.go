@@ -0,0 +1,209 @@
+package server
+
+import (
+	"html/template"
+	"path"
+	"strings"
+)
+
+// highlighter renders one line of a file as HTML.
+type highlighter func(string) template.HTML
+
+func highlighterFor(name string) highlighter {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		return highlightYAML
+	case ".json":
+		return highlightJSON
+	}
+	return plain
+}
+
+func plain(s string) template.HTML {
+	return template.HTML(template.HTMLEscapeString(s))
+}
+
+func span(class, s string) string {
+	return `<span class="` + class + `">` + template.HTMLEscapeString(s) + `</span>`
+}
+
+// markMatches highlights case-insensitive occurrences of the lower-cased needle.
+func markMatches(s, needle string) template.HTML {
+	var b strings.Builder
+	lower := strings.ToLower(s)
+	for {
+		i := strings.Index(lower, needle)
+		// Lower-casing may change byte lengths for some scripts; fall back
+		// to plain text rather than splitting a rune.
+		if i < 0 || len(lower) != len(s) {
+			b.WriteString(template.HTMLEscapeString(s))
+			break
+		}
+		b.WriteString(template.HTMLEscapeString(s[:i]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(s[i:i+len(needle)]) + "</mark>")
+		s, lower = s[i+len(needle):], lower[i+len(needle):]
+	}
+	return template.HTML(b.String())
+}
+
+// highlightYAML colors comments, keys and scalar values. It works line by line
+// and doesn't understand multi-line scalars, which is good enough for reading
+// resource dumps.
+func highlightYAML(s string) template.HTML {
+	trimmed := strings.TrimLeft(s, " ")
+	indent := s[:len(s)-len(trimmed)]
+	if strings.HasPrefix(trimmed, "#") {
+		return template.HTML(indent + span("c", trimmed))
+	}
+
+	var b strings.Builder
+	b.WriteString(indent)
+	for strings.HasPrefix(trimmed, "- ") {
+		b.WriteString(span("p", "- "))
+		trimmed = trimmed[2:]
+	}
+	if trimmed == "---" || trimmed == "-" {
+		b.WriteString(span("p", trimmed))
+		return template.HTML(b.String())
+	}
+
+	if i := yamlKeyEnd(trimmed); i > 0 {
+		b.WriteString(span("k", trimmed[:i]))
+		b.WriteString(span("p", ":"))
+		trimmed = trimmed[i+1:]
+	}
+	value, comment := splitYAMLComment(trimmed)
+	b.WriteString(yamlScalar(value))
+	if comment != "" {
+		b.WriteString(span("c", comment))
+	}
+	return template.HTML(b.String())
+}
+
+// yamlKeyEnd returns the index of the colon ending a mapping key, or -1.
+func yamlKeyEnd(s string) int {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return -1
+		}
+		end += 2
+		if strings.HasPrefix(s[end:], ":") {
+			return end
+		}
+		return -1
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case ':':
+			if i+1 == len(s) || s[i+1] == ' ' {
+				return i
+			}
+		case ' ', '{', '[', '#':
+			if s[i] != ' ' || (i+1 < len(s) && s[i+1] == '#') {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+func splitYAMLComment(s string) (string, string) {
+	if i := strings.Index(s, " #"); i >= 0 && !strings.ContainsAny(s[:i], `"'`) {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+func yamlScalar(s string) string {
+	v := strings.TrimSpace(s)
+	lead := s[:len(s)-len(strings.TrimLeft(s, " "))]
+	switch {
+	case v == "":
+		return template.HTMLEscapeString(s)
+	case strings.HasPrefix(v, `"`) || strings.HasPrefix(v, "'"):
+		return lead + span("s", v)
+	case isLiteral(v) || isNumber(v):
+		return lead + span("n", v)
+	case v == "|" || v == ">" || v == "|-" || v == ">-" || v == "{}" || v == "[]":
+		return lead + span("p", v)
+	}
+	return lead + span("v", v)
+}
+
+// highlightJSON colors keys, strings, numbers and literals on a line of JSON.
+func highlightJSON(s string) template.HTML {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				end = len(s) - 1
+			}
+			str := s[i : end+1]
+			rest := strings.TrimLeft(s[end+1:], " ")
+			if strings.HasPrefix(rest, ":") {
+				b.WriteString(span("k", str))
+			} else {
+				b.WriteString(span("s", str))
+			}
+			i = end + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+				end++
+			}
+			b.WriteString(span("n", s[i:end]))
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			word := ""
+			for _, lit := range []string{"true", "false", "null"} {
+				if strings.HasPrefix(s[i:], lit) {
+					word = lit
+				}
+			}
+			if word == "" {
+				b.WriteString(template.HTMLEscapeString(string(c)))
+				i++
+				continue
+			}
+			b.WriteString(span("n", word))
+			i += len(word)
+		case strings.IndexByte("{}[],:", c) >= 0:
+			b.WriteString(span("p", string(c)))
+			i++
+		default:
+			b.WriteString(template.HTMLEscapeString(string(c)))
+			i++
+		}
+	}
+	return template.HTML(b.String())
+}
+
+func isLiteral(s string) bool {
+	switch s {
+	case "true", "false", "null", "~", "True", "False", "Null":
+		return true
+	}
+	return false
+}
+
+func isNumber(s string) bool {
+	if s == "" || s == "-" || s == "." {
+		return false
+	}
+	for i, c := range s {
+		if (c < '0' || c > '9') && c != '.' && !(i == 0 && c == '-') {
+			return false
+		}
+	}
+	return true
+}
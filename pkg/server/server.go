@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bk201/support-bundle-utils/pkg/upload"
+)
+
+const (
+	browsePrefix = "/browse/"
+
+	// archiveSeparator separates the path of an archive from the path of an
+	// entry inside it, e.g., /browse/bundle.zip!/nodes/node1.zip!/logs/dmesg.log.
+	archiveSeparator = "!/"
+)
+
+// Server serves the bundles in a directory. Bundles and the archives nested in
+// them can be browsed without downloading them.
+type Server struct {
+	// Root is the directory holding the bundles.
+	Root string
+	// MaxNestedSize bounds the size of nested archives, which are loaded in
+	// memory to be browsed.
+	MaxNestedSize int64
+	// MaxViewLines bounds the number of lines rendered for a text file.
+	MaxViewLines int
+	// Receiver accepts bundle uploads when set.
+	Receiver *upload.Receiver
+}
+
+const (
+	defaultMaxNestedSize = 512 * 1024 * 1024
+	defaultMaxViewLines  = 50000
+)
+
+func New(root string) *Server {
+	return &Server{
+		Root:          root,
+		MaxNestedSize: defaultMaxNestedSize,
+		MaxViewLines:  defaultMaxViewLines,
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(browsePrefix, s.browse)
+	if s.Receiver != nil {
+		mux.Handle(upload.PathPrefix, s.Receiver)
+		mux.Handle(strings.TrimSuffix(upload.PathPrefix, "/"), s.Receiver)
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/", s.serveRoot)
+	return mux
+}
+
+// serveRoot serves the files of the root at their own path, like the static
+// file server the image used to run, so links to /${bundle}.zip keep working.
+// Directories are redirected to be browsed.
+func (s *Server) serveRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		http.Redirect(w, r, browsePrefix, http.StatusFound)
+		return
+	}
+	p, ok := s.fsPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		http.Redirect(w, r, browsePrefix+strings.Trim(path.Clean(r.URL.Path), "/")+"/", http.StatusFound)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// fsPath maps a slash separated path relative to the root to a file system
+// path. It returns false if the path escapes the root or names a hidden file,
+// e.g., a partially written upload.
+func (s *Server) fsPath(rel string) (string, bool) {
+	cleaned := path.Clean("/" + rel)
+	if strings.Contains(cleaned, "\\") {
+		return "", false
+	}
+	for _, segment := range strings.Split(cleaned, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return "", false
+		}
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleaned)), true
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBrowseHidden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"acme/bundle.zip", "acme/.bundle.zip.123.part", ".uploads/abc.part", ".uploads/abc.json"} {
+		path := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := New(dir)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/browse/", http.StatusOK},
+		{"/browse/acme/", http.StatusOK},
+		{"/browse/acme/bundle.zip?raw=1", http.StatusOK},
+		{"/browse/.uploads/", http.StatusNotFound},
+		{"/browse/.uploads/abc.json", http.StatusNotFound},
+		{"/browse/acme/.bundle.zip.123.part", http.StatusNotFound},
+		{"/browse/acme/../.uploads/abc.part", http.StatusNotFound},
+		{"/browse/../etc/passwd", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// Call browse directly, the mux would redirect uncleaned paths
+			// before they reach it.
+			w := httptest.NewRecorder()
+			s.browse(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestServeRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"bundle.zip", "acme/bundle.zip", ".bundle.zip.123.part"} {
+		path := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("zipdata"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(New(dir).Handler())
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	tests := []struct {
+		path         string
+		rangeHeader  string
+		wantStatus   int
+		wantBody     string
+		wantLocation string
+	}{
+		{path: "/", wantStatus: http.StatusFound, wantLocation: "/browse/"},
+		{path: "/bundle.zip", wantStatus: http.StatusOK, wantBody: "zipdata"},
+		{path: "/acme/bundle.zip", wantStatus: http.StatusOK, wantBody: "zipdata"},
+		{path: "/bundle.zip", rangeHeader: "bytes=3-", wantStatus: http.StatusPartialContent, wantBody: "data"},
+		{path: "/acme", wantStatus: http.StatusFound, wantLocation: "/browse/acme/"},
+		{path: "/missing.zip", wantStatus: http.StatusNotFound},
+		{path: "/.bundle.zip.123.part", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+tt.rangeHeader, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("got body %q, want %q", body, tt.wantBody)
+			}
+			if loc := resp.Header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("got location %q, want %q", loc, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import "html/template"
+
+// The pages are rendered server side with inline styles only, so the UI works
+// in air-gapped environments without any external assets.
+const layoutHTML = `{{define "layout"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - support bundles</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #24292e; }
+header { background: #24292e; color: #fff; padding: 10px 20px; }
+header a { color: #fff; text-decoration: none; }
+header .sep { color: #959da5; padding: 0 4px; }
+main { padding: 16px 20px; }
+table.list { border-collapse: collapse; min-width: 60%; }
+table.list th, table.list td { text-align: left; padding: 4px 16px 4px 0; border-bottom: 1px solid #eaecef; }
+table.list td.size, table.list td.time { color: #586069; white-space: nowrap; }
+a { color: #0366d6; }
+.toolbar { margin-bottom: 12px; }
+.toolbar form { display: inline; margin-left: 16px; }
+.toolbar .info { color: #586069; margin-right: 12px; }
+table.code { border-collapse: collapse; font-family: SFMono-Regular, Consolas, Menlo, monospace; font-size: 12px; width: 100%; }
+table.code td { padding: 0 8px; vertical-align: top; }
+table.code td.ln { text-align: right; color: #959da5; user-select: none; width: 1%; border-right: 1px solid #eaecef; }
+table.code td.ln a { color: inherit; text-decoration: none; }
+table.code td.src { white-space: pre-wrap; word-break: break-all; }
+table.code tr.match td.src { background: #fffbdd; }
+table.code tr:target td { background: #f1f8ff; }
+mark { background: #ffdf5d; }
+.k { color: #005cc5; } .s { color: #032f62; } .n { color: #d73a49; } .c { color: #6a737d; font-style: italic; } .p { color: #6f42c1; } .v { color: #24292e; }
+.notice { background: #fff5b1; padding: 8px 12px; margin: 8px 0; }
+.jump a { margin-right: 6px; }
+</style>
+</head>
+<body>
+<header>{{range $i, $c := .Crumbs}}{{if $i}}<span class="sep">/</span>{{end}}{{if $c.Href}}<a href="{{$c.Href}}">{{$c.Name}}</a>{{else}}<strong>{{$c.Name}}</strong>{{end}}{{end}}</header>
+<main>{{template "content" .}}</main>
+</body>
+</html>{{end}}`
+
+const listHTML = `{{define "content"}}
+<table class="list">
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{range .Items}}<tr>
+<td>{{if .IsDir}}&#128193;{{else if .IsZip}}&#128230;{{else}}&#128196;{{end}} <a href="{{.Href}}">{{.Name}}{{if .IsDir}}/{{end}}</a>{{if .IsZip}} <a href="{{.Href}}?download=1" title="download">&#11015;</a>{{end}}</td>
+<td class="size">{{.Size}}</td>
+<td class="time">{{.Modified}}</td>
+</tr>{{else}}<tr><td colspan="3">empty</td></tr>{{end}}
+</table>
+{{end}}`
+
+const fileHTML = `{{define "content"}}
+<div class="toolbar">
+<span class="info">{{.Size}}</span>
+<a href="{{.Download}}">download</a> &middot; <a href="{{.RawHref}}">raw</a>
+{{if not .Binary}}<form method="get">
+<input type="search" name="q" value="{{.Query}}" placeholder="search in file" size="30">
+<label><input type="checkbox" name="only" value="1"{{if .OnlyMatches}} checked{{end}}> matching lines only</label>
+<button type="submit">search</button>
+</form>{{end}}
+</div>
+{{if .Binary}}<div class="notice">This is a binary file. Download it to inspect it.</div>
+{{else}}
+{{if .Query}}<div class="notice">{{.Matches}} matching line(s) for "{{.Query}}"{{if and .Matches (not .OnlyMatches)}}<div class="jump">{{range $i, $l := .Lines}}{{if $l.Match}}<a href="#L{{$l.Number}}">{{$l.Number}}</a>{{end}}{{end}}</div>{{end}}</div>{{end}}
+{{if .Truncated}}<div class="notice">Only the first {{len .Lines}} lines are shown. Download the file to see all of it.</div>{{end}}
+<table class="code">
+{{range .Lines}}<tr id="L{{.Number}}"{{if .Match}} class="match"{{end}}><td class="ln"><a href="#L{{.Number}}">{{.Number}}</a></td><td class="src">{{.HTML}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}`
+
+var (
+	listTemplate = template.Must(template.Must(template.New("layout").Parse(layoutHTML)).Parse(listHTML))
+	fileTemplate = template.Must(template.Must(template.New("layout").Parse(layoutHTML)).Parse(fileHTML))
+)
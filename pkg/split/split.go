@@ -0,0 +1,263 @@
+package split
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+const (
+	IndexVersion = 1
+	IndexSuffix  = ".index.json"
+)
+
+// Index describes a bundle split into parts. It is written next to the parts
+// as ${bundle}.index.json.
+type Index struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	PartSize  int64     `json:"partSize"`
+	CreatedAt time.Time `json:"createdAt"`
+	Parts     []Part    `json:"parts"`
+}
+
+type Part struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// PartName returns the file name of the n-th (1-based) part of a bundle.
+func PartName(name string, n int) string {
+	return fmt.Sprintf("%s.part%03d", name, n)
+}
+
+// IndexPath returns the index file path for a split bundle.
+func IndexPath(dir, name string) string {
+	return filepath.Join(dir, name+IndexSuffix)
+}
+
+// Split splits the file at path into parts of at most partSize bytes in dir
+// and writes the index. It returns the index file path.
+func Split(path, dir string, partSize int64) (string, error) {
+	if partSize <= 0 {
+		return "", fmt.Errorf("invalid part size %d", partSize)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	name := filepath.Base(path)
+	idx := Index{
+		Version:   IndexVersion,
+		Name:      name,
+		PartSize:  partSize,
+		CreatedAt: time.Now().UTC(),
+	}
+	whole := sha256.New()
+	src := io.TeeReader(in, whole)
+
+	for n := 1; ; n++ {
+		part := Part{Index: n, Name: PartName(name, n)}
+		size, sum, err := writePart(filepath.Join(dir, part.Name), io.LimitReader(src, partSize))
+		if err != nil {
+			return "", fmt.Errorf("fail to write %s: %s", part.Name, err)
+		}
+		// An empty trailing part means the previous one ended exactly at
+		// EOF. Keep it only when the whole file is empty.
+		if size == 0 && n > 1 {
+			os.Remove(filepath.Join(dir, part.Name))
+			break
+		}
+		part.Size, part.SHA256 = size, sum
+		idx.Parts = append(idx.Parts, part)
+		idx.Size += size
+		if size < partSize {
+			break
+		}
+	}
+	idx.SHA256 = hex.EncodeToString(whole.Sum(nil))
+
+	indexPath := IndexPath(dir, name)
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(indexPath, data, 0644); err != nil {
+		return "", err
+	}
+	return indexPath, nil
+}
+
+func writePart(path string, r io.Reader) (int64, string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), f.Close()
+}
+
+// ReadIndex reads a split index file.
+func ReadIndex(path string) (*Index, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("malformed index: %s", err)
+	}
+	if idx.Version != IndexVersion {
+		return nil, fmt.Errorf("unsupported index version %d", idx.Version)
+	}
+	if len(idx.Parts) == 0 {
+		return nil, errors.New("index lists no parts")
+	}
+	if !validName(idx.Name) {
+		return nil, fmt.Errorf("invalid bundle name %q", idx.Name)
+	}
+	for i, p := range idx.Parts {
+		if p.Index != i+1 {
+			return nil, fmt.Errorf("index lists part %d at position %d", p.Index, i+1)
+		}
+		if !validName(p.Name) {
+			return nil, fmt.Errorf("invalid name %q of part %d", p.Name, p.Index)
+		}
+	}
+	return &idx, nil
+}
+
+// validName reports whether name is a plain file name. Names come from the
+// index, which may not be trusted, and must not point outside its directory.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// Verify checks that every part listed in the index at indexPath exists and
+// matches its checksum. Parts are looked up in the index directory. All
+// problems are reported in a single error.
+func Verify(indexPath string) (*Index, error) {
+	idx, err := ReadIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(indexPath)
+
+	bySum := map[string]Part{}
+	for _, p := range idx.Parts {
+		bySum[p.SHA256] = p
+	}
+
+	var problems []string
+	for _, p := range idx.Parts {
+		path := filepath.Join(dir, p.Name)
+		sum, size, err := utils.SHA256File(path)
+		if os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("part %d (%s) is missing", p.Index, p.Name))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sum == p.SHA256 {
+			continue
+		}
+		if other, ok := bySum[sum]; ok {
+			problems = append(problems, fmt.Sprintf("%s contains part %d, expected part %d: parts are renamed or out of order", p.Name, other.Index, p.Index))
+		} else if size != p.Size {
+			problems = append(problems, fmt.Sprintf("%s has %d bytes, expected %d: the part is truncated or incomplete", p.Name, size, p.Size))
+		} else {
+			problems = append(problems, fmt.Sprintf("%s checksum mismatch: the part is corrupted", p.Name))
+		}
+	}
+	if len(problems) > 0 {
+		return idx, fmt.Errorf("%d problem(s) found:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	return idx, nil
+}
+
+// Join verifies the parts listed in the index at indexPath and concatenates
+// them into output, the bundle name next to the index by default. The parts
+// are joined into a temporary file that replaces output once its checksum is
+// verified, so a failure leaves an existing file alone. An existing output is
+// refused unless force is set.
+func Join(indexPath, output string, force bool) (*Index, error) {
+	idx, err := Verify(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(indexPath)
+	if output == "" {
+		output = filepath.Join(dir, idx.Name)
+	}
+	if !force {
+		if _, err := os.Lstat(output); err == nil {
+			return nil, &os.PathError{Op: "create", Path: output, Err: os.ErrExist}
+		}
+	}
+
+	outDir, base := filepath.Split(output)
+	if outDir == "" {
+		outDir = "."
+	}
+	out, err := ioutil.TempFile(outDir, "."+base+".*.part")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(out.Name())
+
+	whole := sha256.New()
+	err = joinParts(idx, dir, io.MultiWriter(out, whole))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && hex.EncodeToString(whole.Sum(nil)) != idx.SHA256 {
+		err = errors.New("checksum of the joined bundle does not match the index")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		if _, err := os.Lstat(output); err == nil {
+			return nil, &os.PathError{Op: "create", Path: output, Err: os.ErrExist}
+		}
+	}
+	return idx, os.Rename(out.Name(), output)
+}
+
+func joinParts(idx *Index, dir string, w io.Writer) error {
+	for _, p := range idx.Parts {
+		f, err := os.Open(filepath.Join(dir, p.Name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("fail to copy %s: %s", p.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package split
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitJoin(t *testing.T) {
+	const partSize = 100
+	tests := []struct {
+		name      string
+		size      int
+		wantParts int
+	}{
+		{"empty", 0, 1},
+		{"smaller than a part", partSize - 1, 1},
+		{"one part", partSize, 1},
+		{"part and a byte", partSize + 1, 2},
+		{"several parts", 3 * partSize, 3},
+		{"several parts and a half", 3*partSize + partSize/2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "split")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			data := make([]byte, tt.size)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "bundle.zip")
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			partsDir := filepath.Join(dir, "parts")
+			if err := os.Mkdir(partsDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			indexPath, err := Split(path, partsDir, partSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if indexPath != IndexPath(partsDir, "bundle.zip") {
+				t.Errorf("got index path %s", indexPath)
+			}
+			idx, err := Verify(indexPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(idx.Parts) != tt.wantParts {
+				t.Errorf("got %d parts, want %d", len(idx.Parts), tt.wantParts)
+			}
+			if idx.Size != int64(tt.size) {
+				t.Errorf("got size %d, want %d", idx.Size, tt.size)
+			}
+			files, _ := ioutil.ReadDir(partsDir)
+			if len(files) != tt.wantParts+1 {
+				t.Errorf("got %d files, want %d parts and the index", len(files), tt.wantParts)
+			}
+
+			output := filepath.Join(dir, "joined.zip")
+			if _, err := Join(indexPath, output, false); err != nil {
+				t.Fatal(err)
+			}
+			joined, err := ioutil.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Error("joined bundle differs")
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const partSize = 100
+	tests := []struct {
+		name    string
+		damage  func(t *testing.T, dir string)
+		wantErr string
+	}{
+		{"intact", func(t *testing.T, dir string) {}, ""},
+		{"missing", func(t *testing.T, dir string) {
+			remove(t, filepath.Join(dir, PartName("bundle.zip", 2)))
+		}, "part 2 (bundle.zip.part002) is missing"},
+		{"truncated", func(t *testing.T, dir string) {
+			if err := os.Truncate(filepath.Join(dir, PartName("bundle.zip", 3)), partSize/2); err != nil {
+				t.Fatal(err)
+			}
+		}, "bundle.zip.part003 has 50 bytes, expected 100"},
+		{"corrupted", func(t *testing.T, dir string) {
+			path := filepath.Join(dir, PartName("bundle.zip", 1))
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data[0] ^= 1
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, "bundle.zip.part001 checksum mismatch"},
+		{"swapped", func(t *testing.T, dir string) {
+			first := filepath.Join(dir, PartName("bundle.zip", 1))
+			second := filepath.Join(dir, PartName("bundle.zip", 2))
+			tmp := filepath.Join(dir, "tmp")
+			for _, mv := range [][2]string{{first, tmp}, {second, first}, {tmp, second}} {
+				if err := os.Rename(mv[0], mv[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}, "bundle.zip.part001 contains part 2, expected part 1"},
+		{"bad index", func(t *testing.T, dir string) {
+			if err := ioutil.WriteFile(IndexPath(dir, "bundle.zip"), []byte(`{"version":1,"parts":[]}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, "index lists no parts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "split")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			data := make([]byte, 3*partSize)
+			if _, err := rand.Read(data); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "bundle.zip")
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			indexPath, err := Split(path, dir, partSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			remove(t, path)
+			tt.damage(t, dir)
+
+			_, err = Verify(indexPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+
+			// Join refuses the damaged parts and leaves no output behind.
+			if _, err := Join(indexPath, "", false); err == nil {
+				t.Error("joining damaged parts succeeded")
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Error("a failed join left the output")
+			}
+		})
+	}
+}
+
+func remove(t *testing.T, path string) {
+	t.Helper()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJoinExisting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte(strings.Repeat("bundle", 50))
+	path := filepath.Join(dir, "bundle.zip")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	indexPath, err := Split(path, dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bundle is kept next to its parts, as download --split does.
+	if _, err := Join(indexPath, "", false); !os.IsExist(err) {
+		t.Fatalf("got error %v, want the output to exist", err)
+	}
+	if _, err := Join(indexPath, "", true); err != nil {
+		t.Fatal(err)
+	}
+	joined, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Error("joined bundle differs")
+	}
+
+	// A failed join leaves the existing bundle alone.
+	if err := os.Truncate(filepath.Join(dir, PartName("bundle.zip", 2)), 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Join(indexPath, "", true); err == nil {
+		t.Fatal("joining damaged parts succeeded")
+	}
+	if joined, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(joined, data) {
+		t.Errorf("a failed join changed the existing bundle: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, ".*.part"))
+	if len(files) > 0 {
+		t.Errorf("a failed join left %v", files)
+	}
+}
+
+func TestReadIndexNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		bundle  string
+		part    string
+		wantErr bool
+	}{
+		{"plain", "bundle.zip", "bundle.zip.part001", false},
+		{"dots in names", "bundle..zip", "bundle..zip.part001", false},
+		{"parent bundle", "../bundle.zip", "bundle.zip.part001", true},
+		{"parent part", "bundle.zip", "../../etc/cron.d/part", true},
+		{"absolute part", "bundle.zip", "/tmp/part", true},
+		{"backslash", `..\bundle.zip`, "bundle.zip.part001", true},
+		{"dot dot", "..", "bundle.zip.part001", true},
+		{"empty", "", "bundle.zip.part001", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "split")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			idx := Index{Version: IndexVersion, Name: tt.bundle, Parts: []Part{{Index: 1, Name: tt.part}}}
+			data, err := json.Marshal(idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "bundle.zip"+IndexSuffix)
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err = ReadIndex(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+const defaultChunkSize = 8 * 1024 * 1024
+
+// Client pushes bundles to a bundle server with resumable uploads.
+type Client struct {
+	ServerURL string
+	Token     string
+	ChunkSize int64
+	// Retries is the number of times a failed chunk is retried.
+	Retries int
+	// Progress is called after every chunk with the bytes sent so far.
+	Progress func(sent, total int64)
+
+	httpClient *http.Client
+}
+
+func NewClient(serverURL, token string, insecure bool) *Client {
+	return &Client{
+		ServerURL:  strings.TrimSuffix(serverURL, "/"),
+		Token:      token,
+		ChunkSize:  defaultChunkSize,
+		Retries:    5,
+		httpClient: utils.NewHTTPClient(5*time.Minute, insecure),
+	}
+}
+
+// Push uploads the file at path. An interrupted push of the same file resumes
+// from the last chunk the server received.
+func (c *Client) Push(ctx context.Context, path string) (*Session, error) {
+	sum, size, err := utils.SHA256File(path)
+	if err != nil {
+		return nil, err
+	}
+	name, err := SanitizeName(filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	body, _ := json.Marshal(&Session{Name: name, Size: size, SHA256: sum})
+	if err := c.do(ctx, http.MethodPost, SessionsPath, nil, bytes.NewReader(body), s); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	failures := 0
+	for !s.Done {
+		c.progress(s.Offset, size)
+		n := chunkSize
+		if s.Offset+n > size {
+			n = size - s.Offset
+		}
+		header := http.Header{HeaderOffset: []string{strconv.FormatInt(s.Offset, 10)}}
+		next := &Session{}
+		err := c.do(ctx, http.MethodPatch, SessionsPath+"/"+s.ID, header, io.NewSectionReader(f, s.Offset, n), next)
+		if err == nil {
+			s, failures = next, 0
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if e, ok := err.(*statusError); ok && e.code != http.StatusConflict && e.code < 500 {
+			return nil, err
+		}
+		failures++
+		if failures > c.Retries {
+			return nil, err
+		}
+		// Ask the server where to continue, the chunk may be partially stored.
+		time.Sleep(time.Duration(failures) * time.Second)
+		if err := c.do(ctx, http.MethodGet, SessionsPath+"/"+s.ID, nil, nil, s); err != nil && failures == c.Retries {
+			return nil, err
+		}
+	}
+	c.progress(size, size)
+	return s, nil
+}
+
+func (c *Client) progress(sent, total int64) {
+	if c.Progress != nil {
+		c.Progress(sent, total)
+	}
+}
+
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server responds %d: %s", e.code, e.message)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, c.ServerURL+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &statusError{code: resp.StatusCode, message: strings.TrimSpace(string(data))}
+	}
+	return json.Unmarshal(data, out)
+}
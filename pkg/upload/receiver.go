@@ -0,0 +1,515 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bk201/support-bundle-utils/pkg/client/utils"
+)
+
+// Receiver accepts authenticated bundle uploads into Root/{customer}/.
+// In-progress uploads are kept in Staging, which must be outside Root since
+// Root is served without authentication.
+type Receiver struct {
+	Root    string
+	Staging string
+	Tokens  Tokens
+	MaxSize int64
+
+	mu sync.Mutex
+	// busy holds the sessions receiving a chunk, so a slow client doesn't
+	// block the others.
+	busy map[string]bool
+}
+
+// NewReceiver returns a receiver storing bundles in root. staging defaults to
+// DefaultStagingDir(root).
+func NewReceiver(root, staging string, tokens Tokens, maxSize int64) (*Receiver, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if staging == "" {
+		if staging, err = DefaultStagingDir(root); err != nil {
+			return nil, err
+		}
+	}
+	if staging, err = filepath.Abs(staging); err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, staging); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("staging directory %s must be outside the bundle directory", staging)
+	}
+	if err := os.MkdirAll(staging, 0700); err != nil {
+		return nil, err
+	}
+	return &Receiver{Root: root, Staging: staging, Tokens: tokens, MaxSize: maxSize, busy: map[string]bool{}}, nil
+}
+
+// DefaultStagingDir returns the staging directory next to root, e.g.,
+// /bundles.uploads for /bundles.
+func DefaultStagingDir(root string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Dir(root) == root {
+		return "", fmt.Errorf("no staging directory next to %s, please specify one", root)
+	}
+	return root + ".uploads", nil
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	customer, ok := rc.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="support-bundle-upload"`)
+		http.Error(w, "invalid upload token", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == SessionsPath && r.Method == http.MethodPost:
+		rc.createSession(w, r, customer)
+	case strings.HasPrefix(r.URL.Path, SessionsPath+"/"):
+		id := strings.TrimPrefix(r.URL.Path, SessionsPath+"/")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			rc.getSession(w, r, customer, id)
+		case http.MethodPatch:
+			rc.appendChunk(w, r, customer, id)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case r.URL.Path == strings.TrimSuffix(PathPrefix, "/") && r.Method == http.MethodPost:
+		rc.multipartUpload(w, r, customer)
+	case r.Method == http.MethodPut:
+		rc.putUpload(w, r, customer, strings.TrimPrefix(r.URL.Path, PathPrefix))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (rc *Receiver) authenticate(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	customer, ok := rc.Tokens[strings.TrimPrefix(auth, "Bearer ")]
+	return customer, ok
+}
+
+func (rc *Receiver) putUpload(w http.ResponseWriter, r *http.Request, customer, name string) {
+	name, err := SanitizeName(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rc.MaxSize > 0 && r.ContentLength > rc.MaxSize {
+		http.Error(w, "bundle exceeds the upload size limit", http.StatusRequestEntityTooLarge)
+		return
+	}
+	rc.receive(w, customer, name, r.Header.Get(HeaderChecksum), http.MaxBytesReader(w, r.Body, rc.limit()))
+}
+
+func (rc *Receiver) multipartUpload(w http.ResponseWriter, r *http.Request, customer string) {
+	// Leave room for the multipart framing and the checksum field.
+	r.Body = http.MaxBytesReader(w, r.Body, rc.limit()+1024*1024)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The checksum may be sent before or after the file, so the file is only
+	// published once all parts are read.
+	checksum := r.Header.Get(HeaderChecksum)
+	var received *Session
+	var tmp string
+	defer func() {
+		if tmp != "" {
+			os.Remove(tmp)
+		}
+	}()
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		switch part.FormName() {
+		case "sha256":
+			data, _ := ioutil.ReadAll(io.LimitReader(part, 128))
+			checksum = strings.TrimSpace(string(data))
+		case "file":
+			if received != nil {
+				http.Error(w, `only one "file" field is allowed`, http.StatusBadRequest)
+				return
+			}
+			name, err := SanitizeName(part.FileName())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if tmp, received, err = rc.store(io.LimitReader(part, rc.limit()+1)); err != nil {
+				http.Error(w, fmt.Sprintf("fail to receive bundle: %s", err), errorStatus(err))
+				return
+			}
+			if received.Size > rc.limit() {
+				http.Error(w, "bundle exceeds the upload size limit", http.StatusRequestEntityTooLarge)
+				return
+			}
+			received.Name = name
+		}
+	}
+	if received == nil {
+		http.Error(w, `missing "file" field`, http.StatusBadRequest)
+		return
+	}
+	rc.finish(w, customer, tmp, checksum, received)
+}
+
+// receive stores a whole bundle from a single request.
+func (rc *Receiver) receive(w http.ResponseWriter, customer, name, checksum string, body io.Reader) {
+	tmp, received, err := rc.store(body)
+	if tmp != "" {
+		defer os.Remove(tmp)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("fail to receive bundle: %s", err), errorStatus(err))
+		return
+	}
+	received.Name = name
+	rc.finish(w, customer, tmp, checksum, received)
+}
+
+// errorStatus returns the status for an error reading a request body.
+// http.MaxBytesReader doesn't export its error, so it's matched by message.
+func errorStatus(err error) int {
+	if strings.Contains(err.Error(), "request body too large") {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// store writes body to a temporary file in the staging directory.
+func (rc *Receiver) store(body io.Reader) (string, *Session, error) {
+	tmp, err := ioutil.TempFile(rc.Staging, "put-")
+	if err != nil {
+		return "", nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return tmp.Name(), nil, err
+	}
+	return tmp.Name(), &Session{Size: size, SHA256: hex.EncodeToString(h.Sum(nil)), Offset: size}, nil
+}
+
+// finish verifies the checksum of a stored bundle and publishes it.
+func (rc *Receiver) finish(w http.ResponseWriter, customer, tmp, checksum string, s *Session) {
+	if checksum != "" && !strings.EqualFold(checksum, s.SHA256) {
+		http.Error(w, fmt.Sprintf("checksum mismatch: got %s, expect %s", s.SHA256, checksum), http.StatusUnprocessableEntity)
+		return
+	}
+	location, err := rc.publish(tmp, customer, s.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.Done = true
+	s.Location = location
+	writeJSON(w, http.StatusCreated, s)
+}
+
+func (rc *Receiver) createSession(w http.ResponseWriter, r *http.Request, customer string) {
+	var req Session
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := SanitizeName(req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Size <= 0 || len(req.SHA256) != sha256.Size*2 {
+		http.Error(w, "size and sha256 are required", http.StatusBadRequest)
+		return
+	}
+	if rc.MaxSize > 0 && req.Size > rc.MaxSize {
+		http.Error(w, "bundle exceeds the upload size limit", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// Resume the session of the same bundle if there is one.
+	id := sessionID(customer, name, strings.ToLower(req.SHA256))
+	if s, err := rc.loadSession(id); err == nil {
+		writeJSON(w, http.StatusOK, s)
+		return
+	}
+
+	s := &Session{ID: id, Customer: customer, Name: name, Size: req.Size, SHA256: strings.ToLower(req.SHA256)}
+	f, err := os.OpenFile(rc.partPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f.Close()
+	if err := rc.saveSession(s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", SessionsPath+"/"+id)
+	writeJSON(w, http.StatusCreated, s)
+}
+
+func (rc *Receiver) getSession(w http.ResponseWriter, r *http.Request, customer, id string) {
+	rc.mu.Lock()
+	s, err := rc.loadSession(id)
+	rc.mu.Unlock()
+	if err != nil || s.Customer != customer {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set(HeaderOffset, strconv.FormatInt(s.Offset, 10))
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (rc *Receiver) appendChunk(w http.ResponseWriter, r *http.Request, customer, id string) {
+	rc.mu.Lock()
+	s, err := rc.loadSession(id)
+	if err != nil || s.Customer != customer {
+		rc.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	if rc.busy[id] {
+		rc.mu.Unlock()
+		http.Error(w, "another chunk is being received", http.StatusConflict)
+		return
+	}
+	rc.busy[id] = true
+	rc.mu.Unlock()
+	defer func() {
+		rc.mu.Lock()
+		delete(rc.busy, id)
+		rc.mu.Unlock()
+	}()
+
+	offset, err := strconv.ParseInt(r.Header.Get(HeaderOffset), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid "+HeaderOffset, http.StatusBadRequest)
+		return
+	}
+	if offset != s.Offset {
+		// The client is out of sync, e.g., a chunk response got lost. It
+		// should continue from the offset we report.
+		w.Header().Set(HeaderOffset, strconv.FormatInt(s.Offset, 10))
+		writeJSON(w, http.StatusConflict, s)
+		return
+	}
+
+	f, err := os.OpenFile(rc.partPath(id), os.O_WRONLY, 0600)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(r.Body, s.Size-offset))
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	// Keep whatever arrived, so a broken connection only costs the rest of
+	// the chunk.
+	s.Offset += n
+	if err := rc.saveSession(s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if copyErr != nil {
+		http.Error(w, copyErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.Offset == s.Size {
+		if err := rc.complete(s); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	w.Header().Set(HeaderOffset, strconv.FormatInt(s.Offset, 10))
+	writeJSON(w, http.StatusOK, s)
+}
+
+// complete verifies a finished session and moves the bundle in place. A
+// corrupted upload is discarded so the client can start over.
+func (rc *Receiver) complete(s *Session) error {
+	sum, _, err := utils.SHA256File(rc.partPath(s.ID))
+	if err != nil {
+		return err
+	}
+	if sum != s.SHA256 {
+		rc.removeSession(s.ID)
+		return fmt.Errorf("checksum mismatch: got %s, expect %s. The upload is discarded", sum, s.SHA256)
+	}
+	location, err := rc.publish(rc.partPath(s.ID), s.Customer, s.Name)
+	if err != nil {
+		return err
+	}
+	rc.removeSession(s.ID)
+	s.Done = true
+	s.Location = location
+	return nil
+}
+
+// publish moves a received file to Root/{customer}/{name}, adding a timestamp
+// to the name if a bundle with the same name exists.
+func (rc *Receiver) publish(src, customer, name string) (string, error) {
+	dir := filepath.Join(rc.Root, customer)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, name)
+	if _, err := os.Stat(dst); err == nil {
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext), time.Now().UTC().Format("20060102T150405Z"), ext)
+		dst = filepath.Join(dir, name)
+	}
+	if err := move(src, dst); err != nil {
+		return "", err
+	}
+	os.Chmod(dst, 0644)
+	return customer + "/" + name, nil
+}
+
+// move renames src to dst. The staging directory may be on another file
+// system, e.g., when the bundle directory is a volume, then src is copied to
+// a hidden file next to dst first, so dst never appears partially written.
+func move(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if le, ok := err.(*os.LinkError); !ok || le.Err != syscall.EXDEV {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (rc *Receiver) limit() int64 {
+	if rc.MaxSize > 0 {
+		return rc.MaxSize
+	}
+	return 1 << 62
+}
+
+func (rc *Receiver) partPath(id string) string {
+	return filepath.Join(rc.Staging, id+".part")
+}
+
+func (rc *Receiver) sessionPath(id string) string {
+	return filepath.Join(rc.Staging, id+".json")
+}
+
+// sessionState is what is persisted for a session, including the customer
+// which is not sent to clients.
+type sessionState struct {
+	Session
+	Customer string `json:"customer"`
+}
+
+func (rc *Receiver) loadSession(id string) (*Session, error) {
+	if _, err := hex.DecodeString(id); err != nil {
+		return nil, errors.New("invalid session ID")
+	}
+	data, err := ioutil.ReadFile(rc.sessionPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	s := state.Session
+	s.Customer = state.Customer
+	return &s, nil
+}
+
+func (rc *Receiver) saveSession(s *Session) error {
+	data, err := json.Marshal(sessionState{Session: *s, Customer: s.Customer})
+	if err != nil {
+		return err
+	}
+	// Write and rename, so a concurrent reader never sees a partial file.
+	tmp := rc.sessionPath(s.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, rc.sessionPath(s.ID))
+}
+
+func (rc *Receiver) removeSession(id string) {
+	os.Remove(rc.partPath(id))
+	os.Remove(rc.sessionPath(id))
+}
+
+// sessionID derives a stable ID from the bundle identity, so the same push
+// resumes the same session. A random salt isn't needed since sessions are
+// bound to the customer.
+func sessionID(customer, name, sum string) string {
+	h := sha256.Sum256([]byte(customer + "\x00" + name + "\x00" + sum))
+	return hex.EncodeToString(h[:16])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
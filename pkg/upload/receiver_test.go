@@ -0,0 +1,367 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret"
+
+func newTestReceiver(t *testing.T, maxSize int64) (*Receiver, *httptest.Server, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := NewReceiver(filepath.Join(dir, "bundles"), "", Tokens{testToken: "acme"}, maxSize)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(rc.Root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(rc)
+	return rc, ts, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func testBundle(t *testing.T, size int) ([]byte, string) {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return data, hex.EncodeToString(sum[:])
+}
+
+func checkPublished(t *testing.T, rc *Receiver, location string, data []byte) {
+	t.Helper()
+	got, err := ioutil.ReadFile(filepath.Join(rc.Root, filepath.FromSlash(location)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("published bundle differs")
+	}
+	staged, _ := ioutil.ReadDir(rc.Staging)
+	if len(staged) > 0 {
+		t.Errorf("%d files are left in the staging directory", len(staged))
+	}
+}
+
+func TestNewReceiver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "bundles")
+
+	tests := []struct {
+		name        string
+		staging     string
+		wantStaging string
+		wantErr     bool
+	}{
+		{"default", "", root + ".uploads", false},
+		{"sibling", filepath.Join(dir, "staging"), filepath.Join(dir, "staging"), false},
+		{"similar prefix", root + "-staging", root + "-staging", false},
+		{"inside root", filepath.Join(root, ".uploads"), "", true},
+		{"root", root, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := NewReceiver(root, tt.staging, Tokens{}, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if err == nil && rc.Staging != tt.wantStaging {
+				t.Errorf("got staging directory %s, want %s", rc.Staging, tt.wantStaging)
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		chunkSize int64
+		// sent is what an interrupted push already uploaded.
+		sent int
+	}{
+		{"single chunk", 100, 1024, 0},
+		{"several chunks", 1000, 128, 0},
+		{"exact chunks", 1024, 256, 0},
+		{"resumed", 1000, 128, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, ts, cleanup := newTestReceiver(t, 0)
+			defer cleanup()
+			data, sum := testBundle(t, tt.size)
+			path := filepath.Join(filepath.Dir(rc.Root), "bundle.zip")
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.sent > 0 {
+				s := &Session{}
+				body, _ := json.Marshal(&Session{Name: "bundle.zip", Size: int64(tt.size), SHA256: sum})
+				resp := doRequest(t, ts, http.MethodPost, SessionsPath, nil, bytes.NewReader(body))
+				json.NewDecoder(resp.Body).Decode(s)
+				resp.Body.Close()
+				header := http.Header{HeaderOffset: []string{"0"}}
+				resp = doRequest(t, ts, http.MethodPatch, SessionsPath+"/"+s.ID, header, bytes.NewReader(data[:tt.sent]))
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("got status %d for the first chunk", resp.StatusCode)
+				}
+			}
+
+			c := NewClient(ts.URL, testToken, false)
+			c.ChunkSize = tt.chunkSize
+			var offsets []int64
+			c.Progress = func(sent, total int64) { offsets = append(offsets, sent) }
+			s, err := c.Push(context.Background(), path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.Done || s.Location != "acme/bundle.zip" {
+				t.Errorf("got session %+v", s)
+			}
+			if offsets[0] != int64(tt.sent) {
+				t.Errorf("push started at %d, want %d", offsets[0], tt.sent)
+			}
+			checkPublished(t, rc, s.Location, data)
+		})
+	}
+}
+
+func TestAppendChunk(t *testing.T) {
+	rc, ts, cleanup := newTestReceiver(t, 0)
+	defer cleanup()
+	data, sum := testBundle(t, 100)
+
+	create := func(sum string) *Session {
+		s := &Session{}
+		body, _ := json.Marshal(&Session{Name: "bundle.zip", Size: 100, SHA256: sum})
+		resp := doRequest(t, ts, http.MethodPost, SessionsPath, nil, bytes.NewReader(body))
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(s)
+		return s
+	}
+	s := create(sum)
+	patch := func(offset int, chunk []byte) *http.Response {
+		header := http.Header{HeaderOffset: []string{strconv.Itoa(offset)}}
+		resp := doRequest(t, ts, http.MethodPatch, SessionsPath+"/"+s.ID, header, bytes.NewReader(chunk))
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := patch(0, data[:40]); resp.StatusCode != http.StatusOK || resp.Header.Get(HeaderOffset) != "40" {
+		t.Fatalf("got status %d and offset %s", resp.StatusCode, resp.Header.Get(HeaderOffset))
+	}
+	// A retried chunk is refused with the offset to continue from.
+	if resp := patch(0, data[:40]); resp.StatusCode != http.StatusConflict || resp.Header.Get(HeaderOffset) != "40" {
+		t.Fatalf("got status %d and offset %s", resp.StatusCode, resp.Header.Get(HeaderOffset))
+	}
+	// Creating the session again resumes it.
+	if again := create(sum); again.ID != s.ID || again.Offset != 40 {
+		t.Fatalf("got session %+v", again)
+	}
+	// Extra data past the announced size is ignored.
+	if resp := patch(40, append(data[40:], 'x')); resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	checkPublished(t, rc, "acme/bundle.zip", data)
+
+	// A corrupted upload is discarded.
+	_, other := testBundle(t, 100)
+	s = create(other)
+	if resp := patch(0, data); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d for a corrupted upload", resp.StatusCode)
+	}
+	if staged, _ := ioutil.ReadDir(rc.Staging); len(staged) > 0 {
+		t.Errorf("%d files are left in the staging directory", len(staged))
+	}
+}
+
+func TestPutUpload(t *testing.T) {
+	const maxSize = 1000
+	data, sum := testBundle(t, 500)
+	large, _ := testBundle(t, maxSize+1)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		checksum   string
+		body       io.Reader
+		wantStatus int
+	}{
+		{"ok", "/upload/bundle.zip", testToken, sum, bytes.NewReader(data), http.StatusCreated},
+		{"no checksum", "/upload/bundle.zip", testToken, "", bytes.NewReader(data), http.StatusCreated},
+		{"wrong token", "/upload/bundle.zip", "wrong", sum, bytes.NewReader(data), http.StatusUnauthorized},
+		{"checksum mismatch", "/upload/bundle.zip", testToken, strings.Repeat("0", 64), bytes.NewReader(data), http.StatusUnprocessableEntity},
+		{"invalid name", "/upload/.hidden", testToken, sum, bytes.NewReader(data), http.StatusBadRequest},
+		{"too large", "/upload/bundle.zip", testToken, "", bytes.NewReader(large), http.StatusRequestEntityTooLarge},
+		// Without a Content-Length the limit is only hit while reading.
+		{"too large chunked", "/upload/bundle.zip", testToken, "", ioutil.NopCloser(bytes.NewReader(large)), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, ts, cleanup := newTestReceiver(t, maxSize)
+			defer cleanup()
+
+			req, err := http.NewRequest(http.MethodPut, ts.URL+tt.path, tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.checksum != "" {
+				req.Header.Set(HeaderChecksum, tt.checksum)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				body, _ := ioutil.ReadAll(resp.Body)
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus == http.StatusCreated {
+				checkPublished(t, rc, "acme/bundle.zip", data)
+			} else if files, _ := ioutil.ReadDir(filepath.Join(rc.Root, "acme")); len(files) > 0 {
+				t.Error("a refused upload is published")
+			}
+		})
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	const maxSize = 1000
+	data, sum := testBundle(t, 500)
+	large, _ := testBundle(t, maxSize+1)
+	filler := bytes.Repeat([]byte("x"), 2*1024*1024)
+
+	type field struct {
+		name, fileName string
+		data           []byte
+	}
+	tests := []struct {
+		name       string
+		fields     []field
+		wantStatus int
+	}{
+		{"ok", []field{{"file", "bundle.zip", data}}, http.StatusCreated},
+		{"checksum first", []field{{"sha256", "", []byte(sum)}, {"file", "bundle.zip", data}}, http.StatusCreated},
+		{"checksum last", []field{{"file", "bundle.zip", data}, {"sha256", "", []byte(sum)}}, http.StatusCreated},
+		{"path in file name", []field{{"file", "../../bundle.zip", data}}, http.StatusCreated},
+		{"checksum mismatch", []field{{"file", "bundle.zip", data}, {"sha256", "", []byte(strings.Repeat("0", 64))}}, http.StatusUnprocessableEntity},
+		{"missing file", []field{{"sha256", "", []byte(sum)}}, http.StatusBadRequest},
+		{"two files", []field{{"file", "bundle.zip", data}, {"file", "other.zip", data}}, http.StatusBadRequest},
+		{"file too large", []field{{"file", "bundle.zip", large}}, http.StatusRequestEntityTooLarge},
+		{"body too large", []field{{"comment", "", filler}, {"file", "bundle.zip", data}}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, ts, cleanup := newTestReceiver(t, maxSize)
+			defer cleanup()
+
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for _, f := range tt.fields {
+				var w io.Writer
+				var err error
+				if f.fileName != "" {
+					w, err = mw.CreateFormFile(f.name, f.fileName)
+				} else {
+					w, err = mw.CreateFormField(f.name)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				w.Write(f.data)
+			}
+			mw.Close()
+
+			header := http.Header{"Content-Type": []string{mw.FormDataContentType()}}
+			resp := doRequest(t, ts, http.MethodPost, "/upload", header, &body)
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				msg, _ := ioutil.ReadAll(resp.Body)
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, tt.wantStatus, msg)
+			}
+			if tt.wantStatus == http.StatusCreated {
+				checkPublished(t, rc, "acme/bundle.zip", data)
+			}
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "bundle.zip", want: "bundle.zip"},
+		{in: " bundle.zip ", want: "bundle.zip"},
+		{in: "../../etc/passwd", want: "passwd"},
+		{in: `..\..\bundle.zip`, want: "bundle.zip"},
+		{in: "/abs/bundle-1_2.zip", want: "bundle-1_2.zip"},
+		{in: "", wantErr: true},
+		{in: "..", wantErr: true},
+		{in: ".hidden", wantErr: true},
+		{in: "dir/", wantErr: true},
+		{in: "a b.zip", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := SanitizeName(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func doRequest(t *testing.T, ts *httptest.Server, method, path string, header http.Header, body io.Reader) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
@@ -0,0 +1,95 @@
+package upload
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Resumable uploads work like this:
+//
+//  1. POST /upload/sessions with a Session carrying the name, size and sha256
+//     of the bundle creates a session, or returns the existing one for the
+//     same bundle so an interrupted push resumes where it stopped.
+//  2. PATCH /upload/sessions/{id} with an Upload-Offset header appends a chunk
+//     at that offset. The response carries the new offset.
+//  3. When the last chunk arrives the checksum is verified and the bundle is
+//     moved into the bundle directory.
+//
+// Single-request uploads are also accepted with PUT /upload/{name} or a
+// multipart POST /upload with a "file" field, e.g., from curl.
+const (
+	PathPrefix   = "/upload/"
+	SessionsPath = "/upload/sessions"
+
+	HeaderOffset   = "Upload-Offset"
+	HeaderChecksum = "X-Checksum-Sha256"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Session is the state of a resumable upload.
+type Session struct {
+	ID       string `json:"id,omitempty"`
+	Customer string `json:"-"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Offset   int64  `json:"offset"`
+	Done     bool   `json:"done"`
+	// Location is the path of the bundle relative to the bundle directory
+	// once the upload is done.
+	Location string `json:"location,omitempty"`
+}
+
+// Tokens maps upload tokens to customer names.
+type Tokens map[string]string
+
+// LoadTokens reads a token file with one "<customer> <token>" pair per line.
+// Empty lines and lines starting with "#" are ignored.
+func LoadTokens(path string) (Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := Tokens{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expect \"<customer> <token>\"", path, n)
+		}
+		if !validName.MatchString(fields[0]) {
+			return nil, fmt.Errorf("%s:%d: invalid customer name %q", path, n, fields[0])
+		}
+		tokens[fields[1]] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("no upload tokens found")
+	}
+	return tokens, nil
+}
+
+// SanitizeName reduces a client supplied file name to a safe base name.
+func SanitizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return name, nil
+}